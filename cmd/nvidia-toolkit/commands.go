@@ -0,0 +1,128 @@
+/**
+# Copyright (c) 2021, NVIDIA CORPORATION.  All rights reserved.
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#     http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	log "github.com/sirupsen/logrus"
+	cli "github.com/urfave/cli/v2"
+)
+
+// renderOptions stores the options that are only used by the 'render' commands
+type renderOptions struct {
+	input  string
+	revert bool
+}
+
+// newCommands creates the commands of the multi-call binary. Each of these can
+// also be invoked through a link to the binary with the name of the command.
+func newCommands() []*cli.Command {
+	return []*cli.Command{
+		newToolkitCommand(),
+		newDockerCommand(),
+		newContainerdCommand(),
+		newCrioCommand(),
+		newCleanupCommand(),
+	}
+}
+
+// commandArgs returns the arguments with which to run the CLI if one of the
+// specified commands is invoked. A command is invoked either through a link to
+// the binary with the name of the command (e.g. 'containerd setup ...') or by
+// specifying it as the first argument (e.g. 'nvidia-toolkit containerd setup
+// ...'). The returned flag indicates whether a command is invoked.
+func commandArgs(commands []*cli.Command, args []string) ([]string, bool) {
+	if len(args) == 0 {
+		return args, false
+	}
+
+	name := filepath.Base(args[0])
+	for _, c := range commands {
+		if c.Name == name {
+			return append([]string{args[0], name}, args[1:]...), true
+		}
+	}
+
+	if len(args) < 2 {
+		return args, false
+	}
+	for _, c := range commands {
+		if c.Name == args[1] {
+			return args, true
+		}
+	}
+
+	return args, false
+}
+
+// renderFlags returns the flags that are only used by the 'render' command of
+// the specified runtime
+func renderFlags(runtime string, r *renderOptions) []cli.Flag {
+	return []cli.Flag{
+		&cli.StringFlag{
+			Name:        "input",
+			Aliases:     []string{"i"},
+			Usage:       fmt.Sprintf("Path to the %v config to render. If this is '-' the config is read from stdin", runtime),
+			Value:       "-",
+			Destination: &r.input,
+		},
+		&cli.BoolFlag{
+			Name:        "revert",
+			Usage:       "Render the config with the nvidia runtimes removed instead of added",
+			Destination: &r.revert,
+		},
+	}
+}
+
+// readInput reads the contents of the specified file, or of stdin if the path
+// is '-'
+func readInput(path string) ([]byte, error) {
+	if path == "-" {
+		log.Infof("Reading config from stdin")
+		contents, err := ioutil.ReadAll(os.Stdin)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read stdin: %v", err)
+		}
+		return contents, nil
+	}
+
+	log.Infof("Reading config from '%v'", path)
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read config: %v", err)
+	}
+	return contents, nil
+}
+
+// parseDirArg parses the directory that is the only positional argument of
+// the setup, cleanup, render, install and delete commands
+func parseDirArg(c *cli.Context) (string, error) {
+	args := c.Args()
+
+	log.Infof("Parsing arguments: %v", args.Slice())
+	if args.Len() != 1 {
+		return "", fmt.Errorf("incorrect number of arguments")
+	}
+	dir := args.Get(0)
+	log.Infof("Successfully parsed arguments")
+
+	return dir, nil
+}
@@ -0,0 +1,71 @@
+/**
+# Copyright (c) 2021, NVIDIA CORPORATION.  All rights reserved.
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#     http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+*/
+
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCommandArgs(t *testing.T) {
+	testCases := []struct {
+		args              []string
+		expectedArgs      []string
+		expectedIsCommand bool
+	}{
+		{
+			args:         []string{},
+			expectedArgs: []string{},
+		},
+		{
+			args:         []string{"nvidia-toolkit", "/usr/local/nvidia", "--no-daemon"},
+			expectedArgs: []string{"nvidia-toolkit", "/usr/local/nvidia", "--no-daemon"},
+		},
+		{
+			args:              []string{"nvidia-toolkit", "containerd", "setup", "/run/nvidia/toolkit"},
+			expectedArgs:      []string{"nvidia-toolkit", "containerd", "setup", "/run/nvidia/toolkit"},
+			expectedIsCommand: true,
+		},
+		{
+			args:              []string{"/work/containerd", "setup", "/run/nvidia/toolkit"},
+			expectedArgs:      []string{"/work/containerd", "containerd", "setup", "/run/nvidia/toolkit"},
+			expectedIsCommand: true,
+		},
+		{
+			args:              []string{"toolkit", "install", "/usr/local/nvidia/toolkit"},
+			expectedArgs:      []string{"toolkit", "toolkit", "install", "/usr/local/nvidia/toolkit"},
+			expectedIsCommand: true,
+		},
+		{
+			args:              []string{"crio"},
+			expectedArgs:      []string{"crio", "crio"},
+			expectedIsCommand: true,
+		},
+		{
+			args:         []string{"nvidia-toolkit"},
+			expectedArgs: []string{"nvidia-toolkit"},
+		},
+	}
+
+	commands := newCommands()
+	for i, tc := range testCases {
+		args, isCommand := commandArgs(commands, tc.args)
+		require.Equal(t, tc.expectedIsCommand, isCommand, "%d: %v", i, tc)
+		require.Equal(t, tc.expectedArgs, args, "%d: %v", i, tc)
+	}
+}
@@ -0,0 +1,259 @@
+/**
+# Copyright (c) 2021, NVIDIA CORPORATION.  All rights reserved.
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#     http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"reflect"
+	"sort"
+	"strings"
+
+	"container-toolkit/pkg/runtime/containerd"
+	"container-toolkit/pkg/runtime/crio"
+	"container-toolkit/pkg/runtime/docker"
+	"container-toolkit/pkg/toolkit"
+
+	cli "github.com/urfave/cli/v2"
+	yaml "gopkg.in/yaml.v3"
+)
+
+// configVersion is the version of the config file format
+const configVersion = "v1"
+
+// configFile is the declarative configuration of nvidia-toolkit. The options
+// of the toolkit and of each runtime are kept as YAML nodes until the
+// corresponding flags are parsed, since the values in the file are used as
+// the defaults of these flags.
+type configFile struct {
+	Version  string          `yaml:"version"`
+	Toolkit  yaml.Node       `yaml:"toolkit"`
+	Runtimes []runtimeConfig `yaml:"runtimes"`
+}
+
+// runtimeConfig defines a runtime target in the config file
+type runtimeConfig struct {
+	Name    string    `yaml:"name"`
+	Options yaml.Node `yaml:"options"`
+}
+
+// UnmarshalYAML decodes a runtime target from the config file, rejecting
+// unknown fields
+func (r *runtimeConfig) UnmarshalYAML(node *yaml.Node) error {
+	problems := unknownFields(node, reflect.TypeOf(*r), "runtime")
+	if len(problems) > 0 {
+		return &yaml.TypeError{Errors: problems}
+	}
+
+	type plain runtimeConfig
+	return node.Decode((*plain)(r))
+}
+
+// runtimeOptionTypes maps the names of the runtimes to the types of their
+// options. The YAML tags of these options define the fields of the options of
+// the runtimes in the config file.
+var runtimeOptionTypes = map[string]reflect.Type{
+	"docker":     reflect.TypeOf(docker.Options{}),
+	"containerd": reflect.TypeOf(containerd.Options{}),
+	"crio":       reflect.TypeOf(crio.Options{}),
+}
+
+// loadConfigFile loads and validates the config file at the specified path.
+// All problems found in the file are reported in the returned error along
+// with their line numbers.
+func loadConfigFile(path string) (*configFile, error) {
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read config file: %v", err)
+	}
+
+	var document yaml.Node
+	err = yaml.Unmarshal(contents, &document)
+	if err != nil {
+		return nil, fmt.Errorf("invalid config file '%v': %v", path, err)
+	}
+	if len(document.Content) == 0 {
+		return nil, fmt.Errorf("invalid config file '%v': the file is empty", path)
+	}
+
+	var c configFile
+	problems := unknownFields(document.Content[0], reflect.TypeOf(c), "the config file")
+	if len(problems) == 0 {
+		err = yaml.Unmarshal(contents, &c)
+		if err != nil {
+			return nil, fmt.Errorf("invalid config file '%v': %v", path, err)
+		}
+		problems = c.validate()
+	}
+	if len(problems) > 0 {
+		return nil, fmt.Errorf("invalid config file '%v':\n  %v", path, strings.Join(problems, "\n  "))
+	}
+
+	return &c, nil
+}
+
+// validate checks the config against the schema of its version and returns
+// the problems found
+func (c *configFile) validate() []string {
+	if c.Version != configVersion {
+		return []string{fmt.Sprintf("unsupported version '%v' (supported: '%v')", c.Version, configVersion)}
+	}
+
+	problems := validateOptions(optionalNode(&c.Toolkit), reflect.TypeOf(toolkit.Options{}), "toolkit")
+	for i, r := range c.Runtimes {
+		path := fmt.Sprintf("runtimes[%d]", i)
+
+		t, exists := runtimeOptionTypes[r.Name]
+		if !exists {
+			problems = append(problems, fmt.Sprintf("%v: unknown runtime '%v' (expected one of %v)", path, r.Name, strings.Join(optionNames(runtimeOptionTypes), ", ")))
+			continue
+		}
+		problems = append(problems, validateOptions(optionalNode(&r.Options), t, path+".options")...)
+	}
+	return problems
+}
+
+// runtimeTargets returns the runtime targets defined in the config with the
+// specified arguments, which override the options in the config
+func (c *configFile) runtimeTargets(args string) []runtimeTarget {
+	var targets []runtimeTarget
+	for i := range c.Runtimes {
+		r := &c.Runtimes[i]
+		targets = append(targets, runtimeTarget{name: r.Name, args: args, options: optionalNode(&r.Options)})
+	}
+	return targets
+}
+
+// toolkitOptions returns the toolkit options defined in the config, or nil if
+// no config is specified
+func (c *configFile) toolkitOptions() *yaml.Node {
+	if c == nil {
+		return nil
+	}
+	return optionalNode(&c.Toolkit)
+}
+
+// optionalNode returns the specified node, or nil if it is not in the config
+func optionalNode(node *yaml.Node) *yaml.Node {
+	if node.Kind == 0 {
+		return nil
+	}
+	return node
+}
+
+// validateOptions checks that the specified node only has fields of the
+// specified options type, and that their values can be decoded into these
+// fields. A nil node is valid.
+func validateOptions(node *yaml.Node, t reflect.Type, path string) []string {
+	if node == nil {
+		return nil
+	}
+
+	problems := unknownFields(node, t, path)
+	if len(problems) > 0 {
+		return problems
+	}
+
+	err := node.Decode(reflect.New(t).Interface())
+	if err != nil {
+		return []string{fmt.Sprintf("%v: %v", path, strings.TrimPrefix(err.Error(), "yaml: unmarshal errors:\n  "))}
+	}
+	return nil
+}
+
+// unknownFields checks that the specified node is a mapping whose keys are the
+// YAML names of the fields of the specified struct type, and returns the
+// problems found
+func unknownFields(node *yaml.Node, t reflect.Type, path string) []string {
+	if node.Kind != yaml.MappingNode {
+		return []string{fmt.Sprintf("line %d: %v must be a mapping", node.Line, path)}
+	}
+
+	fields := yamlFields(t)
+
+	var problems []string
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key := node.Content[i]
+		if _, exists := fields[key.Value]; !exists {
+			problems = append(problems, fmt.Sprintf("line %d: unknown field '%v' in %v (expected one of %v)", key.Line, key.Value, path, strings.Join(optionNames(fields), ", ")))
+		}
+	}
+	return problems
+}
+
+// yamlFields returns the YAML names of the exported fields of the specified
+// struct type that can be set from the config file
+func yamlFields(t reflect.Type) map[string]reflect.Type {
+	fields := make(map[string]reflect.Type)
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name := strings.Split(f.Tag.Get("yaml"), ",")[0]
+		if f.PkgPath != "" || name == "-" || name == "" {
+			continue
+		}
+		fields[name] = f.Type
+	}
+	return fields
+}
+
+func optionNames(m map[string]reflect.Type) []string {
+	var names []string
+	for name := range m {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// applyConfig sets the specified options to the values in the specified node
+// of the config file, and the options that are not in the config file to the
+// defaults of the specified flags, which have the options as their
+// destinations. The values in the config file are also used as the defaults
+// of the flags, so that flags and environment variables that are parsed
+// afterwards override these.
+func applyConfig(options interface{}, flags []cli.Flag, node *yaml.Node) error {
+	if node == nil {
+		return nil
+	}
+
+	for _, flag := range flags {
+		switch f := flag.(type) {
+		case *cli.StringFlag:
+			*f.Destination = f.Value
+		case *cli.BoolFlag:
+			*f.Destination = f.Value
+		default:
+			return fmt.Errorf("unsupported flag type %T", flag)
+		}
+	}
+
+	err := node.Decode(options)
+	if err != nil {
+		return fmt.Errorf("unable to apply config: %v", err)
+	}
+
+	for _, flag := range flags {
+		switch f := flag.(type) {
+		case *cli.StringFlag:
+			f.Value = *f.Destination
+		case *cli.BoolFlag:
+			f.Value = *f.Destination
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,248 @@
+/**
+# Copyright (c) 2021, NVIDIA CORPORATION.  All rights reserved.
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#     http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+*/
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"container-toolkit/pkg/runtime/containerd"
+	"container-toolkit/pkg/runtime/crio"
+	"container-toolkit/pkg/runtime/docker"
+	"container-toolkit/pkg/toolkit"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadConfigFile(t *testing.T) {
+	testCases := []struct {
+		contents         string
+		expectedRuntimes []string
+		expectedErrors   []string
+	}{
+		{
+			contents: `version: v1
+toolkit:
+  driverRoot: /run/nvidia/driver
+runtimes:
+- name: containerd
+  options:
+    config: /etc/containerd/config.toml
+    setAsDefault: false
+- name: docker
+`,
+			expectedRuntimes: []string{"containerd", "docker"},
+		},
+		{
+			contents:         "version: v1\n",
+			expectedRuntimes: []string{},
+		},
+		{
+			contents:       "",
+			expectedErrors: []string{"the file is empty"},
+		},
+		{
+			contents:       "version: v2\n",
+			expectedErrors: []string{"unsupported version 'v2'"},
+		},
+		{
+			contents:       "version: v1\nruntime: docker\n",
+			expectedErrors: []string{"line 2: unknown field 'runtime' in the config file (expected one of runtimes, toolkit, version)"},
+		},
+		{
+			contents: `version: v1
+toolkit:
+  driverroot: /run/nvidia/driver
+runtimes:
+- name: containerd
+  options:
+    config: /etc/containerd/config.toml
+    socket: /run/containerd/containerd.sock
+    runtimeDir: /usr/local/nvidia/toolkit
+`,
+			expectedErrors: []string{
+				"line 3: unknown field 'driverroot' in toolkit",
+				"line 9: unknown field 'runtimeDir' in runtimes[0].options",
+			},
+		},
+		{
+			contents:       "version: v1\nruntimes:\n- name: podman\n",
+			expectedErrors: []string{"runtimes[0]: unknown runtime 'podman' (expected one of containerd, crio, docker)"},
+		},
+		{
+			contents:       "version: v1\nruntimes:\n- name: docker\n  options:\n    setAsDefault: maybe\n",
+			expectedErrors: []string{"runtimes[0].options: line 5: cannot unmarshal !!str `maybe` into bool"},
+		},
+		{
+			contents:       "version: v1\nruntimes:\n- name: docker\n  option:\n    socket: /run/docker.sock\n",
+			expectedErrors: []string{"line 4: unknown field 'option' in runtime (expected one of name, options)"},
+		},
+		{
+			contents:       "version: v1\ntoolkit: /usr/local/nvidia\n",
+			expectedErrors: []string{"line 2: toolkit must be a mapping"},
+		},
+	}
+
+	dir, err := ioutil.TempDir("", "nvidia-toolkit-test-")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "config.yaml")
+	for i, tc := range testCases {
+		require.NoError(t, ioutil.WriteFile(path, []byte(tc.contents), 0644))
+
+		c, err := loadConfigFile(path)
+		if len(tc.expectedErrors) > 0 {
+			require.Error(t, err, "%d: %v", i, tc)
+			for _, e := range tc.expectedErrors {
+				require.Contains(t, err.Error(), e, "%d: %v", i, tc)
+			}
+			continue
+		}
+		require.NoError(t, err, "%d: %v", i, tc)
+
+		runtimes := []string{}
+		for _, r := range c.Runtimes {
+			runtimes = append(runtimes, r.Name)
+		}
+		require.Equal(t, tc.expectedRuntimes, runtimes, "%d: %v", i, tc)
+	}
+
+	_, err = loadConfigFile(filepath.Join(dir, "missing.yaml"))
+	require.Error(t, err)
+}
+
+func TestConfigFileOptions(t *testing.T) {
+	dir, err := ioutil.TempDir("", "nvidia-toolkit-test-")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "config.yaml")
+	contents := `version: v1
+toolkit:
+  driverRoot: /run/nvidia/driver
+  cliDebug: /var/log/nvidia-container-cli.log
+  configOverrides:
+    nvidia-container-cli.load-kmods: false
+runtimes:
+- name: containerd
+  options:
+    config: /etc/k3s/containerd/config.toml
+    setAsDefault: false
+- name: containerd
+  options:
+    socket: /run/k8s-containerd/containerd.sock
+- name: docker
+`
+	require.NoError(t, ioutil.WriteFile(path, []byte(contents), 0644))
+
+	c, err := loadConfigFile(path)
+	require.NoError(t, err)
+
+	to, err := newToolkitOptions("--nvidia-container-cli-debug=/tmp/cli.log", "/toolkit/dir", c.toolkitOptions())
+	require.NoError(t, err)
+	expected := &toolkit.Options{
+		ToolkitDir:      "/toolkit/dir",
+		DriverRoot:      "/run/nvidia/driver",
+		CLIDebug:        "/tmp/cli.log",
+		ConfigOverrides: map[string]interface{}{"nvidia-container-cli.load-kmods": false},
+	}
+	require.Equal(t, expected, to)
+
+	targets := c.runtimeTargets("")
+	require.Len(t, targets, 3)
+
+	r, err := newRuntime(targets[0], "/toolkit/dir")
+	require.NoError(t, err)
+	co := r.options.(*containerd.Options)
+	require.Equal(t, "/etc/k3s/containerd/config.toml", co.Config)
+	require.False(t, co.SetAsDefault)
+	require.False(t, co.DryRun)
+	require.Equal(t, "nvidia", co.RuntimeClass)
+	require.Equal(t, "/toolkit/dir", co.RuntimeDir)
+
+	r, err = newRuntime(targets[1], "/toolkit/dir")
+	require.NoError(t, err)
+	co = r.options.(*containerd.Options)
+	require.Equal(t, "/etc/containerd/config.toml", co.Config)
+	require.Equal(t, "/run/k8s-containerd/containerd.sock", co.Socket)
+	require.True(t, co.SetAsDefault)
+
+	// The environment overrides the options of the runtimes in the config
+	// file, while the options that are not set in the environment are kept
+	os.Setenv("CONTAINERD_CONFIG", "/etc/containerd/other.toml")
+	defer os.Unsetenv("CONTAINERD_CONFIG")
+
+	r, err = newRuntime(targets[0], "/toolkit/dir")
+	require.NoError(t, err)
+	co = r.options.(*containerd.Options)
+	require.Equal(t, "/etc/containerd/other.toml", co.Config)
+	require.False(t, co.SetAsDefault)
+
+	// The arguments override both the file and the environment
+	targets = c.runtimeTargets("--config=/etc/containerd/args.toml --set-as-default")
+	r, err = newRuntime(targets[0], "/toolkit/dir")
+	require.NoError(t, err)
+	co = r.options.(*containerd.Options)
+	require.Equal(t, "/etc/containerd/args.toml", co.Config)
+	require.True(t, co.SetAsDefault)
+
+	r, err = newRuntime(c.runtimeTargets("")[2], "/toolkit/dir")
+	require.NoError(t, err)
+	do := r.options.(*docker.Options)
+	require.Equal(t, "/var/run/docker.sock", do.Socket)
+	require.Equal(t, "/etc/docker/daemon.json", do.Config)
+
+	os.Setenv("NVIDIA_DRIVER_ROOT", "/driver")
+	defer os.Unsetenv("NVIDIA_DRIVER_ROOT")
+	to, err = newToolkitOptions("", "/toolkit/dir", c.toolkitOptions())
+	require.NoError(t, err)
+	require.Equal(t, "/driver", to.DriverRoot)
+	require.Equal(t, "/var/log/nvidia-container-cli.log", to.CLIDebug)
+}
+
+func TestConfigFileRuntimeArgs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "nvidia-toolkit-test-")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	configFile := filepath.Join(dir, "config.yaml")
+	contents := "version: v1\nruntimes:\n- name: crio\n  options:\n    hooksDir: " + dir + "\n"
+	require.NoError(t, ioutil.WriteFile(configFile, []byte(contents), 0644))
+
+	destinationArg = dir
+	require.NoError(t, parseRunFlags("--config-file="+configFile))
+	require.Len(t, runtimes, 1)
+
+	// The runtime arguments apply to every runtime in the config file
+	require.NoError(t, parseRunFlags("--config-file="+configFile, "--runtime-args=--dry-run"))
+	require.Len(t, runtimes, 1)
+	require.True(t, runtimes[0].dryRun)
+	require.Equal(t, dir, runtimes[0].options.(*crio.Options).HooksDir)
+
+	os.Setenv("RUNTIME_ARGS", "--hook-filename=other.json")
+	defer os.Unsetenv("RUNTIME_ARGS")
+	require.NoError(t, parseRunFlags("--config-file="+configFile))
+	require.Equal(t, "other.json", runtimes[0].options.(*crio.Options).HookFilename)
+	os.Unsetenv("RUNTIME_ARGS")
+
+	// The runtimes in the config file are ignored if a runtime is specified
+	require.NoError(t, parseRunFlags("--config-file="+configFile, "--runtime=crio", "--runtime-args=--hooks-dir="+dir))
+	require.Len(t, runtimes, 1)
+}
@@ -0,0 +1,136 @@
+/**
+# Copyright (c) 2021, NVIDIA CORPORATION.  All rights reserved.
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#     http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"container-toolkit/pkg/runtime/containerd"
+
+	log "github.com/sirupsen/logrus"
+	cli "github.com/urfave/cli/v2"
+)
+
+// newContainerdCommand creates the 'containerd' command for updating a
+// containerd config
+func newContainerdCommand() *cli.Command {
+	options := containerd.Options{}
+	renderOptions := renderOptions{}
+
+	// Create the 'setup' subcommand
+	setup := cli.Command{}
+	setup.Name = "setup"
+	setup.Usage = "Trigger a containerd config to be updated"
+	setup.ArgsUsage = "<runtime_dirname>"
+	setup.Action = func(c *cli.Context) error {
+		return setupContainerd(c, &options)
+	}
+
+	// Create the 'cleanup' subcommand
+	cleanup := cli.Command{}
+	cleanup.Name = "cleanup"
+	cleanup.Usage = "Trigger any updates made to a containerd config to be undone"
+	cleanup.ArgsUsage = "<runtime_dirname>"
+	cleanup.Action = func(c *cli.Context) error {
+		return cleanupContainerd(c, &options)
+	}
+
+	// Create the 'render' subcommand
+	render := cli.Command{}
+	render.Name = "render"
+	render.Usage = "Render an updated containerd config to stdout without modifying any files or restarting containerd"
+	render.ArgsUsage = "<runtime_dirname>"
+	render.Action = func(c *cli.Context) error {
+		return renderContainerd(c, &options, &renderOptions)
+	}
+
+	// Setup common flags across both subcommands. All subcommands get the same
+	// set of flags even if they don't use some of them. This is so that we
+	// only require the user to specify one set of flags for both 'startup'
+	// and 'cleanup' to simplify things.
+	commonFlags := containerd.Flags(&options)
+
+	// Update the subcommand flags with the common subcommand flags
+	setup.Flags = append([]cli.Flag{}, commonFlags...)
+	cleanup.Flags = append([]cli.Flag{}, commonFlags...)
+	render.Flags = append(append([]cli.Flag{}, commonFlags...), renderFlags("containerd", &renderOptions)...)
+
+	// Create the 'containerd' command
+	c := cli.Command{}
+	c.Name = "containerd"
+	c.Usage = "Update a containerd config with the nvidia-container-runtime"
+	c.Subcommands = []*cli.Command{
+		&setup,
+		&cleanup,
+		&render,
+	}
+
+	return &c
+}
+
+// setupContainerd updates a containerd configuration to include the nvidia-containerd-runtime and reloads it
+func setupContainerd(c *cli.Context, o *containerd.Options) error {
+	runtimeDir, err := parseDirArg(c)
+	if err != nil {
+		return fmt.Errorf("unable to parse args: %v", err)
+	}
+	o.RuntimeDir = runtimeDir
+
+	return containerd.Setup(o)
+}
+
+// cleanupContainerd reverts a containerd configuration to remove the nvidia-containerd-runtime and reloads it
+func cleanupContainerd(c *cli.Context, o *containerd.Options) error {
+	_, err := parseDirArg(c)
+	if err != nil {
+		return fmt.Errorf("unable to parse args: %v", err)
+	}
+
+	return containerd.Cleanup(o)
+}
+
+// renderContainerd writes the containerd config read from the specified input
+// to stdout with the nvidia runtimes added (or removed if --revert is
+// specified). No files are modified and containerd is not restarted, allowing
+// the command to be used as a filter when building node images.
+func renderContainerd(c *cli.Context, o *containerd.Options, r *renderOptions) error {
+	log.Infof("Starting 'render' for containerd")
+
+	runtimeDir, err := parseDirArg(c)
+	if err != nil {
+		return fmt.Errorf("unable to parse args: %v", err)
+	}
+	o.RuntimeDir = runtimeDir
+
+	input, err := readInput(r.input)
+	if err != nil {
+		return err
+	}
+
+	output, err := containerd.RenderConfigContents(input, o, r.revert)
+	if err != nil {
+		return err
+	}
+
+	_, err = os.Stdout.WriteString(output)
+	if err != nil {
+		return fmt.Errorf("unable to write output: %v", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,79 @@
+/**
+# Copyright (c) 2021, NVIDIA CORPORATION.  All rights reserved.
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#     http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+
+	"container-toolkit/pkg/runtime/crio"
+
+	cli "github.com/urfave/cli/v2"
+)
+
+// newCrioCommand creates the 'crio' command for managing the cri-o hooks
+func newCrioCommand() *cli.Command {
+	options := crio.Options{}
+
+	// Create the 'setup' subcommand
+	setup := cli.Command{}
+	setup.Name = "setup"
+	setup.Usage = "Create the cri-o hook required to run NVIDIA GPU containers"
+	setup.ArgsUsage = "<toolkit_dirname>"
+	setup.Action = func(c *cli.Context) error {
+		return setupCrio(c, &options)
+	}
+
+	// Create the 'cleanup' subcommand
+	cleanup := cli.Command{}
+	cleanup.Name = "cleanup"
+	cleanup.Usage = "Remove the NVIDIA cri-o hook"
+	cleanup.Action = func(c *cli.Context) error {
+		return crio.Cleanup(&options)
+	}
+
+	// Setup common flags across both subcommands. All subcommands get the same
+	// set of flags even if they don't use some of them. This is so that we
+	// only require the user to specify one set of flags for both 'startup'
+	// and 'cleanup' to simplify things.
+	commonFlags := crio.Flags(&options)
+
+	// Update the subcommand flags with the common subcommand flags
+	setup.Flags = append([]cli.Flag{}, commonFlags...)
+	cleanup.Flags = append([]cli.Flag{}, commonFlags...)
+
+	// Create the 'crio' command
+	c := cli.Command{}
+	c.Name = "crio"
+	c.Usage = "Update cri-o hooks to include the NVIDIA runtime hook"
+	c.Subcommands = []*cli.Command{
+		&setup,
+		&cleanup,
+	}
+
+	return &c
+}
+
+// setupCrio installs the prestart hook required to launch GPU-enabled containers
+func setupCrio(c *cli.Context, o *crio.Options) error {
+	toolkitDir, err := parseDirArg(c)
+	if err != nil {
+		return fmt.Errorf("unable to parse args: %v", err)
+	}
+	o.ToolkitDir = toolkitDir
+
+	return crio.Setup(o)
+}
@@ -0,0 +1,180 @@
+/**
+# Copyright (c) 2021, NVIDIA CORPORATION.  All rights reserved.
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#     http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	toml "github.com/pelletier/go-toml"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	runtimeAuto = "auto"
+
+	defaultDockerSocket     = "/var/run/docker.sock"
+	defaultContainerdSocket = "/run/containerd/containerd.sock"
+	defaultContainerdConfig = "/etc/containerd/config.toml"
+	defaultCrioHooksDir     = "/usr/share/containers/oci/hooks.d"
+	defaultCrioConfig       = "/etc/crio/crio.conf"
+	defaultCrioSocket       = "/var/run/crio/crio.sock"
+)
+
+// criPlugins lists the names under which the CRI plugin of containerd can be
+// disabled. If any of these are disabled, containerd is not used by kubelet.
+var criPlugins = []string{"cri", "io.containerd.grpc.v1.cri", "io.containerd.cri.v1.runtime"}
+
+// runtimeProbe holds the paths that are probed to detect the container
+// runtimes that are active on the node.
+type runtimeProbe struct {
+	dockerSocket     string
+	containerdSocket string
+	containerdConfig string
+	crioHooksDir     string
+	crioConfig       string
+	crioSocket       string
+}
+
+// newRuntimeProbe creates a probe for the default paths. These can be
+// overridden using the same environment variables as used by the runtime
+// commands.
+func newRuntimeProbe() runtimeProbe {
+	return runtimeProbe{
+		dockerSocket:     getEnvOrDefault("DOCKER_SOCKET", defaultDockerSocket),
+		containerdSocket: getEnvOrDefault("CONTAINERD_SOCKET", defaultContainerdSocket),
+		containerdConfig: getEnvOrDefault("CONTAINERD_CONFIG", defaultContainerdConfig),
+		crioHooksDir:     getEnvOrDefault("CRIO_HOOKS_DIR", defaultCrioHooksDir),
+		crioConfig:       getEnvOrDefault("CRIO_CONFIG", defaultCrioConfig),
+		crioSocket:       getEnvOrDefault("CRIO_SOCKET", defaultCrioSocket),
+	}
+}
+
+// detectRuntime returns the single container runtime that is active on the
+// node. The reasons for including or excluding each runtime are logged. An
+// error is returned if no runtime, or more than one runtime, is detected.
+func detectRuntime(p runtimeProbe) (string, error) {
+	log.Infof("Detecting container runtime")
+
+	detected := p.detect()
+	switch len(detected) {
+	case 0:
+		return "", fmt.Errorf("no active container runtime detected; specify one of {'docker', 'crio', 'containerd'} explicitly")
+	case 1:
+		log.Infof("Detected container runtime: %v", detected[0])
+		return detected[0], nil
+	}
+	return "", fmt.Errorf("detected more than one active container runtime (%v); specify the runtime explicitly", strings.Join(detected, ", "))
+}
+
+// detect returns the container runtimes that are active on the node
+func (p runtimeProbe) detect() []string {
+	probes := []struct {
+		runtime string
+		probe   func() (bool, string)
+	}{
+		{"docker", p.probeDocker},
+		{"containerd", p.probeContainerd},
+		{"crio", p.probeCrio},
+	}
+
+	var detected []string
+	for _, probe := range probes {
+		active, reason := probe.probe()
+		if !active {
+			log.Infof("Not using %v: %v", probe.runtime, reason)
+			continue
+		}
+		log.Infof("Found %v: %v", probe.runtime, reason)
+		detected = append(detected, probe.runtime)
+	}
+	return detected
+}
+
+// probeDocker checks whether the docker socket exists
+func (p runtimeProbe) probeDocker() (bool, string) {
+	if !isSocket(p.dockerSocket) {
+		return false, fmt.Sprintf("no socket at '%v'", p.dockerSocket)
+	}
+	return true, fmt.Sprintf("socket found at '%v'", p.dockerSocket)
+}
+
+// probeContainerd checks whether the containerd socket exists and whether the
+// CRI plugin is enabled in the containerd config. When docker is installed,
+// containerd is often also running, but with the CRI plugin disabled.
+func (p runtimeProbe) probeContainerd() (bool, string) {
+	if !isSocket(p.containerdSocket) {
+		return false, fmt.Sprintf("no socket at '%v'", p.containerdSocket)
+	}
+
+	if _, err := os.Stat(p.containerdConfig); os.IsNotExist(err) {
+		return true, fmt.Sprintf("socket found at '%v' and no config exists at '%v' (the CRI plugin is enabled by default)", p.containerdSocket, p.containerdConfig)
+	}
+
+	config, err := toml.LoadFile(p.containerdConfig)
+	if err != nil {
+		return false, fmt.Sprintf("socket found at '%v', but unable to load config '%v': %v", p.containerdSocket, p.containerdConfig, err)
+	}
+
+	disabled, _ := config.Get("disabled_plugins").([]interface{})
+	for _, plugin := range disabled {
+		for _, cri := range criPlugins {
+			if plugin == cri {
+				return false, fmt.Sprintf("socket found at '%v', but the CRI plugin is disabled in '%v'", p.containerdSocket, p.containerdConfig)
+			}
+		}
+	}
+
+	return true, fmt.Sprintf("socket found at '%v' and the CRI plugin is enabled in '%v'", p.containerdSocket, p.containerdConfig)
+}
+
+// probeCrio checks whether the cri-o hooks directory exists along with either
+// the cri-o socket or config. The hooks directory alone is not sufficient
+// since it is also used by podman.
+func (p runtimeProbe) probeCrio() (bool, string) {
+	info, err := os.Stat(p.crioHooksDir)
+	if err != nil || !info.IsDir() {
+		return false, fmt.Sprintf("no hooks directory at '%v'", p.crioHooksDir)
+	}
+
+	if isSocket(p.crioSocket) {
+		return true, fmt.Sprintf("hooks directory found at '%v' and socket found at '%v'", p.crioHooksDir, p.crioSocket)
+	}
+
+	if _, err := os.Stat(p.crioConfig); err == nil {
+		return true, fmt.Sprintf("hooks directory found at '%v' and config found at '%v'", p.crioHooksDir, p.crioConfig)
+	}
+
+	return false, fmt.Sprintf("hooks directory found at '%v', but neither socket '%v' nor config '%v' exist", p.crioHooksDir, p.crioSocket, p.crioConfig)
+}
+
+// isSocket checks whether the specified path is a unix socket
+func isSocket(path string) bool {
+	info, err := os.Stat(path)
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeSocket != 0
+}
+
+func getEnvOrDefault(name string, value string) string {
+	if v, exists := os.LookupEnv(name); exists && v != "" {
+		return v
+	}
+	return value
+}
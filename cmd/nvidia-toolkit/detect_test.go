@@ -0,0 +1,127 @@
+/**
+# Copyright (c) 2021, NVIDIA CORPORATION.  All rights reserved.
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#     http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+*/
+
+package main
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDetectRuntime(t *testing.T) {
+	testCases := []struct {
+		description      string
+		sockets          []string
+		dirs             []string
+		containerdConfig string
+		files            []string
+		expectedRuntime  string
+		expectedError    bool
+	}{
+		{
+			description:   "nothing found",
+			dirs:          []string{"hooks.d"},
+			expectedError: true,
+		},
+		{
+			description:     "docker",
+			sockets:         []string{"docker.sock"},
+			expectedRuntime: "docker",
+		},
+		{
+			description:      "docker with containerd with CRI disabled",
+			sockets:          []string{"docker.sock", "containerd.sock"},
+			containerdConfig: "disabled_plugins = [\"cri\"]\n",
+			expectedRuntime:  "docker",
+		},
+		{
+			description:      "docker with containerd with CRI enabled",
+			sockets:          []string{"docker.sock", "containerd.sock"},
+			containerdConfig: "version = 2\ndisabled_plugins = []\n",
+			expectedError:    true,
+		},
+		{
+			description:     "containerd without config",
+			sockets:         []string{"containerd.sock"},
+			expectedRuntime: "containerd",
+		},
+		{
+			description:      "containerd with v3 CRI plugin disabled",
+			sockets:          []string{"containerd.sock"},
+			containerdConfig: "version = 3\ndisabled_plugins = [\"io.containerd.cri.v1.runtime\"]\n",
+			expectedError:    true,
+		},
+		{
+			description:     "crio with socket",
+			sockets:         []string{"crio.sock"},
+			dirs:            []string{"hooks.d"},
+			expectedRuntime: "crio",
+		},
+		{
+			description:     "crio with config",
+			dirs:            []string{"hooks.d"},
+			files:           []string{"crio.conf"},
+			expectedRuntime: "crio",
+		},
+		{
+			description:   "crio without hooks directory",
+			sockets:       []string{"crio.sock"},
+			expectedError: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			root := t.TempDir()
+			p := runtimeProbe{
+				dockerSocket:     filepath.Join(root, "docker.sock"),
+				containerdSocket: filepath.Join(root, "containerd.sock"),
+				containerdConfig: filepath.Join(root, "config.toml"),
+				crioHooksDir:     filepath.Join(root, "hooks.d"),
+				crioConfig:       filepath.Join(root, "crio.conf"),
+				crioSocket:       filepath.Join(root, "crio.sock"),
+			}
+
+			for _, s := range tc.sockets {
+				l, err := net.Listen("unix", filepath.Join(root, s))
+				require.NoError(t, err)
+				defer l.Close()
+			}
+			for _, d := range tc.dirs {
+				require.NoError(t, os.MkdirAll(filepath.Join(root, d), 0755))
+			}
+			for _, f := range tc.files {
+				require.NoError(t, ioutil.WriteFile(filepath.Join(root, f), []byte{}, 0644))
+			}
+			if tc.containerdConfig != "" {
+				require.NoError(t, ioutil.WriteFile(p.containerdConfig, []byte(tc.containerdConfig), 0644))
+			}
+
+			runtime, err := detectRuntime(p)
+			if tc.expectedError {
+				require.Error(t, err)
+			} else {
+				require.NoError(t, err)
+			}
+			require.Equal(t, tc.expectedRuntime, runtime)
+		})
+	}
+}
@@ -0,0 +1,135 @@
+/**
+# Copyright (c) 2021, NVIDIA CORPORATION.  All rights reserved.
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#     http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"container-toolkit/pkg/runtime/docker"
+
+	log "github.com/sirupsen/logrus"
+	cli "github.com/urfave/cli/v2"
+)
+
+// newDockerCommand creates the 'docker' command for updating the docker config
+func newDockerCommand() *cli.Command {
+	options := docker.Options{}
+	renderOptions := renderOptions{}
+
+	// Create the 'setup' subcommand
+	setup := cli.Command{}
+	setup.Name = "setup"
+	setup.Usage = "Trigger docker config to be updated"
+	setup.ArgsUsage = "<runtime_dirname>"
+	setup.Action = func(c *cli.Context) error {
+		return setupDocker(c, &options)
+	}
+
+	// Create the 'cleanup' subcommand
+	cleanup := cli.Command{}
+	cleanup.Name = "cleanup"
+	cleanup.Usage = "Trigger any updates made to docker config to be undone"
+	cleanup.ArgsUsage = "<runtime_dirname>"
+	cleanup.Action = func(c *cli.Context) error {
+		return cleanupDocker(c, &options)
+	}
+
+	// Create the 'render' subcommand
+	render := cli.Command{}
+	render.Name = "render"
+	render.Usage = "Render an updated docker config to stdout without modifying any files or signalling docker"
+	render.ArgsUsage = "<runtime_dirname>"
+	render.Action = func(c *cli.Context) error {
+		return renderDocker(c, &options, &renderOptions)
+	}
+
+	// Setup common flags across both subcommands. All subcommands get the same
+	// set of flags even if they don't use some of them. This is so that we
+	// only require the user to specify one set of flags for both 'startup'
+	// and 'cleanup' to simplify things.
+	commonFlags := docker.Flags(&options)
+
+	// Update the subcommand flags with the common subcommand flags
+	setup.Flags = append([]cli.Flag{}, commonFlags...)
+	cleanup.Flags = append([]cli.Flag{}, commonFlags...)
+	render.Flags = append(append([]cli.Flag{}, commonFlags...), renderFlags("docker", &renderOptions)...)
+
+	// Create the 'docker' command
+	c := cli.Command{}
+	c.Name = "docker"
+	c.Usage = "Update docker config with the nvidia runtime"
+	c.Subcommands = []*cli.Command{
+		&setup,
+		&cleanup,
+		&render,
+	}
+
+	return &c
+}
+
+// setupDocker updates docker configuration to include the nvidia runtime and reloads it
+func setupDocker(c *cli.Context, o *docker.Options) error {
+	runtimeDir, err := parseDirArg(c)
+	if err != nil {
+		return fmt.Errorf("unable to parse args: %v", err)
+	}
+	o.RuntimeDir = runtimeDir
+
+	return docker.Setup(o)
+}
+
+// cleanupDocker reverts docker configuration to remove the nvidia runtime and reloads it
+func cleanupDocker(c *cli.Context, o *docker.Options) error {
+	_, err := parseDirArg(c)
+	if err != nil {
+		return fmt.Errorf("unable to parse args: %v", err)
+	}
+
+	return docker.Cleanup(o)
+}
+
+// renderDocker writes the docker config read from the specified input to
+// stdout with the nvidia runtimes added (or removed if --revert is specified).
+// No files are modified and docker is not signalled, allowing the command to
+// be used as a filter when building node images.
+func renderDocker(c *cli.Context, o *docker.Options, r *renderOptions) error {
+	log.Infof("Starting 'render' for docker")
+
+	runtimeDir, err := parseDirArg(c)
+	if err != nil {
+		return fmt.Errorf("unable to parse args: %v", err)
+	}
+	o.RuntimeDir = runtimeDir
+
+	input, err := readInput(r.input)
+	if err != nil {
+		return err
+	}
+
+	output, err := docker.RenderConfigContents(input, o, r.revert)
+	if err != nil {
+		return err
+	}
+
+	_, err = os.Stdout.Write(output)
+	if err != nil {
+		return fmt.Errorf("unable to write output: %v", err)
+	}
+
+	return nil
+}
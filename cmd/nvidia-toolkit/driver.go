@@ -0,0 +1,303 @@
+/**
+# Copyright (c) 2021, NVIDIA CORPORATION.  All rights reserved.
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#     http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+*/
+
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"container-toolkit/pkg/toolkit"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// The checks that determine whether the driver is ready. Only the library
+// check is used by default, since the toolkit is installed against the
+// libraries in the driver root, which may still be missing while the kernel
+// module is already loaded.
+const (
+	driverCheckLibrary = "library"
+	driverCheckModule  = "module"
+	driverCheckMarker  = "marker"
+
+	nvidiaKernelModule = "nvidia"
+)
+
+// procModules lists the loaded kernel modules
+var procModules = "/proc/modules"
+
+// parseDriverChecks validates the specified driver checks. At least one check
+// is required and the marker check requires a marker to be specified.
+func parseDriverChecks(checks []string, marker string) ([]string, error) {
+	if len(checks) == 0 {
+		return nil, fmt.Errorf("at least one driver check must be specified")
+	}
+	for _, check := range checks {
+		switch check {
+		case driverCheckLibrary, driverCheckModule:
+		case driverCheckMarker:
+			if marker == "" {
+				return nil, fmt.Errorf("the '%v' driver check requires --driver-marker", check)
+			}
+		default:
+			return nil, fmt.Errorf("unknown driver check: %v", check)
+		}
+	}
+	return checks, nil
+}
+
+// waitForDriver blocks until any of the specified checks passes for the
+// driver in the driver root of the toolkit. This is a no-op unless
+// --wait-for-driver is specified. The checks that have not passed yet are
+// logged along with the reasons whenever these change and are recorded in the
+// status. An error is returned if the driver is not ready within the wait
+// timeout or the context is cancelled.
+func waitForDriver(ctx context.Context, checks []string) error {
+	if !waitForDriverFlag {
+		return nil
+	}
+
+	log.Infof("Waiting for NVIDIA driver in '%v' (checks: %v)", toolkitOptions.DriverRoot, strings.Join(checks, ", "))
+
+	var timeout <-chan time.Time
+	if driverWaitTimeoutFlag > 0 {
+		timer := time.NewTimer(driverWaitTimeoutFlag)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	ticker := time.NewTicker(driverPollIntervalFlag)
+	defer ticker.Stop()
+
+	var previous []string
+	for {
+		pending := pendingDriverChecks(toolkitOptions, checks, driverMarkerFlag)
+		if len(pending) < len(checks) {
+			log.Infof("NVIDIA driver is ready")
+			currentStatus.setWaiting(nil)
+			return nil
+		}
+
+		if strings.Join(pending, "\n") != strings.Join(previous, "\n") {
+			log.Infof("Waiting for NVIDIA driver: %v", strings.Join(pending, "; "))
+			currentStatus.setWaiting(pending)
+			previous = pending
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-timeout:
+			return fmt.Errorf("NVIDIA driver is not ready after %v: %v", driverWaitTimeoutFlag, strings.Join(pending, "; "))
+		case <-ticker.C:
+		}
+	}
+}
+
+// pendingDriverChecks returns a description of each of the specified checks
+// that does not pass for the driver in the driver root of the specified
+// toolkit options
+func pendingDriverChecks(o *toolkit.Options, checks []string, marker string) []string {
+	var pending []string
+	for _, check := range checks {
+		switch check {
+		case driverCheckLibrary:
+			if _, err := toolkit.NewInstaller(*o).DriverLibrary(); err != nil {
+				pending = append(pending, fmt.Sprintf("%v: %v", check, err))
+			}
+		case driverCheckModule:
+			if loaded, err := isModuleLoaded(nvidiaKernelModule); !loaded {
+				reason := fmt.Sprintf("kernel module '%v' is not loaded", nvidiaKernelModule)
+				if err != nil {
+					reason = err.Error()
+				}
+				pending = append(pending, fmt.Sprintf("%v: %v", check, reason))
+			}
+		case driverCheckMarker:
+			if _, err := os.Stat(marker); err != nil {
+				pending = append(pending, fmt.Sprintf("%v: '%v' does not exist", check, marker))
+			}
+		}
+	}
+	return pending
+}
+
+// isModuleLoaded checks whether the kernel module with the specified name is
+// listed in /proc/modules
+func isModuleLoaded(name string) (bool, error) {
+	modules, err := os.Open(procModules)
+	if err != nil {
+		return false, fmt.Errorf("unable to read loaded modules: %v", err)
+	}
+	defer modules.Close()
+
+	scanner := bufio.NewScanner(modules)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) > 0 && fields[0] == name {
+			return true, nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return false, fmt.Errorf("unable to read loaded modules: %v", err)
+	}
+	return false, nil
+}
+
+// driverState describes the NVIDIA driver installation that the files of the
+// installed toolkit were generated for
+type driverState struct {
+	// library is the resolved path of the NVIDIA management library in the
+	// driver root, which is empty if the library is not found
+	library string
+	// marker is the modification time of the driver marker file, which is
+	// the zero time if no marker is specified or it does not exist
+	marker time.Time
+}
+
+// driverWatcher detects when the NVIDIA driver is reinstalled (e.g. by an
+// upgraded driver container) and regenerates the files of the toolkit that
+// depend on the driver root. Since the driver root is typically a mount that
+// is replaced along with the driver container, its state is polled. A marker
+// file, if specified, is watched for changes in addition.
+type driverWatcher struct {
+	ticker *time.Ticker
+	marker *watcher
+	state  driverState
+}
+
+// startDriverWatch starts watching the driver root of the installed toolkit.
+// If watching is disabled or the toolkit is installed in dry-run mode, nil is
+// returned.
+func startDriverWatch() *driverWatcher {
+	if !watchDriverFlag || toolkitOptions.DryRun {
+		return nil
+	}
+
+	log.Infof("Watching driver root %v for changes", toolkitOptions.DriverRoot)
+
+	d := &driverWatcher{
+		ticker: time.NewTicker(driverWatchIntervalFlag),
+		state:  readDriverState(toolkitOptions, driverMarkerFlag),
+	}
+
+	if driverMarkerFlag != "" {
+		marker, err := newWatcher([]string{driverMarkerFlag})
+		if err != nil {
+			log.Warnf("Unable to watch driver marker; relying on polling: %v", err)
+		}
+		d.marker = marker
+	}
+
+	return d
+}
+
+// ticks returns the channel on which the times to poll the driver root are
+// delivered
+func (d *driverWatcher) ticks() <-chan time.Time {
+	if d == nil {
+		return nil
+	}
+	return d.ticker.C
+}
+
+// markerChanges returns the channel on which changes to the driver marker are
+// reported
+func (d *driverWatcher) markerChanges() <-chan string {
+	if d == nil {
+		return nil
+	}
+	return d.marker.changes()
+}
+
+// stop stops watching the driver root
+func (d *driverWatcher) stop() {
+	if d == nil {
+		return
+	}
+	d.ticker.Stop()
+	d.marker.close()
+}
+
+// check regenerates the driver dependent files of the toolkit if the driver
+// changed since the last check. The return value indicates whether the files
+// were regenerated. If this fails, the check is repeated on the next poll.
+func (d *driverWatcher) check() (bool, error) {
+	current := readDriverState(toolkitOptions, driverMarkerFlag)
+	if current == d.state {
+		return false, nil
+	}
+
+	log.Infof("NVIDIA driver changed (library: '%v' -> '%v', marker: %v -> %v)",
+		d.state.library, current.library, formatTime(d.state.marker), formatTime(current.marker))
+
+	err := toolkit.NewInstaller(*toolkitOptions).Regenerate()
+	if err != nil {
+		return false, fmt.Errorf("unable to regenerate toolkit files: %v", err)
+	}
+
+	d.state = current
+	return true, nil
+}
+
+// readDriverState reads the state of the driver in the driver root of the
+// specified toolkit options
+func readDriverState(o *toolkit.Options, marker string) driverState {
+	var s driverState
+
+	library, err := toolkit.NewInstaller(*o).DriverLibrary()
+	if err == nil {
+		s.library = library
+	}
+
+	if marker != "" {
+		if info, err := os.Stat(marker); err == nil {
+			s.marker = info.ModTime()
+		}
+	}
+
+	return s
+}
+
+// checkDriver checks the driver watched by the specified watcher for changes
+// and records the outcome in the status and metrics
+func checkDriver(d *driverWatcher) {
+	start := time.Now()
+	regenerated, err := d.check()
+	if !regenerated && err == nil {
+		return
+	}
+
+	currentMetrics.observe(operationRegenerate, "", start, err)
+	if err != nil {
+		log.Errorf("Unable to update toolkit for changed driver: %v", err)
+		currentStatus.setError(err)
+		return
+	}
+	currentStatus.setRegenerated()
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return "none"
+	}
+	return t.UTC().Format(time.RFC3339Nano)
+}
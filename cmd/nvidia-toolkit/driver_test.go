@@ -0,0 +1,203 @@
+/**
+# Copyright (c) 2021, NVIDIA CORPORATION.  All rights reserved.
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#     http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"container-toolkit/pkg/toolkit"
+
+	"github.com/stretchr/testify/require"
+	cli "github.com/urfave/cli/v2"
+)
+
+func TestDriverWatcher(t *testing.T) {
+	dir, err := ioutil.TempDir("", "nvidia-toolkit-test-")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	sourceConfig := filepath.Join(dir, "config.toml")
+	require.NoError(t, ioutil.WriteFile(sourceConfig, []byte("[nvidia-container-cli]\nldconfig = \"@/sbin/ldconfig\"\n"), 0644))
+
+	toolkitDir := filepath.Join(dir, "toolkit")
+	toolkitConfig := filepath.Join(toolkitDir, ".config", "nvidia-container-runtime", "config.toml")
+	require.NoError(t, os.MkdirAll(filepath.Dir(toolkitConfig), 0755))
+
+	driverRoot := filepath.Join(dir, "driver")
+	marker := filepath.Join(dir, "validations", "driver-ready")
+	require.NoError(t, os.MkdirAll(filepath.Dir(marker), 0755))
+
+	toolkitOptions = &toolkit.Options{
+		ToolkitDir: toolkitDir,
+		DriverRoot: driverRoot,
+		Sources:    toolkit.Sources{Config: sourceConfig},
+	}
+	watchDriverFlag = true
+	driverMarkerFlag = marker
+	driverWatchIntervalFlag = time.Hour
+	defer func() {
+		watchDriverFlag = false
+		driverMarkerFlag = ""
+		driverWatchIntervalFlag = defaultDriverInterval
+	}()
+
+	d := startDriverWatch()
+	require.NotNil(t, d)
+	defer d.stop()
+
+	regenerated, err := d.check()
+	require.NoError(t, err)
+	require.False(t, regenerated)
+	require.NoFileExists(t, toolkitConfig)
+
+	// Creating the marker is reported and results in the files being
+	// regenerated
+	require.NoError(t, ioutil.WriteFile(marker, nil, 0644))
+	select {
+	case path := <-d.markerChanges():
+		require.Equal(t, marker, path)
+	case <-time.After(time.Second):
+		require.Fail(t, "change to marker was not reported")
+	}
+
+	regenerated, err = d.check()
+	require.NoError(t, err)
+	require.True(t, regenerated)
+	require.FileExists(t, toolkitConfig)
+
+	regenerated, err = d.check()
+	require.NoError(t, err)
+	require.False(t, regenerated)
+
+	// Installing a driver results in the files being regenerated
+	libraryRoot := filepath.Join(driverRoot, "usr", "lib64")
+	require.NoError(t, os.MkdirAll(libraryRoot, 0755))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(libraryRoot, "libnvidia-ml.so"), nil, 0644))
+
+	regenerated, err = d.check()
+	require.NoError(t, err)
+	require.True(t, regenerated)
+}
+
+func TestStartDriverWatchDisabled(t *testing.T) {
+	toolkitOptions = &toolkit.Options{}
+	watchDriverFlag = false
+
+	d := startDriverWatch()
+	require.Nil(t, d)
+	require.Nil(t, d.ticks())
+	require.Nil(t, d.markerChanges())
+	d.stop()
+}
+
+func TestParseDriverChecks(t *testing.T) {
+	testCases := []struct {
+		checks      []string
+		marker      string
+		expectedErr bool
+	}{
+		{checks: []string{"library", "module"}},
+		{checks: []string{"marker"}, marker: "/run/nvidia/validations/driver-ready"},
+		{checks: []string{"marker"}, expectedErr: true},
+		{checks: []string{"unknown"}, expectedErr: true},
+		{checks: []string{}, expectedErr: true},
+	}
+
+	for i, tc := range testCases {
+		checks, err := parseDriverChecks(tc.checks, tc.marker)
+		if tc.expectedErr {
+			require.Error(t, err, "%d: %v", i, tc)
+			continue
+		}
+		require.NoError(t, err, "%d: %v", i, tc)
+		require.Equal(t, tc.checks, checks, "%d: %v", i, tc)
+	}
+}
+
+func TestWaitForDriver(t *testing.T) {
+	dir, err := ioutil.TempDir("", "nvidia-toolkit-test-")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	driverRoot := filepath.Join(dir, "driver")
+	marker := filepath.Join(dir, "driver-ready")
+
+	procModules = filepath.Join(dir, "modules")
+	require.NoError(t, ioutil.WriteFile(procModules, []byte("nvidia_uvm 1 0 - Live 0x0\n"), 0644))
+
+	toolkitOptions = &toolkit.Options{DriverRoot: driverRoot}
+	currentStatus = newStatus()
+	waitForDriverFlag = true
+	driverWaitTimeoutFlag = 50 * time.Millisecond
+	driverPollIntervalFlag = 10 * time.Millisecond
+	defer func() {
+		procModules = "/proc/modules"
+		waitForDriverFlag = false
+		driverWaitTimeoutFlag = defaultDriverTimeout
+		driverPollIntervalFlag = defaultDriverPoll
+	}()
+
+	checks := []string{driverCheckLibrary, driverCheckModule, driverCheckMarker}
+
+	err = waitForDriver(context.Background(), checks)
+	require.Error(t, err)
+	require.Equal(t, phaseWaiting, currentStatus.Phase)
+	require.Len(t, currentStatus.WaitingFor, 3)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	require.Equal(t, context.Canceled, waitForDriver(ctx, checks))
+
+	// The driver becomes ready while waiting once any of the checks passes
+	driverWaitTimeoutFlag = 0
+	driverMarkerFlag = marker
+	defer func() { driverMarkerFlag = "" }()
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		ioutil.WriteFile(marker, nil, 0644)
+	}()
+
+	require.NoError(t, waitForDriver(context.Background(), checks))
+	require.Empty(t, currentStatus.WaitingFor)
+
+	// The driver is ready if only the kernel module is loaded
+	driverWaitTimeoutFlag = 50 * time.Millisecond
+	require.NoError(t, os.Remove(marker))
+	require.NoError(t, ioutil.WriteFile(procModules, []byte("nvidia_uvm 1 0 - Live 0x0\nnvidia 2 1 nvidia_uvm, Live 0x0\n"), 0644))
+	require.NoError(t, waitForDriver(context.Background(), checks))
+
+	// With the default checks, the driver is not ready while the kernel
+	// module is loaded but the libraries are missing
+	var defaultChecks []string
+	for _, flag := range newApp().Flags {
+		if f, ok := flag.(*cli.StringSliceFlag); ok && f.Name == "driver-ready-checks" {
+			defaultChecks = f.Value.Value()
+		}
+	}
+	require.Equal(t, []string{driverCheckLibrary}, defaultChecks)
+	require.Error(t, waitForDriver(context.Background(), defaultChecks))
+	require.Len(t, currentStatus.WaitingFor, 1)
+
+	// Waiting is disabled by default
+	waitForDriverFlag = false
+	require.NoError(t, waitForDriver(context.Background(), checks))
+}
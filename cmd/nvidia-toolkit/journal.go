@@ -0,0 +1,338 @@
+/**
+# Copyright (c) 2021, NVIDIA CORPORATION.  All rights reserved.
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#     http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"container-toolkit/internal/atomicfile"
+	"container-toolkit/internal/journal"
+	"container-toolkit/pkg/config/engine"
+	containerdengine "container-toolkit/pkg/config/engine/containerd"
+	dockerengine "container-toolkit/pkg/config/engine/docker"
+	"container-toolkit/pkg/toolkit"
+
+	log "github.com/sirupsen/logrus"
+	cli "github.com/urfave/cli/v2"
+)
+
+const (
+	cleanupCommand     = "cleanup"
+	defaultJournalFile = runDir + "/toolkit.journal"
+)
+
+// journalFlag returns the flag specifying the path of the journal
+func journalFlag(path *string) cli.Flag {
+	return &cli.StringFlag{
+		Name:        "journal",
+		Usage:       "the file in which the changes made to the host are recorded so that these can be undone by the 'cleanup' command, even after a crash. Specify a path on a persistent filesystem for the record to survive a reboot",
+		Value:       defaultJournalFile,
+		Destination: path,
+		EnvVars:     []string{"JOURNAL_FILE"},
+	}
+}
+
+// newCleanupCommand creates the command that undoes the changes recorded in
+// the journal
+func newCleanupCommand() *cli.Command {
+	var journalFile string
+
+	return &cli.Command{
+		Name:      cleanupCommand,
+		Usage:     "Undo the changes recorded in the journal in reverse order, independent of the flags they were made with",
+		ArgsUsage: " ",
+		Action: func(c *cli.Context) error {
+			if c.NArg() > 0 {
+				return fmt.Errorf("unexpected arguments: %v", c.Args().Slice())
+			}
+			return replayJournal(journal.New(journalFile, Version))
+		},
+		Flags: []cli.Flag{journalFlag(&journalFile)},
+	}
+}
+
+// journalToolkit records the installation of the toolkit in the journal
+func journalToolkit(j *journal.Journal, o *toolkit.Options) error {
+	return j.Append(journal.Entry{Op: journal.OpInstallToolkit, Path: o.ToolkitDir})
+}
+
+// journalRuntime records the setup of the specified runtime in the journal.
+// This is recorded before the changes made by the setup, which are recorded
+// as these are made, so that the runtime is reloaded once these are undone.
+func journalRuntime(j *journal.Journal, r *runtime) error {
+	e, err := runtimeEntry(r)
+	if err != nil {
+		return err
+	}
+	return j.Append(e)
+}
+
+// runtimeEntry returns the journal entry recording the setup of the specified
+// runtime along with its options
+func runtimeEntry(r *runtime) (journal.Entry, error) {
+	options, err := json.Marshal(r.options)
+	if err != nil {
+		return journal.Entry{}, fmt.Errorf("unable to encode %v options: %v", r.target.name, err)
+	}
+	return journal.Entry{Op: journal.OpSetupRuntime, Runtime: r.target.name, Options: options}, nil
+}
+
+// rewriteJournal removes the setups of runtimes other than the specified
+// runtimes from the journal, along with the changes recorded for these, since
+// these runtimes were cleaned up. A setup that is applied again is merged into
+// the first setup of the runtime, so that replaying the journal restores the
+// files as these were before the first setup. Duplicate toolkit installations
+// are also removed.
+func rewriteJournal(j *journal.Journal, targets []*runtime) error {
+	existing, err := j.Load()
+	if err != nil {
+		return err
+	}
+
+	keys := make(map[string]bool)
+	for _, r := range targets {
+		keys[r.key()] = true
+	}
+
+	var entries []journal.Entry
+	installed := make(map[string]bool)
+	// setups holds the index of the first setup of each runtime
+	setups := make(map[string]int)
+	// The changes following the setup of a runtime belong to that setup. If
+	// the setup is merged, first is the index of the setup it is merged into.
+	keep, first := true, -1
+	for _, e := range existing {
+		switch e.Op {
+		case journal.OpInstallToolkit:
+			keep, first = !installed[e.Path], -1
+			installed[e.Path] = true
+		case journal.OpSetupRuntime:
+			key := e.Runtime + " " + string(e.Options)
+			keep, first = keys[key], -1
+			if i, ok := setups[key]; ok && keep {
+				first = i
+				continue
+			}
+			setups[key] = len(entries)
+		default:
+			if keep && first >= 0 {
+				entries = mergeChange(entries, first, e)
+				continue
+			}
+		}
+		if keep {
+			entries = append(entries, e)
+		}
+	}
+
+	return j.Replace(entries)
+}
+
+// mergeChange merges a change made by a setup that was applied again into the
+// changes of the first setup at the specified index. A file written by both
+// setups is restored to its contents before the first setup, provided it was
+// not modified since the last write. Other changes that were made again only
+// restore what was removed after the first setup, and are dropped.
+func mergeChange(entries []journal.Entry, setup int, e journal.Entry) []journal.Entry {
+	if e.Op != journal.OpWriteFile {
+		return entries
+	}
+
+	end := setup + 1
+	for ; end < len(entries); end++ {
+		op := entries[end].Op
+		if op == journal.OpSetupRuntime || op == journal.OpInstallToolkit {
+			break
+		}
+		if op == journal.OpWriteFile && entries[end].Path == e.Path {
+			entries[end].Committed = e.Committed
+			entries[end].Checksum = e.Checksum
+			return entries
+		}
+	}
+
+	entries = append(entries, journal.Entry{})
+	copy(entries[end+1:], entries[end:])
+	entries[end] = e
+	return entries
+}
+
+// replayJournal undoes the changes recorded in the journal in reverse order.
+// Entries that cannot be undone are kept in the journal so that the cleanup
+// can be retried; all other entries are removed.
+func replayJournal(j *journal.Journal) error {
+	entries, err := j.Load()
+	if err != nil {
+		return err
+	}
+	if len(entries) == 0 {
+		log.Infof("No changes recorded in journal '%v'", j.Path())
+		return nil
+	}
+
+	log.Infof("Undoing %v changes recorded in journal '%v'", len(entries), j.Path())
+
+	var failed []journal.Entry
+	for i := len(entries) - 1; i >= 0; i-- {
+		e := entries[i]
+		err := undoEntry(e)
+		if err != nil {
+			log.Errorf("Unable to undo %v: %v", e, err)
+			failed = append([]journal.Entry{e}, failed...)
+		}
+	}
+
+	err = j.Replace(failed)
+	if err != nil {
+		return err
+	}
+
+	if len(failed) > 0 {
+		return fmt.Errorf("unable to undo %v of %v changes recorded in journal '%v'", len(failed), len(entries), j.Path())
+	}
+	return nil
+}
+
+// undoEntry undoes the change recorded in the specified journal entry
+func undoEntry(e journal.Entry) error {
+	switch e.Op {
+	case journal.OpInstallToolkit:
+		log.Infof("Deleting toolkit installed by version %v", e.Version)
+		return toolkit.NewInstaller(toolkit.Options{ToolkitDir: e.Path}).Delete()
+	case journal.OpSetupRuntime:
+		log.Infof("Reloading %v set up by version %v", e.Runtime, e.Version)
+		r, err := newJournaledRuntime(e.Runtime, e.Options)
+		if err != nil {
+			return err
+		}
+		return r.reload()
+	case journal.OpWriteFile:
+		return undoWriteFile(e)
+	case journal.OpCreateDir:
+		return undoCreateDir(e)
+	case journal.OpAddRuntime, journal.OpSetDefaultRuntime:
+		return undoRuntimeChange(e)
+	case journal.OpCreateHook:
+		log.Infof("Removing hook %v", e.Path)
+		err := os.Remove(e.Path)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown operation '%v'", e.Op)
+	}
+}
+
+// undoWriteFile restores the previous contents of a file, or removes the file
+// if it did not exist. A file that was modified after the write was committed
+// is left as is; the runtimes added to it are removed by the entries recorded
+// before the write instead.
+func undoWriteFile(e journal.Entry) error {
+	if e.Committed {
+		checksum, err := journal.Checksum(e.Path)
+		if err != nil {
+			return err
+		}
+		if checksum != e.Checksum {
+			log.Infof("Not restoring %v, which was modified since it was written", e.Path)
+			return nil
+		}
+	}
+
+	if e.Backup == nil {
+		log.Infof("Removing %v", e.Path)
+		err := os.Remove(e.Path)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+
+	log.Infof("Restoring %v", e.Path)
+	return atomicfile.WriteFile(e.Path, e.Backup.Contents, e.Backup.Mode)
+}
+
+// undoCreateDir removes a directory that was created. A directory that is not
+// empty is left as is, since it contains files that were not created by the
+// toolkit.
+func undoCreateDir(e journal.Entry) error {
+	entries, err := ioutil.ReadDir(e.Path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if len(entries) > 0 {
+		log.Infof("Not removing directory %v, which is not empty", e.Path)
+		return nil
+	}
+
+	log.Infof("Removing directory %v", e.Path)
+	return os.Remove(e.Path)
+}
+
+// undoRuntimeChange removes a runtime that was added to the config of a
+// runtime, or restores the default runtime that was replaced. The change is
+// only undone if it is still in effect.
+func undoRuntimeChange(e journal.Entry) error {
+	if _, err := os.Stat(e.Path); os.IsNotExist(err) {
+		return nil
+	}
+
+	var c engine.Interface
+	var err error
+	switch e.Runtime {
+	case "docker":
+		c, err = dockerengine.Load(e.Path)
+	case "containerd":
+		c, err = containerdengine.Load(e.Path, false)
+	default:
+		return fmt.Errorf("unknown runtime: %v", e.Runtime)
+	}
+	if err != nil {
+		return fmt.Errorf("unable to load config: %v", err)
+	}
+
+	switch e.Op {
+	case journal.OpAddRuntime:
+		if !c.HasRuntime(e.Name) {
+			return nil
+		}
+		log.Infof("Removing runtime %v from %v", e.Name, e.Path)
+		err = c.RemoveRuntime(e.Name)
+	case journal.OpSetDefaultRuntime:
+		if c.DefaultRuntime() != e.Name {
+			return nil
+		}
+		log.Infof("Restoring default runtime in %v", e.Path)
+		if e.Previous != "" {
+			err = c.SetDefaultRuntime(e.Previous)
+		} else {
+			err = c.UnsetDefaultRuntime()
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	return c.Save(e.Path)
+}
@@ -0,0 +1,127 @@
+/**
+# Copyright (c) 2021, NVIDIA CORPORATION.  All rights reserved.
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#     http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"container-toolkit/internal/journal"
+	"container-toolkit/internal/transaction"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestReplayJournal(t *testing.T) {
+	dir, err := ioutil.TempDir("", "nvidia-toolkit-test-")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	toolkitDir := filepath.Join(dir, "toolkit")
+	hooksDir := filepath.Join(dir, "hooks.d")
+	require.NoError(t, os.MkdirAll(toolkitDir, 0755))
+
+	j := journal.New(filepath.Join(dir, "toolkit.journal"), "1.2.3")
+	require.NoError(t, j.Append(journal.Entry{Op: journal.OpInstallToolkit, Path: toolkitDir}))
+
+	r, err := newRuntime(runtimeTarget{name: "crio", args: "--hooks-dir=" + hooksDir}, toolkitDir)
+	require.NoError(t, err)
+	require.NoError(t, journalRuntime(j, r))
+
+	tx := transaction.New()
+	tx.SetJournal(j)
+	require.NoError(t, r.setup(context.Background(), tx))
+	require.NoError(t, tx.Commit())
+
+	hookPath := filepath.Join(hooksDir, "oci-nvidia-hook.json")
+	require.FileExists(t, hookPath)
+
+	entries, err := j.Load()
+	require.NoError(t, err)
+
+	var ops []string
+	for _, e := range entries {
+		ops = append(ops, e.Op)
+	}
+	expectedOps := []string{
+		journal.OpInstallToolkit,
+		journal.OpSetupRuntime,
+		journal.OpCreateDir,
+		journal.OpCreateHook,
+		journal.OpWriteFile,
+		journal.OpWriteFile,
+	}
+	require.Equal(t, expectedOps, ops)
+	require.Equal(t, hookPath, entries[5].Path)
+	require.True(t, entries[5].Committed)
+
+	// The cleanup does not depend on the flags of the current process
+	require.NoError(t, os.Setenv("CRIO_HOOKS_DIR", filepath.Join(dir, "other")))
+	defer os.Unsetenv("CRIO_HOOKS_DIR")
+
+	require.NoError(t, replayJournal(j))
+	require.NoFileExists(t, hookPath)
+	require.NoDirExists(t, hooksDir)
+	require.NoDirExists(t, toolkitDir)
+	require.NoFileExists(t, j.Path())
+}
+
+func TestReplayModifiedConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "nvidia-toolkit-test-")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	config := filepath.Join(dir, "daemon.json")
+	original := []byte(`{"default-runtime": "runc"}`)
+	written := []byte(`{"default-runtime": "nvidia", "runtimes": {"nvidia": {"path": "nvidia-container-runtime"}}}`)
+	modified := []byte(`{"default-runtime": "nvidia", "debug": true, "runtimes": {"nvidia": {"path": "nvidia-container-runtime"}}}`)
+
+	require.NoError(t, ioutil.WriteFile(config, written, 0644))
+	checksum, err := journal.Checksum(config)
+	require.NoError(t, err)
+
+	j := journal.New(filepath.Join(dir, "toolkit.journal"), "1.2.3")
+	require.NoError(t, j.Append(
+		journal.Entry{Op: journal.OpAddRuntime, Runtime: "docker", Path: config, Name: "nvidia"},
+		journal.Entry{Op: journal.OpSetDefaultRuntime, Runtime: "docker", Path: config, Name: "nvidia", Previous: "runc"},
+		journal.Entry{Op: journal.OpWriteFile, Path: config, Backup: &journal.Backup{Contents: original, Mode: 0644}, Committed: true, Checksum: checksum},
+	))
+
+	// A config that is unchanged since it was written is restored
+	require.NoError(t, replayJournal(j))
+	contents, err := ioutil.ReadFile(config)
+	require.NoError(t, err)
+	require.Equal(t, original, contents)
+
+	// A config that was modified since it was written is kept, but the
+	// runtime that was added and the default runtime are reverted
+	require.NoError(t, ioutil.WriteFile(config, modified, 0644))
+	require.NoError(t, j.Append(
+		journal.Entry{Op: journal.OpAddRuntime, Runtime: "docker", Path: config, Name: "nvidia"},
+		journal.Entry{Op: journal.OpSetDefaultRuntime, Runtime: "docker", Path: config, Name: "nvidia", Previous: "runc"},
+		journal.Entry{Op: journal.OpWriteFile, Path: config, Backup: &journal.Backup{Contents: original, Mode: 0644}, Committed: true, Checksum: checksum},
+	))
+
+	require.NoError(t, replayJournal(j))
+	contents, err = ioutil.ReadFile(config)
+	require.NoError(t, err)
+	require.JSONEq(t, `{"default-runtime": "runc", "debug": true}`, string(contents))
+	require.NoFileExists(t, j.Path())
+}
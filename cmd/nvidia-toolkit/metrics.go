@@ -0,0 +1,299 @@
+/**
+# Copyright (c) 2021, NVIDIA CORPORATION.  All rights reserved.
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#     http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"container-toolkit/pkg/toolkit"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// The operations for which metrics are recorded
+const (
+	operationInstall    = "install"
+	operationSetup      = "setup"
+	operationReload     = "reload"
+	operationReconcile  = "reconcile"
+	operationRegenerate = "regenerate"
+	operationCleanup    = "cleanup"
+)
+
+// durationBuckets are the upper bounds in seconds of the buckets of the
+// operation duration histograms
+var durationBuckets = []float64{0.1, 0.5, 1, 2.5, 5, 10, 30, 60, 120}
+
+// operationKey identifies the operation for which metrics are recorded. The
+// runtime is empty for operations that do not apply to a single runtime.
+type operationKey struct {
+	operation string
+	runtime   string
+}
+
+// histogram is a cumulative histogram of durations
+type histogram struct {
+	buckets []uint64
+	count   uint64
+	sum     float64
+}
+
+// metrics records the outcome of the operations of the nvidia-toolkit daemon
+// and exposes these in the Prometheus text format. It is safe for concurrent
+// use.
+type metrics struct {
+	mu         sync.Mutex
+	successes  map[operationKey]uint64
+	failures   map[operationKey]uint64
+	durations  map[operationKey]*histogram
+	components map[string]string
+}
+
+// currentMetrics are the metrics of the running daemon
+var currentMetrics = newMetrics()
+
+func newMetrics() *metrics {
+	return &metrics{
+		successes:  make(map[operationKey]uint64),
+		failures:   make(map[operationKey]uint64),
+		durations:  make(map[operationKey]*histogram),
+		components: make(map[string]string),
+	}
+}
+
+// observe records the outcome of an operation that started at the specified
+// time. An operation is considered to have failed if err is not nil.
+func (m *metrics) observe(operation string, runtime string, start time.Time, err error) {
+	key := operationKey{operation: operation, runtime: runtime}
+	duration := time.Since(start).Seconds()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err != nil {
+		m.failures[key]++
+	} else {
+		m.successes[key]++
+	}
+
+	h, exists := m.durations[key]
+	if !exists {
+		h = &histogram{buckets: make([]uint64, len(durationBuckets))}
+		m.durations[key] = h
+	}
+	for i, bound := range durationBuckets {
+		if duration <= bound {
+			h.buckets[i]++
+		}
+	}
+	h.count++
+	h.sum += duration
+}
+
+// setComponents records the versions of the installed toolkit components.
+// Components that are not installed are not recorded; the version of
+// components for which it cannot be determined is reported as 'unknown'.
+func (m *metrics) setComponents(components []toolkit.Component) {
+	versions := make(map[string]string)
+	for _, c := range components {
+		if !c.Installed {
+			continue
+		}
+		version, err := c.Version()
+		if err != nil {
+			log.Debugf("Unable to determine version of %v: %v", c.Name, err)
+			version = "unknown"
+		}
+		versions[c.Name] = version
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.components = versions
+}
+
+// handler returns the HTTP handler serving the metrics. The configured
+// runtimes are read from the specified status.
+func (m *metrics) handler(s *status) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var buf bytes.Buffer
+		m.write(&buf, s)
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		w.Write(buf.Bytes())
+	})
+}
+
+// write writes the metrics in the Prometheus text format
+func (m *metrics) write(w io.Writer, s *status) {
+	// The configs of the runtimes are loaded without holding the lock of the
+	// status, so that a slow config does not block its other users
+	s.mu.Lock()
+	runtimes := append([]runtimeStatus(nil), s.Runtimes...)
+	s.mu.Unlock()
+
+	samples := runtimeSamples(runtimes)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	writeHeader(w, "nvidia_toolkit_build_info", "gauge", "The version of nvidia-toolkit")
+	writeSample(w, "nvidia_toolkit_build_info", labels{"version", Version}, 1)
+
+	writeHeader(w, "nvidia_toolkit_component_info", "gauge", "The version of each installed toolkit component")
+	for _, name := range sortedKeys(m.components) {
+		writeSample(w, "nvidia_toolkit_component_info", labels{"component", name, "version", m.components[name]}, 1)
+	}
+
+	keys := m.operationKeys()
+
+	writeHeader(w, "nvidia_toolkit_operations_total", "counter", "The number of install, setup, reload, reconcile, regenerate and cleanup operations by result")
+	for _, key := range keys {
+		writeSample(w, "nvidia_toolkit_operations_total", key.labels("result", "success"), float64(m.successes[key]))
+		writeSample(w, "nvidia_toolkit_operations_total", key.labels("result", "failure"), float64(m.failures[key]))
+	}
+
+	writeHeader(w, "nvidia_toolkit_operation_duration_seconds", "histogram", "The duration of install, setup, reload, reconcile, regenerate and cleanup operations")
+	for _, key := range keys {
+		h := m.durations[key]
+		for i, bound := range durationBuckets {
+			writeSample(w, "nvidia_toolkit_operation_duration_seconds_bucket", key.labels("le", fmt.Sprint(bound)), float64(h.buckets[i]))
+		}
+		writeSample(w, "nvidia_toolkit_operation_duration_seconds_bucket", key.labels("le", "+Inf"), float64(h.count))
+		writeSample(w, "nvidia_toolkit_operation_duration_seconds_sum", key.labels(), h.sum)
+		writeSample(w, "nvidia_toolkit_operation_duration_seconds_count", key.labels(), float64(h.count))
+	}
+
+	writeHeader(w, "nvidia_toolkit_runtime_configured", "gauge", "Whether an nvidia runtime of a runtime target is configured in its current config")
+	for _, sample := range samples {
+		writeSample(w, "nvidia_toolkit_runtime_configured", sample.labels, boolValue(sample.configured))
+	}
+
+	writeHeader(w, "nvidia_toolkit_runtime_default", "gauge", "Whether an nvidia runtime of a runtime target is the default runtime in its current config")
+	for _, sample := range samples {
+		writeSample(w, "nvidia_toolkit_runtime_default", sample.labels, boolValue(sample.isDefault))
+	}
+}
+
+// runtimeSample holds the state of an nvidia runtime of a runtime target in
+// the current config of the target
+type runtimeSample struct {
+	labels     labels
+	configured bool
+	isDefault  bool
+}
+
+// runtimeSamples loads the current configs of the specified runtime targets
+// and returns whether each of their nvidia runtimes is configured and set as
+// the default runtime. If a config cannot be loaded, its runtimes are reported
+// as not configured.
+func runtimeSamples(runtimes []runtimeStatus) []runtimeSample {
+	var samples []runtimeSample
+	for _, r := range runtimes {
+		if r.loadRuntimes == nil {
+			continue
+		}
+
+		cfg, names, err := r.loadRuntimes()
+		if err != nil {
+			log.Warnf("Unable to load config of runtime %v: %v", r.Target, err)
+		}
+
+		for _, name := range names {
+			sample := runtimeSample{labels: labels{"target", r.Target, "runtime", r.Runtime, "config", r.Config, "name", name}}
+			if err == nil {
+				sample.configured = cfg.HasRuntime(name)
+				sample.isDefault = sample.configured && cfg.DefaultRuntime() == name
+			}
+			samples = append(samples, sample)
+		}
+	}
+	return samples
+}
+
+// operationKeys returns the keys of the recorded operations in a stable order
+func (m *metrics) operationKeys() []operationKey {
+	var keys []operationKey
+	for key := range m.durations {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].operation != keys[j].operation {
+			return keys[i].operation < keys[j].operation
+		}
+		return keys[i].runtime < keys[j].runtime
+	})
+	return keys
+}
+
+// labels returns the labels for the operation followed by the specified
+// additional labels
+func (k operationKey) labels(extra ...string) labels {
+	return append(labels{"operation", k.operation, "runtime", k.runtime}, extra...)
+}
+
+// labels holds alternating label names and values
+type labels []string
+
+func (l labels) String() string {
+	if len(l) == 0 {
+		return ""
+	}
+
+	var pairs []string
+	for i := 0; i+1 < len(l); i += 2 {
+		pairs = append(pairs, fmt.Sprintf("%v=\"%v\"", l[i], escapeLabelValue(l[i+1])))
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+// escapeLabelValue escapes a label value as required by the Prometheus text
+// format
+func escapeLabelValue(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+}
+
+func writeHeader(w io.Writer, name string, kind string, help string) {
+	fmt.Fprintf(w, "# HELP %v %v\n", name, help)
+	fmt.Fprintf(w, "# TYPE %v %v\n", name, kind)
+}
+
+func writeSample(w io.Writer, name string, l labels, value float64) {
+	fmt.Fprintf(w, "%v%v %v\n", name, l, value)
+}
+
+func boolValue(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func sortedKeys(m map[string]string) []string {
+	var keys []string
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
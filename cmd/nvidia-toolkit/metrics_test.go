@@ -0,0 +1,150 @@
+/**
+# Copyright (c) 2021, NVIDIA CORPORATION.  All rights reserved.
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#     http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"container-toolkit/pkg/toolkit"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMetricsObserve(t *testing.T) {
+	m := newMetrics()
+
+	start := time.Now().Add(-2 * time.Second)
+	m.observe(operationSetup, "docker", start, nil)
+	m.observe(operationSetup, "docker", start, fmt.Errorf("test error"))
+	m.observe(operationInstall, "", time.Now(), nil)
+
+	var buf bytes.Buffer
+	m.write(&buf, newStatus())
+	output := buf.String()
+
+	expectedLines := []string{
+		`nvidia_toolkit_operations_total{operation="setup",runtime="docker",result="success"} 1`,
+		`nvidia_toolkit_operations_total{operation="setup",runtime="docker",result="failure"} 1`,
+		`nvidia_toolkit_operations_total{operation="install",runtime="",result="success"} 1`,
+		`nvidia_toolkit_operations_total{operation="install",runtime="",result="failure"} 0`,
+		`nvidia_toolkit_operation_duration_seconds_bucket{operation="setup",runtime="docker",le="1"} 0`,
+		`nvidia_toolkit_operation_duration_seconds_bucket{operation="setup",runtime="docker",le="2.5"} 2`,
+		`nvidia_toolkit_operation_duration_seconds_bucket{operation="setup",runtime="docker",le="+Inf"} 2`,
+		`nvidia_toolkit_operation_duration_seconds_count{operation="setup",runtime="docker"} 2`,
+		`nvidia_toolkit_operation_duration_seconds_bucket{operation="install",runtime="",le="0.1"} 1`,
+		`# TYPE nvidia_toolkit_operation_duration_seconds histogram`,
+	}
+	for _, line := range expectedLines {
+		require.Contains(t, output, line+"\n")
+	}
+	require.NotContains(t, output, "nvidia_toolkit_component_info{")
+}
+
+func TestMetricsRuntimes(t *testing.T) {
+	dir, err := ioutil.TempDir("", "nvidia-toolkit-metrics-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	config := filepath.Join(dir, "daemon.json")
+	err = ioutil.WriteFile(config, []byte(`{"default-runtime": "nvidia", "runtimes": {"nvidia": {"path": "/toolkit/dir/nvidia-container-runtime"}}}`), 0644)
+	require.NoError(t, err)
+
+	r, err := newRuntime(runtimeTarget{name: "docker", args: "--config=" + config}, dir)
+	require.NoError(t, err)
+
+	s := newStatus()
+	s.setRuntimes([]*runtime{r})
+
+	var buf bytes.Buffer
+	newMetrics().write(&buf, s)
+	output := buf.String()
+
+	labels := fmt.Sprintf(`{target=%q,runtime="docker",config=%q,name="%%v"}`, r.target.String(), config)
+	configured := "nvidia_toolkit_runtime_configured" + fmt.Sprintf(labels, "nvidia-experimental") + " 0\n"
+	require.Contains(t, output, "nvidia_toolkit_runtime_configured"+fmt.Sprintf(labels, "nvidia")+" 1\n")
+	require.Contains(t, output, configured)
+	require.Contains(t, output, "nvidia_toolkit_runtime_default"+fmt.Sprintf(labels, "nvidia")+" 1\n")
+	require.Contains(t, output, "nvidia_toolkit_runtime_default"+fmt.Sprintf(labels, "nvidia-experimental")+" 0\n")
+
+	// Each metric family is written as a complete block
+	require.Less(t, strings.Index(output, configured), strings.Index(output, "# HELP nvidia_toolkit_runtime_default"))
+
+	// A runtime removed from the config is no longer reported as configured
+	err = ioutil.WriteFile(config, []byte(`{}`), 0644)
+	require.NoError(t, err)
+
+	buf.Reset()
+	newMetrics().write(&buf, s)
+	output = buf.String()
+	require.Contains(t, output, "nvidia_toolkit_runtime_configured"+fmt.Sprintf(labels, "nvidia")+" 0\n")
+	require.Contains(t, output, "nvidia_toolkit_runtime_default"+fmt.Sprintf(labels, "nvidia")+" 0\n")
+}
+
+func TestMetricsComponents(t *testing.T) {
+	dir, err := ioutil.TempDir("", "nvidia-toolkit-metrics-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	cli := filepath.Join(dir, "nvidia-container-cli")
+	err = ioutil.WriteFile(cli, []byte("#! /bin/sh\necho \"version: 1.3.0\"\n"), 0755)
+	require.NoError(t, err)
+
+	m := newMetrics()
+	m.setComponents([]toolkit.Component{
+		{Name: "nvidia-container-cli", Path: cli, Installed: true},
+		{Name: "config.toml", Path: filepath.Join(dir, "config.toml"), Installed: true},
+		{Name: "nvidia-container-runtime", Path: filepath.Join(dir, "nvidia-container-runtime")},
+	})
+
+	server := httptest.NewServer(m.handler(newStatus()))
+	defer server.Close()
+
+	resp, err := server.Client().Get(server.URL)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	require.NoError(t, err)
+
+	require.Contains(t, string(body), `nvidia_toolkit_component_info{component="config.toml",version="unknown"} 1`)
+	require.Contains(t, string(body), `nvidia_toolkit_component_info{component="nvidia-container-cli",version="1.3.0"} 1`)
+	require.NotContains(t, string(body), `component="nvidia-container-runtime"`)
+	require.Contains(t, string(body), fmt.Sprintf(`nvidia_toolkit_build_info{version="%v"} 1`, Version))
+}
+
+func TestEscapeLabelValue(t *testing.T) {
+	testCases := []struct {
+		value    string
+		expected string
+	}{
+		{value: "nvidia", expected: "nvidia"},
+		{value: `a"b`, expected: `a\"b`},
+		{value: `a\b`, expected: `a\\b`},
+		{value: "a\nb", expected: `a\nb`},
+	}
+
+	for i, tc := range testCases {
+		require.Equal(t, tc.expected, escapeLabelValue(tc.value), "%d: %v", i, tc)
+	}
+}
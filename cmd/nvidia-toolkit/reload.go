@@ -0,0 +1,145 @@
+/**
+# Copyright (c) 2021, NVIDIA CORPORATION.  All rights reserved.
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#     http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"time"
+
+	"container-toolkit/internal/journal"
+	"container-toolkit/internal/transaction"
+	"container-toolkit/pkg/toolkit"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// reload loads the configuration again and applies it without cleaning up
+// first. Only the config file and the detected runtime can change, since the
+// flags and environment of the process cannot. The toolkit is only
+// reinstalled if its options changed. The setup of the runtime targets is
+// applied again, which restores any nvidia runtimes removed from their
+// configs in the meantime. Runtime targets that are no longer specified, or
+// whose options changed, are cleaned up before the new targets are set up.
+// If the new configuration cannot be applied, the previous one is kept.
+func reload(ctx context.Context, j *journal.Journal) error {
+	log.Infof("Reloading configuration")
+
+	nextToolkitOptions, nextRuntimes, err := loadConfiguration()
+	if err != nil {
+		return fmt.Errorf("unable to load configuration: %v", err)
+	}
+
+	previousToolkitOptions, previousRuntimes := toolkitOptions, runtimes
+	toolkitOptions, runtimes = nextToolkitOptions, nextRuntimes
+
+	reinstall := !reflect.DeepEqual(previousToolkitOptions, toolkitOptions)
+	stale := staleRuntimes(previousRuntimes, runtimes)
+
+	var failed []*runtime
+	for i := len(stale) - 1; i >= 0; i-- {
+		r := stale[i]
+		log.Infof("Cleaning up runtime %v, which is no longer configured", r.target)
+
+		start := time.Now()
+		err := r.cleanup()
+		currentMetrics.observe(operationCleanup, r.target.String(), start, err)
+		if err != nil {
+			log.Errorf("Unable to clean up runtime %v: %v", r.target, err)
+			failed = append([]*runtime{r}, failed...)
+		}
+	}
+
+	err = transaction.Run(func(tx *transaction.Transaction) error {
+		err := tx.BackupFile(j.Path())
+		if err != nil {
+			return fmt.Errorf("unable to back up journal: %v", err)
+		}
+
+		if reinstall {
+			err = installToolkit(ctx, tx, j)
+			if err != nil {
+				return fmt.Errorf("unable to install toolkit: %v", err)
+			}
+		} else {
+			log.Infof("Toolkit options are unchanged; skipping installation")
+		}
+
+		err = setupRuntime(ctx, tx, j, runtimes)
+		if err != nil {
+			return fmt.Errorf("unable to setup runtime: %v", err)
+		}
+		return nil
+	})
+	if err != nil {
+		// The runtimes that were cleaned up are set up again so that the
+		// previous configuration remains in effect. Their setup is still
+		// recorded in the journal, which is only rewritten once a reload
+		// succeeds, so it is not recorded again.
+		toolkitOptions, runtimes = previousToolkitOptions, previousRuntimes
+		rerr := transaction.Run(func(tx *transaction.Transaction) error {
+			return setupRuntime(ctx, tx, nil, stale)
+		})
+		if rerr != nil {
+			log.Errorf("Unable to restore previous runtime setup: %v", rerr)
+		}
+		return err
+	}
+
+	// Runtimes that could not be cleaned up are kept so that their cleanup is
+	// retried on the next reload or on shutdown.
+	runtimes = append(failed, runtimes...)
+
+	if reinstall && !toolkitOptions.DryRun {
+		currentStatus.setToolkit(toolkitOptions)
+		currentMetrics.setComponents(toolkit.NewInstaller(*toolkitOptions).Components())
+	}
+	currentStatus.setRuntimes(runtimes)
+
+	if isDryRun() {
+		return nil
+	}
+	return rewriteJournal(j, runtimes)
+}
+
+// staleRuntimes returns the previous runtime targets that are not part of the
+// current targets with the same options
+func staleRuntimes(previous []*runtime, current []*runtime) []*runtime {
+	keys := make(map[string]bool)
+	for _, r := range current {
+		keys[r.key()] = true
+	}
+
+	var stale []*runtime
+	for _, r := range previous {
+		if !keys[r.key()] {
+			stale = append(stale, r)
+		}
+	}
+	return stale
+}
+
+// key identifies a runtime target by its runtime and options
+func (r *runtime) key() string {
+	options, err := json.Marshal(r.options)
+	if err != nil {
+		return fmt.Sprintf("%v %p", r.target.name, r)
+	}
+	return r.target.name + " " + string(options)
+}
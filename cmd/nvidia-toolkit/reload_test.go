@@ -0,0 +1,117 @@
+/**
+# Copyright (c) 2021, NVIDIA CORPORATION.  All rights reserved.
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#     http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"container-toolkit/internal/journal"
+	"container-toolkit/internal/transaction"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestReload(t *testing.T) {
+	dir, err := ioutil.TempDir("", "nvidia-toolkit-test-")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	hooksDirA := filepath.Join(dir, "a")
+	hooksDirB := filepath.Join(dir, "b")
+	hookFilename := "oci-nvidia-hook.json"
+	configFile := filepath.Join(dir, "config.yaml")
+	writeConfig := func(runtime string, hooksDir string) {
+		contents := "version: v1\nruntimes:\n- name: " + runtime + "\n  options:\n    hooksDir: " + hooksDir + "\n"
+		require.NoError(t, ioutil.WriteFile(configFile, []byte(contents), 0644))
+	}
+
+	destinationArg = dir
+	writeConfig("crio", hooksDirA)
+	require.NoError(t, parseRunFlags("--config-file="+configFile))
+
+	j := journal.New(filepath.Join(dir, "toolkit.journal"), "1.2.3")
+	err = transaction.Run(func(tx *transaction.Transaction) error {
+		return setupRuntime(context.Background(), tx, j, runtimes)
+	})
+	require.NoError(t, err)
+	require.FileExists(t, filepath.Join(hooksDirA, hookFilename))
+
+	// Reloading an unchanged configuration keeps the runtime in place
+	require.NoError(t, reload(context.Background(), j))
+	require.FileExists(t, filepath.Join(hooksDirA, hookFilename))
+	require.Len(t, runtimes, 1)
+
+	setups := journalSetups(t, j)
+	require.Len(t, setups, 1)
+
+	// A runtime target that is no longer specified is cleaned up
+	writeConfig("crio", hooksDirB)
+	require.NoError(t, reload(context.Background(), j))
+	require.NoFileExists(t, filepath.Join(hooksDirA, hookFilename))
+	require.FileExists(t, filepath.Join(hooksDirB, hookFilename))
+	require.Len(t, runtimes, 1)
+
+	setups = journalSetups(t, j)
+	require.Len(t, setups, 1)
+	require.Contains(t, string(setups[0].Options), hooksDirB)
+
+	// An invalid configuration is not applied
+	previous := runtimes
+	writeConfig("unknown", hooksDirA)
+	require.Error(t, reload(context.Background(), j))
+	require.FileExists(t, filepath.Join(hooksDirB, hookFilename))
+	require.Equal(t, previous, runtimes)
+	require.Equal(t, configFile, configFileFlag)
+
+	// A configuration that cannot be applied restores the previous runtimes
+	// without recording these in the journal again
+	writeConfig("crio", filepath.Join(configFile, "hooks"))
+	require.Error(t, reload(context.Background(), j))
+	require.FileExists(t, filepath.Join(hooksDirB, hookFilename))
+	require.Equal(t, previous, runtimes)
+
+	setups = journalSetups(t, j)
+	require.Len(t, setups, 1)
+	require.Contains(t, string(setups[0].Options), hooksDirB)
+}
+
+// journalSetups returns the runtime setups recorded in the specified journal
+func journalSetups(t *testing.T, j *journal.Journal) []journal.Entry {
+	entries, err := j.Load()
+	require.NoError(t, err)
+
+	var setups []journal.Entry
+	for _, e := range entries {
+		if e.Op == journal.OpSetupRuntime {
+			setups = append(setups, e)
+		}
+	}
+	return setups
+}
+
+// parseRunFlags parses the specified arguments as the CLI does when it is
+// started without a command
+func parseRunFlags(args ...string) error {
+	c := newApp()
+	c.Commands = nil
+	c.Action = verifyFlags
+	return c.Run(append([]string{"nvidia-toolkit"}, args...))
+}
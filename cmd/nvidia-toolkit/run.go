@@ -1,17 +1,24 @@
 package main
 
 import (
+	"context"
 	"fmt"
+	"net/http"
 	"os"
-	"os/exec"
 	"os/signal"
 	"path/filepath"
 	"strings"
 	"syscall"
+	"time"
+
+	"container-toolkit/internal/journal"
+	"container-toolkit/internal/transaction"
+	"container-toolkit/pkg/toolkit"
 
 	log "github.com/sirupsen/logrus"
 	cli "github.com/urfave/cli/v2"
 	unix "golang.org/x/sys/unix"
+	yaml "gopkg.in/yaml.v3"
 )
 
 const (
@@ -20,34 +27,108 @@ const (
 	toolkitCommand = "toolkit"
 	toolkitSubDir  = "toolkit"
 
-	defaultToolkitArgs = ""
-	defaultRuntime     = "docker"
-	defaultRuntimeArgs = ""
+	defaultToolkitArgs    = ""
+	defaultRuntime        = "docker"
+	defaultRuntimeArgs    = ""
+	defaultCleanupTimeout = 30 * time.Second
+	defaultWatchInterval  = 30 * time.Second
+	defaultDriverInterval = 10 * time.Second
+	defaultDriverTimeout  = 5 * time.Minute
+	defaultDriverPoll     = 5 * time.Second
 )
 
 var availableRuntimes = map[string]struct{}{"docker": {}, "crio": {}, "containerd": {}}
 
-var waitingForSignal = make(chan bool, 1)
-var signalReceived = make(chan bool, 1)
-
 var destinationArg string
 var noDaemonFlag bool
 var toolkitArgsFlag string
 var runtimeFlag string
 var runtimeArgsFlag string
+var journalFileFlag string
+var cleanupTimeoutFlag time.Duration
+var statusAddressFlag string
+var watchConfigsFlag bool
+var watchIntervalFlag time.Duration
+var watchDriverFlag bool
+var driverMarkerFlag string
+var driverWatchIntervalFlag time.Duration
+var waitForDriverFlag bool
+var driverWaitTimeoutFlag time.Duration
+var driverPollIntervalFlag time.Duration
+
+// driverReadyChecks holds the checks of which any must pass for the driver to
+// be considered ready
+var driverReadyChecks []string
+
+var configFileFlag string
+
+// runtimeTargetsFlag holds the runtime targets specified with --runtime-target
+var runtimeTargetsFlag []string
+
+// runtimeSpecified indicates whether --runtime was specified explicitly
+var runtimeSpecified bool
+
+// runtimes holds the runtimes to set up in order. These are cleaned up in
+// reverse order.
+var runtimes []*runtime
+
+// toolkitOptions holds the options for installing the toolkit
+var toolkitOptions *toolkit.Options
+
+// runtimeTarget defines a runtime to set up along with the arguments to pass
+// to its setup and cleanup commands.
+type runtimeTarget struct {
+	name string
+	args string
+	// options are the options of the runtime in the config file if the
+	// target is defined there, which are overridden by the arguments
+	options *yaml.Node
+}
+
+func (t runtimeTarget) String() string {
+	if t.args == "" {
+		return t.name
+	}
+	return fmt.Sprintf("%v (%v)", t.name, t.args)
+}
 
 // Version defines the CLI version. This is set at build time using LD FLAGS
 var Version = "development"
 
 func main() {
-	// Create the top-level CLI
+	c := newApp()
+
+	// Run the CLI
+	log.Infof("Starting %v", c.Name)
+
+	remainingArgs, isCommand := commandArgs(c.Commands, os.Args)
+	if !isCommand {
+		var err error
+		remainingArgs, err = ParseArgs(os.Args)
+		if err != nil {
+			log.Errorf("Error: unable to parse arguments: %v", err)
+			os.Exit(1)
+		}
+	}
+
+	if err := c.Run(remainingArgs); err != nil {
+		log.Errorf("error running nvidia-toolkit: %v", err)
+		os.Exit(1)
+	}
+
+	log.Infof("Completed %v", c.Name)
+}
+
+// newApp creates the top-level CLI
+func newApp() *cli.App {
 	c := cli.NewApp()
 	c.Name = "nvidia-toolkit"
 	c.Usage = "Install the nvidia-container-toolkit for use by a given runtime"
-	c.UsageText = "DESTINATION [-n | --no-daemon] [-t | --toolkit-args] [-r | --runtime] [-u | --runtime-args]"
-	c.Description = "DESTINATION points to the host path underneath which the nvidia-container-toolkit should be installed.\nIt will be installed at ${DESTINATION}/toolkit"
+	c.UsageText = "DESTINATION [-n | --no-daemon] [-t | --toolkit-args] [-r | --runtime] [-u | --runtime-args]\n   nvidia-toolkit command [command options] [arguments...]"
+	c.Description = "DESTINATION points to the host path underneath which the nvidia-container-toolkit should be installed.\nIt will be installed at ${DESTINATION}/toolkit\n\nThe commands can also be invoked through a link to this binary with the name of the command (e.g. 'containerd setup')"
 	c.Version = Version
 	c.Action = Run
+	c.Commands = newCommands()
 
 	// Setup flags for the CLI
 	c.Flags = []cli.Flag{
@@ -61,7 +142,7 @@ func main() {
 		&cli.StringFlag{
 			Name:        "toolkit-args",
 			Aliases:     []string{"t"},
-			Usage:       "arguments to pass to the underlying 'toolkit' command",
+			Usage:       "arguments for installing the toolkit as accepted by the 'toolkit install' command. These are split following the quoting rules of a POSIX shell",
 			Value:       defaultToolkitArgs,
 			Destination: &toolkitArgsFlag,
 			EnvVars:     []string{"TOOLKIT_ARGS"},
@@ -69,7 +150,7 @@ func main() {
 		&cli.StringFlag{
 			Name:        "runtime",
 			Aliases:     []string{"r"},
-			Usage:       "the runtime to setup on this node. One of {'docker', 'crio', 'containerd'}",
+			Usage:       "the runtime to setup on this node. One of {'docker', 'crio', 'containerd', 'auto'}. If 'auto' is specified, the active runtime is detected",
 			Value:       defaultRuntime,
 			Destination: &runtimeFlag,
 			EnvVars:     []string{"RUNTIME"},
@@ -77,33 +158,102 @@ func main() {
 		&cli.StringFlag{
 			Name:        "runtime-args",
 			Aliases:     []string{"u"},
-			Usage:       "arguments to pass to 'docker', 'crio', or 'containerd' setup command",
+			Usage:       "arguments for the runtime as accepted by the 'docker', 'crio', or 'containerd' setup command. These are split following the quoting rules of a POSIX shell. These override the options of every runtime in the config file",
 			Value:       defaultRuntimeArgs,
 			Destination: &runtimeArgsFlag,
 			EnvVars:     []string{"RUNTIME_ARGS"},
 		},
+		&cli.StringSliceFlag{
+			Name:    "runtime-target",
+			Usage:   "a runtime to setup on this node in the form 'RUNTIME[:RUNTIME_ARGS]' (e.g. 'containerd:--config=/etc/containerd/config.toml'). This can be repeated to set up several runtimes or runtime instances, which are cleaned up in reverse order. Cannot be combined with --runtime or --runtime-args",
+			EnvVars: []string{"RUNTIME_TARGETS"},
+		},
+		&cli.StringFlag{
+			Name:        "config-file",
+			Usage:       "the path of a YAML file that defines the options for installing the toolkit and the runtimes to set up along with their options. Flags and environment variables that are set explicitly, including --runtime-args, override the options in the file, and apply to every runtime in the file. Sending SIGHUP reloads this file; the flags and environment variables are not read again, since these cannot change for a running process. The runtimes in the file are ignored if --runtime or --runtime-target is specified",
+			Destination: &configFileFlag,
+			EnvVars:     []string{"CONFIG_FILE"},
+		},
+		journalFlag(&journalFileFlag),
+		&cli.DurationFlag{
+			Name:        "cleanup-timeout",
+			Usage:       "the time to allow for cleaning up after a signal is received. A signal aborts a setup that is in progress and rolls back its changes; otherwise the runtimes are cleaned up. If this takes longer, the process exits with an error. This should be shorter than the termination grace period of the pod",
+			Value:       defaultCleanupTimeout,
+			Destination: &cleanupTimeoutFlag,
+			EnvVars:     []string{"CLEANUP_TIMEOUT"},
+		},
+		&cli.StringFlag{
+			Name:        "status-address",
+			Usage:       "the address on which to serve the /healthz, /readyz and /status endpoints, either as HOST:PORT or as unix:PATH for a unix socket. If this is empty, the endpoints are not served",
+			Destination: &statusAddressFlag,
+			EnvVars:     []string{"STATUS_ADDRESS"},
+		},
+		&cli.BoolFlag{
+			Name:        "watch-configs",
+			Usage:       "watch the configs of the runtimes for changes made by other processes and re-apply the setup if the nvidia runtimes are removed or changed",
+			Destination: &watchConfigsFlag,
+			EnvVars:     []string{"WATCH_CONFIGS"},
+		},
+		&cli.DurationFlag{
+			Name:        "watch-interval",
+			Usage:       "the minimum time between two checks of the runtime configs if --watch-configs is specified. Changes made in the meantime are checked once the interval has passed",
+			Value:       defaultWatchInterval,
+			Destination: &watchIntervalFlag,
+			EnvVars:     []string{"WATCH_INTERVAL"},
+		},
+		&cli.BoolFlag{
+			Name:        "watch-driver",
+			Usage:       "watch the driver root for a reinstalled driver (e.g. after the driver container is upgraded) and regenerate the toolkit config and the runtime wrappers that depend on it",
+			Destination: &watchDriverFlag,
+			EnvVars:     []string{"WATCH_DRIVER"},
+		},
+		&cli.StringFlag{
+			Name:        "driver-marker",
+			Usage:       "the path of a file that is created or updated when the driver is ready. If --watch-driver is specified, a change to this file also results in the files being regenerated",
+			Destination: &driverMarkerFlag,
+			EnvVars:     []string{"DRIVER_MARKER"},
+		},
+		&cli.DurationFlag{
+			Name:        "driver-watch-interval",
+			Usage:       "the interval at which the driver root is checked for changes if --watch-driver is specified",
+			Value:       defaultDriverInterval,
+			Destination: &driverWatchIntervalFlag,
+			EnvVars:     []string{"DRIVER_WATCH_INTERVAL"},
+		},
+		&cli.BoolFlag{
+			Name:        "wait-for-driver",
+			Usage:       "wait for the driver to be ready before installing the toolkit and setting up the runtimes",
+			Destination: &waitForDriverFlag,
+			EnvVars:     []string{"WAIT_FOR_DRIVER"},
+		},
+		&cli.StringSliceFlag{
+			Name:    "driver-ready-checks",
+			Usage:   "the checks of which any must pass for the driver to be considered ready if --wait-for-driver is specified. One or more of {'library', 'module', 'marker'}: the NVIDIA management library exists in the driver root, the nvidia kernel module is loaded, or the file specified by --driver-marker exists",
+			Value:   cli.NewStringSlice(driverCheckLibrary),
+			EnvVars: []string{"DRIVER_READY_CHECKS"},
+		},
+		&cli.DurationFlag{
+			Name:        "driver-wait-timeout",
+			Usage:       "the maximum time to wait for the driver to be ready if --wait-for-driver is specified. If this is 0, there is no limit",
+			Value:       defaultDriverTimeout,
+			Destination: &driverWaitTimeoutFlag,
+			EnvVars:     []string{"DRIVER_WAIT_TIMEOUT"},
+		},
+		&cli.DurationFlag{
+			Name:        "driver-poll-interval",
+			Usage:       "the interval at which the driver is checked while waiting for it to be ready",
+			Value:       defaultDriverPoll,
+			Destination: &driverPollIntervalFlag,
+			EnvVars:     []string{"DRIVER_POLL_INTERVAL"},
+		},
 	}
 
-	// Run the CLI
-	log.Infof("Starting %v", c.Name)
-
-	remainingArgs, err := ParseArgs(os.Args)
-	if err != nil {
-		log.Errorf("Error: unable to parse arguments: %v", err)
-		os.Exit(1)
-	}
-
-	if err := c.Run(remainingArgs); err != nil {
-		log.Errorf("error running nvidia-toolkit: %v", err)
-		os.Exit(1)
-	}
-
-	log.Infof("Completed %v", c.Name)
+	return c
 }
 
 // Run runs the core logic of the CLI
 func Run(c *cli.Context) error {
-	err := verifyFlags()
+	err := verifyFlags(c)
 	if err != nil {
 		return fmt.Errorf("unable to verify flags: %v", err)
 	}
@@ -114,28 +264,106 @@ func Run(c *cli.Context) error {
 	}
 	defer shutdown()
 
-	err = installToolkit()
-	if err != nil {
-		return fmt.Errorf("unable to install toolkit: %v", err)
+	if statusAddressFlag != "" {
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", currentMetrics.handler(currentStatus))
+		mux.Handle("/", currentStatus.handler())
+
+		stopServer, err := startServer(statusAddressFlag, mux)
+		if err != nil {
+			return fmt.Errorf("unable to start status server: %v", err)
+		}
+		defer stopServer()
 	}
 
-	err = setupRuntime()
+	ctx, stop := newSignalContext(cleanupTimeoutFlag, exitOnTimeout, syscall.SIGINT, syscall.SIGQUIT, syscall.SIGPIPE, syscall.SIGTERM)
+	defer stop()
+
+	reloads := make(chan os.Signal, 1)
+	signal.Notify(reloads, syscall.SIGHUP)
+	defer signal.Stop(reloads)
+
+	j := journal.New(journalFileFlag, Version)
+	if !isDryRun() {
+		// Changes recorded by a previous run that did not exit cleanly (e.g.
+		// because it was killed) are undone first, since these may have
+		// been made with different flags.
+		err = replayJournal(j)
+		if err != nil {
+			log.Warnf("Unable to undo all changes of a previous run: %v", err)
+		}
+	}
+
+	err = waitForDriver(ctx, driverReadyChecks)
+	if err != nil && ctx.Err() != nil {
+		log.Infof("Waiting for the driver was interrupted by a signal")
+		return nil
+	}
 	if err != nil {
-		return fmt.Errorf("unable to setup runtime: %v", err)
+		currentStatus.setError(err)
+		return err
 	}
 
-	if !noDaemonFlag {
-		err = waitForSignal()
+	// The toolkit installation and the runtime setups are performed in a
+	// single transaction so that a failure in any of these leaves the node as
+	// it was before.
+	currentStatus.setPhase(phaseSettingUp)
+	err = transaction.Run(func(tx *transaction.Transaction) error {
+		err := tx.BackupFile(j.Path())
+		if err != nil {
+			return fmt.Errorf("unable to back up journal: %v", err)
+		}
+
+		err = installToolkit(ctx, tx, j)
+		if err != nil {
+			return fmt.Errorf("unable to install toolkit: %v", err)
+		}
+
+		err = setupRuntime(ctx, tx, j, runtimes)
 		if err != nil {
-			return fmt.Errorf("unable to wait for signal: %v", err)
+			return fmt.Errorf("unable to setup runtime: %v", err)
 		}
+		return nil
+	})
+	if err != nil && ctx.Err() != nil {
+		log.Infof("Setup was interrupted by a signal and its changes were rolled back: %v", err)
+		return nil
+	}
+	if err != nil {
+		currentStatus.setError(err)
+		return err
+	}
+
+	if !toolkitOptions.DryRun {
+		currentStatus.setToolkit(toolkitOptions)
+		currentMetrics.setComponents(toolkit.NewInstaller(*toolkitOptions).Components())
+	}
+	currentStatus.setRuntimes(runtimes)
+	currentStatus.setReady()
 
+	if !noDaemonFlag {
+		waitForSignal(ctx, reloads, j)
+
+		currentStatus.setPhase(phaseCleaningUp)
 		err = cleanupRuntime()
 		if err != nil {
+			currentStatus.setError(err)
 			return fmt.Errorf("unable to cleanup runtime: %v", err)
 		}
+		currentStatus.setRuntimes(nil)
 	}
 
+	// The toolkit remains installed after a regular shutdown and is replaced
+	// by the next run, so nothing is left to be undone. Without a daemon, the
+	// changes are meant to outlive the process and must not be undone by the
+	// next run either.
+	if isDryRun() {
+		return nil
+	}
+	err = j.Remove()
+	if err != nil {
+		return fmt.Errorf("unable to update journal: %v", err)
+	}
 	return nil
 }
 
@@ -175,12 +403,108 @@ func ParseArgs(args []string) ([]string, error) {
 	return append([]string{args[0]}, args[numPositionalArgs:]...), nil
 }
 
-func verifyFlags() error {
+func verifyFlags(c *cli.Context) error {
 	log.Infof("Verifying Flags")
-	if _, exists := availableRuntimes[runtimeFlag]; !exists {
-		return fmt.Errorf("unknown runtime: %v", runtimeFlag)
+
+	runtimeTargetsFlag = c.StringSlice("runtime-target")
+	runtimeSpecified = c.IsSet("runtime")
+	if len(runtimeTargetsFlag) > 0 && (runtimeSpecified || c.IsSet("runtime-args")) {
+		return fmt.Errorf("--runtime-target cannot be combined with --runtime or --runtime-args")
 	}
-	return nil
+
+	var err error
+	driverReadyChecks, err = parseDriverChecks(c.StringSlice("driver-ready-checks"), driverMarkerFlag)
+	if err != nil {
+		return err
+	}
+
+	toolkitOptions, runtimes, err = loadConfiguration()
+	return err
+}
+
+// loadConfiguration creates the options for installing the toolkit and the
+// runtime targets from the flags and the config file. Since the flags and the
+// environment of the process do not change, the configuration only changes
+// when it is loaded again (e.g. on a reload) if the config file or the
+// detected runtime for --runtime=auto changed.
+func loadConfiguration() (*toolkit.Options, []*runtime, error) {
+	toolkitDir := filepath.Join(destinationArg, toolkitSubDir)
+
+	var cfg *configFile
+	if configFileFlag != "" {
+		var err error
+		cfg, err = loadConfigFile(configFileFlag)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	o, err := newToolkitOptions(toolkitArgsFlag, toolkitDir, cfg.toolkitOptions())
+	if err != nil {
+		return nil, nil, err
+	}
+
+	targets, err := getRuntimeTargets(cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var rs []*runtime
+	for _, target := range targets {
+		r, err := newRuntime(target, toolkitDir)
+		if err != nil {
+			return nil, nil, err
+		}
+		rs = append(rs, r)
+	}
+
+	return o, rs, nil
+}
+
+// getRuntimeTargets returns the runtime targets specified on the command line.
+// If none are specified, the runtime targets in the config file, if any, are
+// returned.
+func getRuntimeTargets(cfg *configFile) ([]runtimeTarget, error) {
+	if len(runtimeTargetsFlag) > 0 {
+		return parseRuntimeTargets(runtimeTargetsFlag)
+	}
+
+	if cfg != nil && len(cfg.Runtimes) > 0 && !runtimeSpecified {
+		return cfg.runtimeTargets(runtimeArgsFlag), nil
+	}
+
+	name := runtimeFlag
+	if name == runtimeAuto {
+		var err error
+		name, err = detectRuntime(newRuntimeProbe())
+		if err != nil {
+			return nil, fmt.Errorf("unable to detect runtime: %v", err)
+		}
+	}
+
+	if _, exists := availableRuntimes[name]; !exists {
+		return nil, fmt.Errorf("unknown runtime: %v", name)
+	}
+	return []runtimeTarget{{name: name, args: runtimeArgsFlag}}, nil
+}
+
+// parseRuntimeTargets parses runtime targets of the form RUNTIME[:RUNTIME_ARGS]
+func parseRuntimeTargets(targets []string) ([]runtimeTarget, error) {
+	var parsed []runtimeTarget
+	for _, target := range targets {
+		parts := strings.SplitN(target, ":", 2)
+
+		t := runtimeTarget{name: strings.TrimSpace(parts[0])}
+		if len(parts) == 2 {
+			t.args = strings.TrimSpace(parts[1])
+		}
+
+		if _, exists := availableRuntimes[t.name]; !exists {
+			return nil, fmt.Errorf("unknown runtime in runtime target '%v': %v", target, t.name)
+		}
+		parsed = append(parsed, t)
+	}
+	return parsed, nil
 }
 
 func initialize() error {
@@ -203,80 +527,184 @@ func initialize() error {
 		return fmt.Errorf("unable to write PID to pidfile: %v", err)
 	}
 
-	sigs := make(chan os.Signal, 1)
-	signal.Notify(sigs, syscall.SIGHUP, syscall.SIGINT, syscall.SIGQUIT, syscall.SIGPIPE, syscall.SIGTERM)
-	go func() {
-		<-sigs
-		select {
-		case <-waitingForSignal:
-			signalReceived <- true
-		default:
-			log.Infof("Signal received, exiting early")
-			shutdown()
-			os.Exit(0)
-		}
-	}()
-
 	return nil
 }
 
-func installToolkit() error {
-	toolkitDir := filepath.Join(destinationArg, toolkitSubDir)
+// exitOnTimeout exits the process if the cleanup after a signal does not
+// complete in time
+func exitOnTimeout() {
+	shutdown()
+	os.Exit(1)
+}
 
+// installToolkit installs the toolkit and records it in the journal. An
+// existing installation is moved aside and is restored if the transaction is
+// rolled back.
+func installToolkit(ctx context.Context, tx *transaction.Transaction, j *journal.Journal) (err error) {
 	log.Infof("Installing toolkit")
 
-	cmdline := fmt.Sprintf("%v install %v %v\n", toolkitCommand, toolkitArgsFlag, toolkitDir)
-	cmd := exec.Command("sh", "-c", cmdline)
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	err := cmd.Run()
-	if err != nil {
-		return fmt.Errorf("error running %v command: %v", toolkitCommand, err)
+	defer func(start time.Time) {
+		currentMetrics.observe(operationInstall, "", start, err)
+	}(time.Now())
+
+	if err := ctx.Err(); err != nil {
+		return err
 	}
 
-	return nil
+	if !toolkitOptions.DryRun {
+		err = tx.MoveAside(toolkitOptions.ToolkitDir)
+		if err != nil {
+			return fmt.Errorf("unable to back up existing installation: %v", err)
+		}
+
+		err = journalToolkit(j, toolkitOptions)
+		if err != nil {
+			return fmt.Errorf("unable to record toolkit in journal: %v", err)
+		}
+	}
+
+	return toolkit.NewInstaller(*toolkitOptions).Install()
 }
 
-func setupRuntime() error {
-	toolkitDir := filepath.Join(destinationArg, toolkitSubDir)
+// setupRuntime sets up the specified runtime targets in order and records the
+// changes made in the journal. If the journal is nil, the setup is not
+// recorded (e.g. because the journal already records it).
+func setupRuntime(ctx context.Context, tx *transaction.Transaction, j *journal.Journal, targets []*runtime) error {
+	tx.SetJournal(j)
+	for _, r := range targets {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
 
-	log.Infof("Setting up runtime")
+		log.Infof("Setting up runtime %v", r.target)
 
-	cmdline := fmt.Sprintf("%v setup %v %v\n", runtimeFlag, runtimeArgsFlag, toolkitDir)
+		if j != nil && !r.dryRun {
+			err := journalRuntime(j, r)
+			if err != nil {
+				return fmt.Errorf("unable to record %v in journal: %v", r.target, err)
+			}
+		}
 
-	cmd := exec.Command("sh", "-c", cmdline)
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	err := cmd.Run()
-	if err != nil {
-		return fmt.Errorf("error running %v command: %v", runtimeFlag, err)
+		start := time.Now()
+		err := r.setup(ctx, tx)
+		currentMetrics.observe(operationSetup, r.target.String(), start, err)
+		if err != nil {
+			return fmt.Errorf("unable to setup %v: %v", r.target, err)
+		}
 	}
 
 	return nil
 }
 
-func waitForSignal() error {
-	log.Infof("Waiting for signal")
-	waitingForSignal <- true
-	<-signalReceived
-	return nil
+// isDryRun checks whether the toolkit or any of the runtimes is set up in
+// dry-run mode. In this case, the journal is neither replayed nor written.
+func isDryRun() bool {
+	if toolkitOptions.DryRun {
+		return true
+	}
+	for _, r := range runtimes {
+		if r.dryRun {
+			return true
+		}
+	}
+	return false
 }
 
-func cleanupRuntime() error {
-	toolkitDir := filepath.Join(destinationArg, toolkitSubDir)
-
-	log.Infof("Cleaning up Runtime")
+// waitForSignal blocks until the context is cancelled by a signal. The
+// configuration is reloaded whenever a signal is received on reloads. If
+// --watch-configs is specified, the setup of the runtimes is re-applied when
+// their configs are changed by another process. If --watch-driver is
+// specified, the toolkit files that depend on the driver are regenerated when
+// the driver changes.
+func waitForSignal(ctx context.Context, reloads <-chan os.Signal, j *journal.Journal) {
+	w := startWatching()
+	d := startDriverWatch()
+	defer func() {
+		w.close()
+		d.stop()
+	}()
 
-	cmdline := fmt.Sprintf("%v cleanup %v %v\n", runtimeFlag, runtimeArgsFlag, toolkitDir)
+	var pending <-chan time.Time
+	var lastReconcile time.Time
+	for {
+		log.Infof("Waiting for signal")
+		select {
+		case <-ctx.Done():
+			return
+		case path, ok := <-w.changes():
+			if !ok {
+				w = nil
+				continue
+			}
+			if pending != nil {
+				continue
+			}
+			delay := reconcileDelay(lastReconcile)
+			log.Infof("Config %v was changed; checking runtime configs in %v", path, delay)
+			pending = time.After(delay)
+		case <-d.ticks():
+			checkDriver(d)
+		case _, ok := <-d.markerChanges():
+			if !ok {
+				d.marker = nil
+				continue
+			}
+			checkDriver(d)
+		case <-pending:
+			pending = nil
+			lastReconcile = time.Now()
+
+			currentStatus.setPhase(phaseReconciling)
+			start := time.Now()
+			reapplied, err := reconcile(ctx, j)
+			currentMetrics.observe(operationReconcile, "", start, err)
+			if err != nil {
+				log.Errorf("Unable to reconcile runtime configs: %v", err)
+				currentStatus.setError(err)
+			}
+			currentStatus.setReconciled(reapplied)
+		case <-reloads:
+			currentStatus.setPhase(phaseReloading)
+			start := time.Now()
+			err := reload(ctx, j)
+			currentMetrics.observe(operationReload, "", start, err)
+			if err != nil {
+				log.Errorf("Unable to reload configuration: %v", err)
+				currentStatus.setError(err)
+			}
+			currentStatus.setReloaded(err == nil)
+
+			// The runtimes, and thus the configs to watch, as well as the
+			// driver root may have changed
+			w.close()
+			w = startWatching()
+			d.stop()
+			d = startDriverWatch()
+		}
+	}
+}
 
-	cmd := exec.Command("sh", "-c", cmdline)
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	err := cmd.Run()
-	if err != nil {
-		return fmt.Errorf("error running %v command: %v", runtimeFlag, err)
+// cleanupRuntime cleans up the runtime targets in reverse order. A failure to
+// clean up one target does not prevent the remaining targets from being
+// cleaned up.
+func cleanupRuntime() error {
+	var failed []string
+	for i := len(runtimes) - 1; i >= 0; i-- {
+		r := runtimes[i]
+		log.Infof("Cleaning up runtime %v", r.target)
+
+		start := time.Now()
+		err := r.cleanup()
+		currentMetrics.observe(operationCleanup, r.target.String(), start, err)
+		if err != nil {
+			log.Errorf("Unable to clean up runtime %v: %v", r.target, err)
+			failed = append(failed, r.target.String())
+		}
 	}
 
+	if len(failed) > 0 {
+		return fmt.Errorf("unable to clean up runtimes: %v", strings.Join(failed, ", "))
+	}
 	return nil
 }
 
@@ -0,0 +1,137 @@
+/**
+# Copyright (c) 2021, NVIDIA CORPORATION.  All rights reserved.
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#     http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+*/
+
+package main
+
+import (
+	"testing"
+
+	"container-toolkit/pkg/runtime/containerd"
+	"container-toolkit/pkg/toolkit"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseRuntimeTargets(t *testing.T) {
+	testCases := []struct {
+		targets         []string
+		expectedTargets []runtimeTarget
+		expectedError   bool
+	}{
+		{
+			targets:         []string{"docker"},
+			expectedTargets: []runtimeTarget{{name: "docker"}},
+		},
+		{
+			targets: []string{
+				"docker",
+				"containerd:--config=/etc/containerd/config.toml --socket=/run/containerd/containerd.sock",
+				"containerd: --config=/etc/k8s/config.toml ",
+			},
+			expectedTargets: []runtimeTarget{
+				{name: "docker"},
+				{name: "containerd", args: "--config=/etc/containerd/config.toml --socket=/run/containerd/containerd.sock"},
+				{name: "containerd", args: "--config=/etc/k8s/config.toml"},
+			},
+		},
+		{
+			targets:         []string{"crio:--hooks-dir=/a:/b"},
+			expectedTargets: []runtimeTarget{{name: "crio", args: "--hooks-dir=/a:/b"}},
+		},
+		{
+			targets:       []string{"docker", "unknown:--flag"},
+			expectedError: true,
+		},
+		{
+			targets:       []string{"auto"},
+			expectedError: true,
+		},
+		{
+			targets:       []string{":--flag"},
+			expectedError: true,
+		},
+	}
+
+	for i, tc := range testCases {
+		targets, err := parseRuntimeTargets(tc.targets)
+		if tc.expectedError {
+			require.Error(t, err, "%d: %v", i, tc)
+			continue
+		}
+
+		require.NoError(t, err, "%d: %v", i, tc)
+		require.EqualValues(t, tc.expectedTargets, targets, "%d: %v", i, tc)
+	}
+}
+
+func TestNewRuntime(t *testing.T) {
+	testCases := []struct {
+		target        runtimeTarget
+		expectedError bool
+	}{
+		{
+			target: runtimeTarget{name: "docker"},
+		},
+		{
+			target: runtimeTarget{name: "containerd", args: "--config '/etc/my containerd/config.toml' --set-as-default=false"},
+		},
+		{
+			target: runtimeTarget{name: "crio", args: "--hooks-dir=/etc/hooks.d"},
+		},
+		{
+			target:        runtimeTarget{name: "containerd", args: "--unknown-flag"},
+			expectedError: true,
+		},
+		{
+			target:        runtimeTarget{name: "docker", args: "/some/positional/arg"},
+			expectedError: true,
+		},
+		{
+			target:        runtimeTarget{name: "docker", args: "--config '/etc/docker"},
+			expectedError: true,
+		},
+		{
+			target:        runtimeTarget{name: "unknown"},
+			expectedError: true,
+		},
+	}
+
+	for i, tc := range testCases {
+		r, err := newRuntime(tc.target, "/toolkit/dir")
+		if tc.expectedError {
+			require.Error(t, err, "%d: %v", i, tc)
+			continue
+		}
+
+		require.NoError(t, err, "%d: %v", i, tc)
+		require.Equal(t, tc.target, r.target, "%d: %v", i, tc)
+	}
+}
+
+func TestParseFlags(t *testing.T) {
+	o := containerd.Options{}
+	err := parseFlags("containerd", containerd.Flags(&o), `--config "/etc/my containerd/config.toml" --set-as-default=false --restart-mode=NONE`)
+	require.NoError(t, err)
+
+	require.Equal(t, "/etc/my containerd/config.toml", o.Config)
+	require.False(t, o.SetAsDefault)
+	require.Equal(t, "NONE", o.RestartMode)
+	require.Equal(t, "nvidia", o.RuntimeClass)
+
+	to, err := newToolkitOptions("--nvidia-driver-root=/driver --dry-run", "/toolkit/dir", nil)
+	require.NoError(t, err)
+	require.Equal(t, &toolkit.Options{ToolkitDir: "/toolkit/dir", DriverRoot: "/driver", DryRun: true}, to)
+}
@@ -0,0 +1,252 @@
+/**
+# Copyright (c) 2021, NVIDIA CORPORATION.  All rights reserved.
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#     http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+
+	"container-toolkit/internal/shlex"
+	"container-toolkit/internal/transaction"
+	"container-toolkit/pkg/config/engine"
+	"container-toolkit/pkg/runtime/containerd"
+	"container-toolkit/pkg/runtime/crio"
+	"container-toolkit/pkg/runtime/docker"
+	"container-toolkit/pkg/toolkit"
+
+	cli "github.com/urfave/cli/v2"
+	yaml "gopkg.in/yaml.v3"
+)
+
+// runtime defines the setup and cleanup of a runtime target. The changes made
+// by the setup are registered with a transaction so that these can be rolled
+// back if a later step fails.
+type runtime struct {
+	target  runtimeTarget
+	setup   func(ctx context.Context, tx *transaction.Transaction) error
+	cleanup func() error
+	// reload makes the runtime load its configs again, e.g. once the changes
+	// recorded in the journal are undone
+	reload func() error
+	// options are the options of the runtime, which are recorded in the
+	// journal so that the runtime can be cleaned up by a later process
+	options interface{}
+	// config is the path for which the state of the runtime is recorded
+	config string
+	// drift returns a diff of the changes a setup would make to the configs
+	// of the runtime, which is empty if the runtime is configured as expected
+	drift func() (string, error)
+	// loadRuntimes loads the current config in which the nvidia runtimes are
+	// configured and returns it along with the names of these runtimes
+	loadRuntimes func() (engine.Interface, []string, error)
+	// files are the configs of the runtime that are watched for changes
+	files  []string
+	dryRun bool
+}
+
+// newRuntime creates a runtime for the specified target. If the target is
+// defined in the config file, its options in the file are applied first. The
+// arguments of the target are then parsed using the same flags as the
+// corresponding command, so that these and the environment override the
+// options in the file. The nvidia runtimes are expected to be installed in
+// the specified toolkit directory.
+func newRuntime(target runtimeTarget, toolkitDir string) (*runtime, error) {
+	var options interface{}
+	var flags []cli.Flag
+
+	switch target.name {
+	case "docker":
+		o := docker.Options{}
+		flags = docker.Flags(&o)
+		options = &o
+	case "containerd":
+		o := containerd.Options{}
+		flags = containerd.Flags(&o)
+		options = &o
+	case "crio":
+		o := crio.Options{}
+		flags = crio.Flags(&o)
+		options = &o
+	default:
+		return nil, fmt.Errorf("unknown runtime: %v", target.name)
+	}
+
+	err := applyConfig(options, flags, target.options)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %v options: %v", target.name, err)
+	}
+
+	err = parseFlags(target.name, flags, target.args)
+	if err != nil {
+		return nil, err
+	}
+
+	switch o := options.(type) {
+	case *docker.Options:
+		o.RuntimeDir = toolkitDir
+	case *containerd.Options:
+		o.RuntimeDir = toolkitDir
+	case *crio.Options:
+		o.ToolkitDir = toolkitDir
+	}
+
+	return newRuntimeWithOptions(target, options), nil
+}
+
+// newJournaledRuntime creates a runtime from the options recorded in a journal
+// entry. The runtime can be reloaded independent of the current flags.
+func newJournaledRuntime(name string, options json.RawMessage) (*runtime, error) {
+	var o interface{}
+	switch name {
+	case "docker":
+		o = &docker.Options{}
+	case "containerd":
+		o = &containerd.Options{}
+	case "crio":
+		o = &crio.Options{}
+	default:
+		return nil, fmt.Errorf("unknown runtime: %v", name)
+	}
+
+	err := json.Unmarshal(options, o)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse %v options: %v", name, err)
+	}
+
+	return newRuntimeWithOptions(runtimeTarget{name: name}, o), nil
+}
+
+// newRuntimeWithOptions creates a runtime for the specified target with
+// options of the type corresponding to the target
+func newRuntimeWithOptions(target runtimeTarget, options interface{}) *runtime {
+	r := runtime{target: target, options: options}
+
+	switch o := options.(type) {
+	case *docker.Options:
+		r.setup = func(ctx context.Context, tx *transaction.Transaction) error {
+			return docker.SetupWithRollback(ctx, o, tx)
+		}
+		r.cleanup = func() error { return docker.Cleanup(o) }
+		r.reload = func() error { return docker.SignalDocker(o.Socket) }
+		r.drift = func() (string, error) { return docker.Drift(o) }
+		r.loadRuntimes = func() (engine.Interface, []string, error) {
+			cfg, names, err := docker.LoadRuntimes(o)
+			if err != nil {
+				return nil, names, err
+			}
+			return cfg, names, nil
+		}
+		r.config = o.Config
+		r.files = []string{o.Config}
+		r.dryRun = o.DryRun
+	case *containerd.Options:
+		r.setup = func(ctx context.Context, tx *transaction.Transaction) error {
+			return containerd.SetupWithRollback(ctx, o, tx)
+		}
+		r.cleanup = func() error { return containerd.Cleanup(o) }
+		r.reload = func() error { return containerd.RestartContainerd(o) }
+		r.drift = func() (string, error) { return containerd.Drift(o) }
+		r.loadRuntimes = func() (engine.Interface, []string, error) {
+			cfg, names, err := containerd.LoadRuntimes(o)
+			if err != nil {
+				return nil, names, err
+			}
+			return cfg, names, nil
+		}
+		r.config = o.Config
+		r.files = []string{o.Config}
+		if o.DropInConfig != "" {
+			r.files = append(r.files, o.DropInConfig)
+		}
+		r.dryRun = o.DryRun
+	case *crio.Options:
+		r.setup = func(ctx context.Context, tx *transaction.Transaction) error {
+			return crio.SetupWithRollback(ctx, o, tx)
+		}
+		r.cleanup = func() error { return crio.Cleanup(o) }
+		// cri-o reads the hooks when a container is created
+		r.reload = func() error { return nil }
+		r.drift = func() (string, error) { return crio.Drift(o) }
+		r.loadRuntimes = func() (engine.Interface, []string, error) {
+			cfg, names, err := crio.LoadRuntimes(o)
+			if err != nil {
+				return nil, names, err
+			}
+			return cfg, names, nil
+		}
+		r.config = crio.StatePath(o.HooksDir)
+		r.files = []string{filepath.Join(o.HooksDir, o.HookFilename)}
+		r.dryRun = o.DryRun
+	}
+
+	return &r
+}
+
+// newToolkitOptions creates the options for installing the toolkit to the
+// specified directory from the specified options in the config file, if any,
+// and the specified arguments
+func newToolkitOptions(args string, toolkitDir string, config *yaml.Node) (*toolkit.Options, error) {
+	o := toolkit.Options{}
+	flags := toolkit.Flags(&o)
+
+	err := applyConfig(&o, flags, config)
+	if err != nil {
+		return nil, fmt.Errorf("invalid toolkit options: %v", err)
+	}
+
+	err = parseFlags(toolkitCommand, flags, args)
+	if err != nil {
+		return nil, err
+	}
+	o.ToolkitDir = toolkitDir
+
+	return &o, nil
+}
+
+// parseFlags parses the specified arguments into the specified flags. The
+// arguments are split following the quoting rules of a POSIX shell, but are
+// not otherwise interpreted by a shell. Flags that are not specified are read
+// from their environment variables as for the corresponding command.
+func parseFlags(name string, flags []cli.Flag, args string) error {
+	argv, err := shlex.Split(args)
+	if err != nil {
+		return fmt.Errorf("unable to split %v arguments: %v", name, err)
+	}
+
+	c := cli.NewApp()
+	c.Name = name
+	c.Flags = flags
+	c.HideHelp = true
+	c.HideVersion = true
+	c.Writer = ioutil.Discard
+	c.ErrWriter = ioutil.Discard
+	c.Action = func(c *cli.Context) error {
+		if c.NArg() > 0 {
+			return fmt.Errorf("unexpected arguments: %v", c.Args().Slice())
+		}
+		return nil
+	}
+
+	err = c.Run(append([]string{name}, argv...))
+	if err != nil {
+		return fmt.Errorf("invalid %v arguments '%v': %v", name, args, err)
+	}
+	return nil
+}
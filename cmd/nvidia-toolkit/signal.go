@@ -0,0 +1,72 @@
+/**
+# Copyright (c) 2021, NVIDIA CORPORATION.  All rights reserved.
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#     http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// newSignalContext returns a context that is cancelled when one of the
+// specified signals is received. This aborts any setup in progress, after
+// which the changes that were already applied are cleaned up. If this does
+// not complete within the grace period, onTimeout is called. The returned
+// function releases the resources associated with the context and must be
+// called once the cleanup is complete.
+func newSignalContext(gracePeriod time.Duration, onTimeout func(), signals ...os.Signal) (context.Context, func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, signals...)
+
+	go func() {
+		select {
+		case s := <-sigs:
+			log.Infof("Received signal '%v', cleaning up", s)
+			cancel()
+		case <-done:
+			return
+		}
+
+		timer := time.NewTimer(gracePeriod)
+		defer timer.Stop()
+		for {
+			select {
+			case s := <-sigs:
+				log.Infof("Received signal '%v' while cleaning up, ignoring", s)
+			case <-timer.C:
+				log.Errorf("Cleanup did not complete within %v", gracePeriod)
+				onTimeout()
+				return
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	stop := func() {
+		signal.Stop(sigs)
+		close(done)
+		cancel()
+	}
+	return ctx, stop
+}
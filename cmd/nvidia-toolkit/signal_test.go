@@ -0,0 +1,61 @@
+/**
+# Copyright (c) 2021, NVIDIA CORPORATION.  All rights reserved.
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#     http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+*/
+
+package main
+
+import (
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSignalContext(t *testing.T) {
+	timedOut := make(chan struct{})
+	ctx, stop := newSignalContext(10*time.Millisecond, func() { close(timedOut) }, syscall.SIGUSR1)
+	defer stop()
+
+	require.NoError(t, ctx.Err())
+
+	require.NoError(t, syscall.Kill(syscall.Getpid(), syscall.SIGUSR1))
+	select {
+	case <-ctx.Done():
+	case <-time.After(time.Second):
+		require.Fail(t, "context was not cancelled by signal")
+	}
+
+	select {
+	case <-timedOut:
+	case <-time.After(time.Second):
+		require.Fail(t, "timeout was not called after grace period")
+	}
+}
+
+func TestSignalContextStopped(t *testing.T) {
+	timedOut := make(chan struct{})
+	ctx, stop := newSignalContext(10*time.Millisecond, func() { close(timedOut) }, syscall.SIGUSR1)
+
+	require.NoError(t, syscall.Kill(syscall.Getpid(), syscall.SIGUSR1))
+	<-ctx.Done()
+	stop()
+
+	select {
+	case <-timedOut:
+		require.Fail(t, "timeout was called after the cleanup completed")
+	case <-time.After(50 * time.Millisecond):
+	}
+}
@@ -0,0 +1,317 @@
+/**
+# Copyright (c) 2021, NVIDIA CORPORATION.  All rights reserved.
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#     http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"container-toolkit/internal/state"
+	"container-toolkit/pkg/config/engine"
+	"container-toolkit/pkg/toolkit"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// The phases reported in the status
+const (
+	phaseStarting    = "starting"
+	phaseWaiting     = "waiting for driver"
+	phaseSettingUp   = "setting up"
+	phaseRunning     = "running"
+	phaseReloading   = "reloading"
+	phaseReconciling = "reconciling"
+	phaseCleaningUp  = "cleaning up"
+)
+
+// status records the state of the nvidia-toolkit daemon as reported by the
+// status endpoint. It is safe for concurrent use.
+type status struct {
+	mu          sync.Mutex
+	Version     string          `json:"version"`
+	Phase       string          `json:"phase"`
+	Ready       bool            `json:"ready"`
+	StartedAt   time.Time       `json:"startedAt"`
+	ReadyAt     *time.Time      `json:"readyAt,omitempty"`
+	ReloadAt    *time.Time      `json:"lastReloadAt,omitempty"`
+	ReconcileAt *time.Time      `json:"lastReconcileAt,omitempty"`
+	Toolkit     *toolkitStatus  `json:"toolkit,omitempty"`
+	Runtimes    []runtimeStatus `json:"runtimes"`
+	LastError   *errorStatus    `json:"lastError,omitempty"`
+	WaitingFor  []string        `json:"waitingFor,omitempty"`
+}
+
+// toolkitStatus describes the installed toolkit
+type toolkitStatus struct {
+	Dir           string              `json:"dir"`
+	DriverRoot    string              `json:"driverRoot,omitempty"`
+	InstalledAt   time.Time           `json:"installedAt"`
+	RegeneratedAt *time.Time          `json:"regeneratedAt,omitempty"`
+	Components    []toolkit.Component `json:"components"`
+}
+
+// runtimeStatus describes a configured runtime target along with the entries
+// created in its config
+type runtimeStatus struct {
+	Target         string    `json:"target"`
+	Runtime        string    `json:"runtime"`
+	Config         string    `json:"config"`
+	Runtimes       []string  `json:"runtimes,omitempty"`
+	DefaultRuntime string    `json:"defaultRuntime,omitempty"`
+	Files          []string  `json:"files,omitempty"`
+	ConfiguredAt   time.Time `json:"configuredAt"`
+
+	// loadRuntimes loads the current config of the runtime target, which is
+	// used to report whether its nvidia runtimes are still configured
+	loadRuntimes func() (engine.Interface, []string, error)
+}
+
+// errorStatus describes the last error that occurred
+type errorStatus struct {
+	Message string    `json:"message"`
+	Time    time.Time `json:"time"`
+}
+
+// currentStatus is the status of the running daemon
+var currentStatus = newStatus()
+
+func newStatus() *status {
+	return &status{
+		Version:   Version,
+		Phase:     phaseStarting,
+		StartedAt: time.Now().UTC(),
+	}
+}
+
+// setPhase records the phase the daemon is in. The daemon is no longer ready
+// once it starts cleaning up.
+func (s *status) setPhase(phase string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.Phase = phase
+	if phase == phaseCleaningUp {
+		s.Ready = false
+	}
+}
+
+// setWaiting records that the daemon is waiting for the driver checks that
+// have not passed yet
+func (s *status) setWaiting(pending []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.Phase = phaseWaiting
+	s.WaitingFor = pending
+}
+
+// setReady records that the setup has fully completed
+func (s *status) setReady() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now().UTC()
+	s.Phase = phaseRunning
+	s.Ready = true
+	s.ReadyAt = &now
+}
+
+// setReloaded records that a reload of the configuration completed. The time
+// of the reload is only recorded if it succeeded; otherwise the previous
+// configuration remains in effect.
+func (s *status) setReloaded(succeeded bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.Phase = phaseRunning
+	if succeeded {
+		now := time.Now().UTC()
+		s.ReloadAt = &now
+	}
+}
+
+// setReconciled records that a check of the runtime configs completed. The
+// time is only recorded if the setup was re-applied.
+func (s *status) setReconciled(reapplied bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.Phase = phaseRunning
+	if reapplied {
+		now := time.Now().UTC()
+		s.ReconcileAt = &now
+	}
+}
+
+// setError records the specified error as the last error
+func (s *status) setError(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.LastError = &errorStatus{Message: err.Error(), Time: time.Now().UTC()}
+}
+
+// setToolkit records that the toolkit was installed with the specified options
+func (s *status) setToolkit(o *toolkit.Options) {
+	i := toolkit.NewInstaller(*o)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.Toolkit = &toolkitStatus{
+		Dir:         o.ToolkitDir,
+		DriverRoot:  o.DriverRoot,
+		InstalledAt: time.Now().UTC(),
+		Components:  i.Components(),
+	}
+}
+
+// setRegenerated records that the toolkit files that depend on the driver
+// were regenerated
+func (s *status) setRegenerated() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.Toolkit == nil {
+		return
+	}
+	now := time.Now().UTC()
+	s.Toolkit.RegeneratedAt = &now
+}
+
+// setRuntimes records that the specified runtimes are configured. The entries
+// created in their configs are read from their state.
+func (s *status) setRuntimes(targets []*runtime) {
+	now := time.Now().UTC()
+
+	var runtimes []runtimeStatus
+	for _, r := range targets {
+		rs := runtimeStatus{
+			Target:       r.target.String(),
+			Runtime:      r.target.name,
+			Config:       r.config,
+			ConfiguredAt: now,
+			loadRuntimes: r.loadRuntimes,
+		}
+
+		st, err := state.Load(r.config)
+		if err != nil {
+			log.Warnf("Unable to load state of runtime %v: %v", r.target, err)
+		}
+		if st != nil && st.Owned != nil {
+			rs.Runtimes = st.Owned.Runtimes
+			rs.DefaultRuntime = st.Owned.DefaultRuntime
+			rs.Files = st.Owned.Files
+		}
+		runtimes = append(runtimes, rs)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Runtimes = runtimes
+}
+
+// snapshot returns the status encoded as JSON
+func (s *status) snapshot() ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return json.MarshalIndent(s, "", "    ")
+}
+
+// isReady returns whether the daemon is ready along with its phase
+func (s *status) isReady() (bool, string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.Ready, s.Phase
+}
+
+// handler returns the HTTP handler serving the liveness, readiness and status
+// endpoints
+func (s *status) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, "ok")
+	})
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		ready, phase := s.isReady()
+		if !ready {
+			http.Error(w, fmt.Sprintf("not ready: %v", phase), http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprintln(w, "ready")
+	})
+	mux.HandleFunc("/status", func(w http.ResponseWriter, r *http.Request) {
+		contents, err := s.snapshot()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(append(contents, '\n'))
+	})
+	return mux
+}
+
+// listen creates a listener for the specified address. Addresses of the form
+// 'unix:PATH' or 'unix://PATH' refer to a unix socket; all other addresses
+// are TCP addresses of the form 'HOST:PORT'. A stale unix socket is removed.
+func listen(address string) (net.Listener, error) {
+	if !strings.HasPrefix(address, "unix:") {
+		return net.Listen("tcp", address)
+	}
+
+	path := strings.TrimPrefix(strings.TrimPrefix(address, "unix:"), "//")
+	err := os.Remove(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("unable to remove stale socket: %v", err)
+	}
+	return net.Listen("unix", path)
+}
+
+// startServer serves the specified handler on the specified address in the
+// background. The returned function stops the server.
+func startServer(address string, handler http.Handler) (func(), error) {
+	l, err := listen(address)
+	if err != nil {
+		return nil, fmt.Errorf("unable to listen on '%v': %v", address, err)
+	}
+
+	server := &http.Server{Handler: handler}
+	go func() {
+		log.Infof("Serving status on '%v'", address)
+		err := server.Serve(l)
+		if err != nil && err != http.ErrServerClosed {
+			log.Errorf("Unable to serve status: %v", err)
+		}
+	}()
+
+	stop := func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		server.Shutdown(ctx)
+	}
+	return stop, nil
+}
@@ -0,0 +1,115 @@
+/**
+# Copyright (c) 2021, NVIDIA CORPORATION.  All rights reserved.
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#     http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestStatusHandler(t *testing.T) {
+	s := newStatus()
+	server := httptest.NewServer(s.handler())
+	defer server.Close()
+
+	get := func(path string) (int, string) {
+		resp, err := http.Get(server.URL + path)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		body, err := ioutil.ReadAll(resp.Body)
+		require.NoError(t, err)
+		return resp.StatusCode, string(body)
+	}
+
+	code, _ := get("/healthz")
+	require.Equal(t, http.StatusOK, code)
+
+	code, body := get("/readyz")
+	require.Equal(t, http.StatusServiceUnavailable, code)
+	require.Contains(t, body, phaseStarting)
+
+	s.setPhase(phaseSettingUp)
+	s.setError(fmt.Errorf("test error"))
+	s.setRuntimes([]*runtime{{target: runtimeTarget{name: "docker"}, config: "/does/not/exist/daemon.json"}})
+	s.setReady()
+
+	code, _ = get("/readyz")
+	require.Equal(t, http.StatusOK, code)
+
+	code, body = get("/status")
+	require.Equal(t, http.StatusOK, code)
+
+	var reported struct {
+		Phase     string `json:"phase"`
+		Ready     bool   `json:"ready"`
+		ReadyAt   string `json:"readyAt"`
+		LastError struct {
+			Message string `json:"message"`
+		} `json:"lastError"`
+		Runtimes []struct {
+			Runtime string `json:"runtime"`
+			Config  string `json:"config"`
+		} `json:"runtimes"`
+	}
+	require.NoError(t, json.Unmarshal([]byte(body), &reported))
+	require.Equal(t, phaseRunning, reported.Phase)
+	require.True(t, reported.Ready)
+	require.NotEmpty(t, reported.ReadyAt)
+	require.Equal(t, "test error", reported.LastError.Message)
+	require.Len(t, reported.Runtimes, 1)
+	require.Equal(t, "docker", reported.Runtimes[0].Runtime)
+
+	s.setPhase(phaseCleaningUp)
+	code, _ = get("/readyz")
+	require.Equal(t, http.StatusServiceUnavailable, code)
+}
+
+func TestStartServerUnixSocket(t *testing.T) {
+	dir, err := ioutil.TempDir("", "nvidia-toolkit-test-")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	socket := filepath.Join(dir, "toolkit.sock")
+	// A stale socket is replaced
+	require.NoError(t, ioutil.WriteFile(socket, nil, 0600))
+
+	stop, err := startServer("unix://"+socket, newStatus().handler())
+	require.NoError(t, err)
+	defer stop()
+
+	client := http.Client{
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				return net.Dial("unix", socket)
+			},
+		},
+	}
+	resp, err := client.Get("http://unix/healthz")
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+}
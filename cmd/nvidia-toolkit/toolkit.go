@@ -0,0 +1,94 @@
+/**
+# Copyright (c) 2021, NVIDIA CORPORATION.  All rights reserved.
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#     http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+*/
+
+package main
+
+import (
+	"container-toolkit/pkg/toolkit"
+
+	cli "github.com/urfave/cli/v2"
+)
+
+// newToolkitCommand creates the 'toolkit' command for managing the NVIDIA
+// container toolkit
+func newToolkitCommand() *cli.Command {
+	options := toolkit.Options{}
+
+	// Create the 'install' subcommand
+	install := cli.Command{}
+	install.Name = "install"
+	install.Usage = "Install the components of the NVIDIA container toolkit"
+	install.ArgsUsage = "<toolkit_directory>"
+	install.Before = func(c *cli.Context) error {
+		return parseToolkitDirArg(c, &options)
+	}
+	install.Action = func(c *cli.Context) error {
+		return toolkit.NewInstaller(options).Install()
+	}
+
+	// Create the 'delete' command
+	delete := cli.Command{}
+	delete.Name = "delete"
+	delete.Usage = "Delete the NVIDIA container toolkit"
+	delete.ArgsUsage = "<toolkit_directory>"
+	delete.Before = func(c *cli.Context) error {
+		return parseToolkitDirArg(c, &options)
+	}
+	delete.Action = func(c *cli.Context) error {
+		return toolkit.NewInstaller(options).Delete()
+	}
+
+	// Create the 'verify' command
+	verify := cli.Command{}
+	verify.Name = "verify"
+	verify.Usage = "Verify that the NVIDIA container toolkit is installed"
+	verify.ArgsUsage = "<toolkit_directory>"
+	verify.Before = func(c *cli.Context) error {
+		return parseToolkitDirArg(c, &options)
+	}
+	verify.Action = func(c *cli.Context) error {
+		return toolkit.NewInstaller(options).Verify()
+	}
+
+	// Update the subcommand flags with the common subcommand flags
+	install.Flags = toolkit.Flags(&options)
+	delete.Flags = []cli.Flag{toolkit.DryRunFlag(&options)}
+	verify.Flags = []cli.Flag{toolkit.DriverRootFlag(&options)}
+
+	// Create the 'toolkit' command
+	c := cli.Command{}
+	c.Name = toolkitCommand
+	c.Usage = "Manage the NVIDIA container toolkit"
+	c.Subcommands = []*cli.Command{
+		&install,
+		&delete,
+		&verify,
+	}
+
+	return &c
+}
+
+// parseToolkitDirArg parses the toolkit directory from the command line
+// arguments into the specified options
+func parseToolkitDirArg(c *cli.Context, o *toolkit.Options) error {
+	toolkitDir, err := parseDirArg(c)
+	if err != nil {
+		return err
+	}
+	o.ToolkitDir = toolkitDir
+
+	return nil
+}
@@ -0,0 +1,255 @@
+/**
+# Copyright (c) 2021, NVIDIA CORPORATION.  All rights reserved.
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#     http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+	"unsafe"
+
+	"container-toolkit/internal/journal"
+	"container-toolkit/internal/transaction"
+
+	log "github.com/sirupsen/logrus"
+	unix "golang.org/x/sys/unix"
+)
+
+const (
+	// watchSettleDelay is the minimum time between a change to a config and
+	// the check of the configs. This allows a process that writes a config in
+	// several steps to complete.
+	watchSettleDelay = time.Second
+
+	// watchMask selects the inotify events that indicate that a file in a
+	// watched directory was written, replaced or removed
+	watchMask = unix.IN_CLOSE_WRITE | unix.IN_CREATE | unix.IN_DELETE | unix.IN_MOVED_FROM | unix.IN_MOVED_TO
+)
+
+// watcher reports changes to a set of files using inotify. The directories
+// containing the files are watched instead of the files themselves so that
+// files that are replaced (e.g. by renaming a temporary file) or that are
+// removed and created again are also reported.
+type watcher struct {
+	file *os.File
+	// dirs maps the inotify watch descriptors to the watched directories
+	dirs map[int]string
+	// files holds the paths of the files for which changes are reported
+	files  map[string]struct{}
+	events chan string
+}
+
+// newWatcher creates a watcher for the specified files. The directories
+// containing the files must exist.
+func newWatcher(paths []string) (*watcher, error) {
+	fd, err := unix.InotifyInit1(unix.IN_CLOEXEC | unix.IN_NONBLOCK)
+	if err != nil {
+		return nil, fmt.Errorf("unable to initialize inotify: %v", err)
+	}
+
+	w := &watcher{
+		file:   os.NewFile(uintptr(fd), "inotify"),
+		dirs:   make(map[int]string),
+		files:  make(map[string]struct{}),
+		events: make(chan string, 1),
+	}
+
+	watched := make(map[string]bool)
+	for _, path := range paths {
+		path = filepath.Clean(path)
+		w.files[path] = struct{}{}
+
+		dir := filepath.Dir(path)
+		if watched[dir] {
+			continue
+		}
+
+		wd, err := unix.InotifyAddWatch(fd, dir, watchMask)
+		if err != nil {
+			w.close()
+			return nil, fmt.Errorf("unable to watch %v: %v", dir, err)
+		}
+		w.dirs[wd] = dir
+		watched[dir] = true
+		log.Infof("Watching %v for changes", path)
+	}
+
+	go w.run()
+
+	return w, nil
+}
+
+// changes returns the channel on which the paths of changed files are
+// reported. Changes that occur while a previous change is pending are
+// coalesced. The channel is closed once the watcher is closed.
+func (w *watcher) changes() <-chan string {
+	if w == nil {
+		return nil
+	}
+	return w.events
+}
+
+// close stops watching for changes
+func (w *watcher) close() {
+	if w == nil {
+		return
+	}
+	w.file.Close()
+}
+
+// run reads inotify events until the watcher is closed
+func (w *watcher) run() {
+	defer close(w.events)
+
+	buf := make([]byte, 64*(unix.SizeofInotifyEvent+unix.NAME_MAX+1))
+	for {
+		n, err := w.file.Read(buf)
+		if err != nil {
+			if !errors.Is(err, os.ErrClosed) {
+				log.Errorf("Unable to read inotify events: %v", err)
+			}
+			return
+		}
+
+		for offset := 0; offset+unix.SizeofInotifyEvent <= n; {
+			event := (*unix.InotifyEvent)(unsafe.Pointer(&buf[offset]))
+			start := offset + unix.SizeofInotifyEvent
+			offset = start + int(event.Len)
+
+			if event.Mask&unix.IN_Q_OVERFLOW != 0 {
+				// Events were dropped, so any of the files may have changed
+				for path := range w.files {
+					w.notify(path)
+				}
+				continue
+			}
+
+			dir, exists := w.dirs[int(event.Wd)]
+			if !exists || event.Len == 0 {
+				continue
+			}
+
+			path := filepath.Join(dir, strings.TrimRight(string(buf[start:offset]), "\x00"))
+			if _, watched := w.files[path]; watched {
+				w.notify(path)
+			}
+		}
+	}
+}
+
+// notify reports a change to the specified file unless a change is already
+// pending
+func (w *watcher) notify(path string) {
+	select {
+	case w.events <- path:
+	default:
+	}
+}
+
+// watchRuntimes creates a watcher for the configs of the specified runtimes.
+// If watching is disabled or none of the runtimes have configs to watch, nil
+// is returned.
+func watchRuntimes(targets []*runtime) (*watcher, error) {
+	if !watchConfigsFlag {
+		return nil, nil
+	}
+
+	var paths []string
+	for _, r := range targets {
+		if r.dryRun {
+			continue
+		}
+		paths = append(paths, r.files...)
+	}
+	if len(paths) == 0 {
+		return nil, nil
+	}
+
+	return newWatcher(paths)
+}
+
+// startWatching creates a watcher for the configs of the current runtimes. A
+// failure to watch the configs is logged and results in a nil watcher, since
+// it does not affect the runtimes that are set up.
+func startWatching() *watcher {
+	w, err := watchRuntimes(runtimes)
+	if err != nil {
+		log.Errorf("Unable to watch runtime configs: %v", err)
+		currentStatus.setError(err)
+		return nil
+	}
+	return w
+}
+
+// reconcileDelay returns the time to wait before checking the runtime configs
+// after a change. The configs are checked at most once per watch interval.
+func reconcileDelay(lastReconcile time.Time) time.Duration {
+	delay := watchIntervalFlag - time.Since(lastReconcile)
+	if delay < watchSettleDelay {
+		return watchSettleDelay
+	}
+	return delay
+}
+
+// reconcile re-applies the setup of the runtimes whose configs no longer
+// contain the expected nvidia runtimes, e.g. because another agent on the node
+// overwrote them. The differences to the expected configs are logged. The
+// return value indicates whether the setup was re-applied.
+func reconcile(ctx context.Context, j *journal.Journal) (bool, error) {
+	var drifted []*runtime
+	for _, r := range runtimes {
+		if r.dryRun {
+			continue
+		}
+
+		diff, err := r.drift()
+		if err != nil {
+			return false, fmt.Errorf("unable to check config of %v: %v", r.target, err)
+		}
+		if diff == "" {
+			continue
+		}
+
+		log.Warnf("Config of runtime %v differs from the expected config:\n%v", r.target, diff)
+		drifted = append(drifted, r)
+	}
+
+	if len(drifted) == 0 {
+		log.Infof("Runtime configs are as expected")
+		return false, nil
+	}
+
+	err := transaction.Run(func(tx *transaction.Transaction) error {
+		err := tx.BackupFile(j.Path())
+		if err != nil {
+			return fmt.Errorf("unable to back up journal: %v", err)
+		}
+
+		return setupRuntime(ctx, tx, j, drifted)
+	})
+	if err != nil {
+		return false, fmt.Errorf("unable to re-apply runtime setup: %v", err)
+	}
+
+	currentStatus.setRuntimes(runtimes)
+
+	return true, rewriteJournal(j, runtimes)
+}
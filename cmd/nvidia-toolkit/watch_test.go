@@ -0,0 +1,141 @@
+/**
+# Copyright (c) 2021, NVIDIA CORPORATION.  All rights reserved.
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#     http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"container-toolkit/internal/journal"
+	"container-toolkit/internal/transaction"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWatcher(t *testing.T) {
+	dir, err := ioutil.TempDir("", "nvidia-toolkit-test-")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	config := filepath.Join(dir, "config.toml")
+
+	w, err := newWatcher([]string{config})
+	require.NoError(t, err)
+	defer w.close()
+
+	// A single operation may result in several events (e.g. IN_CREATE and
+	// IN_CLOSE_WRITE), so all changes reported for an operation are read.
+	expectChange := func(expected bool) {
+		changed := false
+		for {
+			select {
+			case path := <-w.changes():
+				require.Equal(t, config, path)
+				changed = true
+				continue
+			case <-time.After(100 * time.Millisecond):
+			}
+			break
+		}
+		require.Equal(t, expected, changed)
+	}
+
+	// Other files in the directory are ignored
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "other.toml"), []byte("a"), 0644))
+	expectChange(false)
+
+	require.NoError(t, ioutil.WriteFile(config, []byte("a"), 0644))
+	expectChange(true)
+
+	// Replacing the file is reported
+	temp := filepath.Join(dir, ".config.toml.tmp")
+	require.NoError(t, ioutil.WriteFile(temp, []byte("b"), 0644))
+	require.NoError(t, os.Rename(temp, config))
+	expectChange(true)
+
+	require.NoError(t, os.Remove(config))
+	expectChange(true)
+
+	w.close()
+	for range w.changes() {
+	}
+}
+
+func TestReconcileDelay(t *testing.T) {
+	watchIntervalFlag = time.Minute
+	defer func() { watchIntervalFlag = defaultWatchInterval }()
+
+	require.Equal(t, watchSettleDelay, reconcileDelay(time.Time{}))
+	require.InDelta(t, float64(time.Minute), float64(reconcileDelay(time.Now())), float64(time.Second))
+}
+
+func TestReconcile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "nvidia-toolkit-test-")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	hooksDir := filepath.Join(dir, "hooks")
+	hookPath := filepath.Join(hooksDir, "oci-nvidia-hook.json")
+
+	destinationArg = dir
+	require.NoError(t, parseRunFlags("--runtime-target=crio:--hooks-dir="+hooksDir))
+
+	j := journal.New(filepath.Join(dir, "toolkit.journal"), "1.2.3")
+	err = transaction.Run(func(tx *transaction.Transaction) error {
+		return setupRuntime(context.Background(), tx, j, runtimes)
+	})
+	require.NoError(t, err)
+
+	reapplied, err := reconcile(context.Background(), j)
+	require.NoError(t, err)
+	require.False(t, reapplied)
+
+	// A hook that was removed is restored
+	require.NoError(t, os.Remove(hookPath))
+	reapplied, err = reconcile(context.Background(), j)
+	require.NoError(t, err)
+	require.True(t, reapplied)
+	require.FileExists(t, hookPath)
+
+	// A hook that was overwritten is restored
+	require.NoError(t, ioutil.WriteFile(hookPath, []byte(`{"version": "1.0.0", "hook": {"path": "/bin/true"}}`), 0644))
+	reapplied, err = reconcile(context.Background(), j)
+	require.NoError(t, err)
+	require.True(t, reapplied)
+
+	reapplied, err = reconcile(context.Background(), j)
+	require.NoError(t, err)
+	require.False(t, reapplied)
+
+	// The setups that are applied again are merged into the first setup
+	require.Len(t, journalSetups(t, j), 1)
+
+	entries, err := j.Load()
+	require.NoError(t, err)
+	for _, e := range entries {
+		if e.Op == journal.OpWriteFile && e.Path == hookPath {
+			checksum, err := journal.Checksum(hookPath)
+			require.NoError(t, err)
+			require.Nil(t, e.Backup)
+			require.Equal(t, checksum, e.Checksum)
+		}
+	}
+}
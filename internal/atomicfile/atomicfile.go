@@ -0,0 +1,183 @@
+/**
+# Copyright (c) 2021, NVIDIA CORPORATION.  All rights reserved.
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#     http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+*/
+
+package atomicfile
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+
+	unix "golang.org/x/sys/unix"
+)
+
+// WriteFile writes data to the specified file such that readers either see
+// the previous or the new contents of the file, even if the process crashes
+// or the disk fills up during the write. The data is written to a temporary
+// file in the same directory which is synced to disk and renamed over the
+// original file.
+//
+// If the file exists, its mode, ownership, and extended attributes (including
+// SELinux labels) are applied to the new file. Otherwise the file is created
+// with the specified permissions. If the path is a symlink, its target is
+// replaced.
+func WriteFile(path string, data []byte, perm os.FileMode) (rerr error) {
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		path = resolved
+	}
+
+	info, err := os.Stat(path)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("unable to stat '%v': %v", path, err)
+	}
+	if info != nil && info.IsDir() {
+		return fmt.Errorf("'%v' is a directory", path)
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+".tmp")
+	if err != nil {
+		return fmt.Errorf("unable to create temporary file: %v", err)
+	}
+	defer func() {
+		if rerr != nil {
+			tmp.Close()
+			os.Remove(tmp.Name())
+		}
+	}()
+
+	_, err = tmp.Write(data)
+	if err != nil {
+		return fmt.Errorf("unable to write temporary file: %v", err)
+	}
+
+	if info == nil {
+		err = tmp.Chmod(perm)
+	} else {
+		err = applyAttributes(tmp, path, info)
+	}
+	if err != nil {
+		return err
+	}
+
+	err = tmp.Sync()
+	if err != nil {
+		return fmt.Errorf("unable to sync temporary file: %v", err)
+	}
+
+	err = tmp.Close()
+	if err != nil {
+		return fmt.Errorf("unable to close temporary file: %v", err)
+	}
+
+	err = os.Rename(tmp.Name(), path)
+	if err != nil {
+		return fmt.Errorf("unable to rename temporary file: %v", err)
+	}
+
+	return syncDir(filepath.Dir(path))
+}
+
+// applyAttributes applies the mode, ownership, and extended attributes of the
+// file at path to the specified file.
+func applyAttributes(f *os.File, path string, info os.FileInfo) error {
+	if stat, ok := info.Sys().(*syscall.Stat_t); ok {
+		err := f.Chown(int(stat.Uid), int(stat.Gid))
+		if err != nil {
+			return fmt.Errorf("unable to set ownership: %v", err)
+		}
+	}
+
+	// The mode is set after the ownership since chown clears the setuid and
+	// setgid bits.
+	err := f.Chmod(info.Mode())
+	if err != nil {
+		return fmt.Errorf("unable to set mode: %v", err)
+	}
+
+	names, err := listXattrs(path)
+	if err != nil {
+		return fmt.Errorf("unable to list extended attributes: %v", err)
+	}
+
+	for _, name := range names {
+		value, err := getXattr(path, name)
+		if err != nil {
+			return fmt.Errorf("unable to get extended attribute %v: %v", name, err)
+		}
+		err = unix.Fsetxattr(int(f.Fd()), name, value, 0)
+		if err != nil {
+			return fmt.Errorf("unable to set extended attribute %v: %v", name, err)
+		}
+	}
+
+	return nil
+}
+
+func listXattrs(path string) ([]string, error) {
+	size, err := unix.Llistxattr(path, nil)
+	if err == unix.ENOTSUP || err == unix.ENODATA {
+		return nil, nil
+	}
+	if err != nil || size == 0 {
+		return nil, err
+	}
+
+	buf := make([]byte, size)
+	size, err = unix.Llistxattr(path, buf)
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for _, name := range bytes.Split(buf[:size], []byte{0}) {
+		if len(name) > 0 {
+			names = append(names, string(name))
+		}
+	}
+	return names, nil
+}
+
+func getXattr(path string, name string) ([]byte, error) {
+	size, err := unix.Lgetxattr(path, name, nil)
+	if err != nil || size == 0 {
+		return nil, err
+	}
+
+	value := make([]byte, size)
+	size, err = unix.Lgetxattr(path, name, value)
+	if err != nil {
+		return nil, err
+	}
+	return value[:size], nil
+}
+
+// syncDir ensures that a rename in the specified directory is persisted
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return fmt.Errorf("unable to open directory '%v': %v", dir, err)
+	}
+	defer d.Close()
+
+	err = d.Sync()
+	if err != nil {
+		return fmt.Errorf("unable to sync directory '%v': %v", dir, err)
+	}
+	return nil
+}
@@ -0,0 +1,103 @@
+/**
+# Copyright (c) 2021, NVIDIA CORPORATION.  All rights reserved.
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#     http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+*/
+
+package atomicfile
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	unix "golang.org/x/sys/unix"
+)
+
+func TestWriteFileCreatesFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "atomicfile-test-")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "daemon.json")
+	err = WriteFile(path, []byte("{}"), 0640)
+	require.NoError(t, err)
+
+	contents, err := ioutil.ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, "{}", string(contents))
+
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0640), info.Mode().Perm())
+
+	entries, err := ioutil.ReadDir(dir)
+	require.NoError(t, err)
+	require.Len(t, entries, 1, "temporary files must be removed")
+}
+
+func TestWriteFilePreservesAttributes(t *testing.T) {
+	dir, err := ioutil.TempDir("", "atomicfile-test-")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "config.toml")
+	require.NoError(t, ioutil.WriteFile(path, []byte("version = 2\n"), 0600))
+
+	err = unix.Setxattr(path, "user.test", []byte("value"), 0)
+	xattrSupported := err == nil
+
+	err = WriteFile(path, []byte("version = 3\n"), 0644)
+	require.NoError(t, err)
+
+	contents, err := ioutil.ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, "version = 3\n", string(contents))
+
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	if !xattrSupported {
+		t.Log("Extended attributes are not supported; skipping check")
+		return
+	}
+	value := make([]byte, 16)
+	size, err := unix.Getxattr(path, "user.test", value)
+	require.NoError(t, err)
+	require.Equal(t, "value", string(value[:size]))
+}
+
+func TestWriteFileReplacesSymlinkTarget(t *testing.T) {
+	dir, err := ioutil.TempDir("", "atomicfile-test-")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	target := filepath.Join(dir, "target.json")
+	link := filepath.Join(dir, "daemon.json")
+	require.NoError(t, ioutil.WriteFile(target, []byte("{}"), 0644))
+	require.NoError(t, os.Symlink(target, link))
+
+	err = WriteFile(link, []byte(`{"debug": true}`), 0644)
+	require.NoError(t, err)
+
+	info, err := os.Lstat(link)
+	require.NoError(t, err)
+	require.True(t, info.Mode()&os.ModeSymlink != 0)
+
+	contents, err := ioutil.ReadFile(target)
+	require.NoError(t, err)
+	require.Equal(t, `{"debug": true}`, string(contents))
+}
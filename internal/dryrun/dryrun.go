@@ -0,0 +1,123 @@
+/**
+# Copyright (c) 2021, NVIDIA CORPORATION.  All rights reserved.
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#     http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+*/
+
+package dryrun
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/pmezard/go-difflib/difflib"
+	log "github.com/sirupsen/logrus"
+)
+
+// Output is the writer to which the changes computed in dry-run mode are
+// reported. Logging is written to stderr so that the output can be reviewed
+// or stored separately.
+var Output io.Writer = os.Stdout
+
+// Diff returns a unified diff of the changes to the specified file. A nil
+// value for original or updated indicates that the file does not exist before
+// or after the change, respectively. If there are no changes, the empty string
+// is returned.
+func Diff(path string, original []byte, updated []byte) (string, error) {
+	fromFile := path
+	if original == nil {
+		fromFile = os.DevNull
+	}
+	toFile := path
+	if updated == nil {
+		toFile = os.DevNull
+	}
+
+	diff := difflib.UnifiedDiff{
+		A:        splitLines(original),
+		B:        splitLines(updated),
+		FromFile: fromFile,
+		ToFile:   toFile,
+		Context:  3,
+	}
+
+	output, err := difflib.GetUnifiedDiffString(diff)
+	if err != nil {
+		return "", fmt.Errorf("unable to compute diff for '%v': %v", path, err)
+	}
+	return output, nil
+}
+
+// PrintDiff writes a unified diff of the changes to the specified file to the
+// dry-run output.
+func PrintDiff(path string, original []byte, updated []byte) error {
+	output, err := Diff(path, original, updated)
+	if err != nil {
+		return err
+	}
+	if output == "" {
+		log.Infof("No changes to '%v'", path)
+		return nil
+	}
+
+	_, err = io.WriteString(Output, output)
+	if err != nil {
+		return fmt.Errorf("unable to write diff: %v", err)
+	}
+	return nil
+}
+
+// PrintOperation writes a file operation that would be performed to the
+// dry-run output. e.g. PrintOperation("symlink", "/a/b", "c") results in
+// "symlink /a/b c".
+func PrintOperation(operation string, args ...string) error {
+	_, err := fmt.Fprintln(Output, strings.Join(append([]string{operation}, args...), " "))
+	if err != nil {
+		return fmt.Errorf("unable to write operation: %v", err)
+	}
+	return nil
+}
+
+// ReadFile returns the current contents of the specified file. If the file
+// does not exist, nil is returned.
+func ReadFile(path string) ([]byte, error) {
+	contents, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to read '%v': %v", path, err)
+	}
+	if contents == nil {
+		contents = []byte{}
+	}
+	return contents, nil
+}
+
+// splitLines splits the specified contents into lines, keeping the line
+// endings as expected by difflib.
+func splitLines(contents []byte) []string {
+	if len(contents) == 0 {
+		return nil
+	}
+	lines := difflib.SplitLines(string(contents))
+	// SplitLines appends a newline to the last line, resulting in an empty
+	// trailing line for contents that end in a newline.
+	if strings.HasSuffix(string(contents), "\n") {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
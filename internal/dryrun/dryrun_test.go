@@ -0,0 +1,63 @@
+/**
+# Copyright (c) 2021, NVIDIA CORPORATION.  All rights reserved.
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#     http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+*/
+
+package dryrun
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiff(t *testing.T) {
+	testCases := []struct {
+		description string
+		original    []byte
+		updated     []byte
+		expected    string
+	}{
+		{
+			description: "no changes",
+			original:    []byte("a\nb\n"),
+			updated:     []byte("a\nb\n"),
+			expected:    "",
+		},
+		{
+			description: "file does not exist",
+			updated:     []byte("a\n"),
+			expected:    "--- /dev/null\n+++ /etc/config\n@@ -0,0 +1 @@\n+a\n",
+		},
+		{
+			description: "file is removed",
+			original:    []byte("a\n"),
+			expected:    "--- /etc/config\n+++ /dev/null\n@@ -1 +0,0 @@\n-a\n",
+		},
+		{
+			description: "line is changed",
+			original:    []byte("a\nb\nc\n"),
+			updated:     []byte("a\nB\nc\n"),
+			expected:    "--- /etc/config\n+++ /etc/config\n@@ -1,3 +1,3 @@\n a\n-b\n+B\n c\n",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			diff, err := Diff("/etc/config", tc.original, tc.updated)
+			require.NoError(t, err)
+			require.Equal(t, tc.expected, diff)
+		})
+	}
+}
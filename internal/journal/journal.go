@@ -0,0 +1,300 @@
+/**
+# Copyright (c) 2021, NVIDIA CORPORATION.  All rights reserved.
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#     http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+*/
+
+package journal
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"container-toolkit/internal/atomicfile"
+	"container-toolkit/pkg/config/engine"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// The operations recorded in the journal
+const (
+	// OpInstallToolkit records that the toolkit was installed to Path
+	OpInstallToolkit = "install-toolkit"
+	// OpSetupRuntime records that a runtime was set up with Options. The
+	// changes made by the setup are recorded by the entries following it.
+	OpSetupRuntime = "setup-runtime"
+	// OpWriteFile records that the file at Path was written. Backup holds the
+	// previous contents of the file and is nil if the file did not exist.
+	OpWriteFile = "write-file"
+	// OpCreateDir records that the directory at Path was created
+	OpCreateDir = "create-dir"
+	// OpAddRuntime records that the runtime Name was added to the config of
+	// the Runtime at Path
+	OpAddRuntime = "add-runtime"
+	// OpSetDefaultRuntime records that the runtime Name was set as the default
+	// runtime in the config of the Runtime at Path, replacing Previous
+	OpSetDefaultRuntime = "set-default-runtime"
+	// OpCreateHook records that the cri-o prestart hook at Path was created
+	OpCreateHook = "create-hook"
+)
+
+// Entry is a single change recorded in the journal
+type Entry struct {
+	Time    time.Time `json:"time"`
+	Version string    `json:"version"`
+	Op      string    `json:"op"`
+	// Runtime is the runtime (docker, containerd or crio) the change was
+	// made for
+	Runtime string `json:"runtime,omitempty"`
+	Path    string `json:"path,omitempty"`
+	// Options are the options the runtime was set up with
+	Options json.RawMessage `json:"options,omitempty"`
+	// Name is the runtime that was added or set as the default runtime
+	Name string `json:"name,omitempty"`
+	// Previous is the default runtime that was replaced, if any
+	Previous string `json:"previous,omitempty"`
+	// Backup is the previous contents of a file that was written
+	Backup *Backup `json:"backup,omitempty"`
+	// Committed is set once the change to a file is committed, in which case
+	// Checksum is the checksum of the file as written. The file is not
+	// restored if it was modified since.
+	Committed bool   `json:"committed,omitempty"`
+	Checksum  string `json:"checksum,omitempty"`
+}
+
+// Backup is the contents of a file before it was written
+type Backup struct {
+	Contents []byte      `json:"contents"`
+	Mode     os.FileMode `json:"mode"`
+}
+
+func (e Entry) String() string {
+	s := e.Op
+	if e.Runtime != "" {
+		s += " " + e.Runtime
+	}
+	if e.Name != "" {
+		s += " " + e.Name
+	}
+	if e.Path != "" {
+		s += fmt.Sprintf(" (%v)", e.Path)
+	}
+	return s
+}
+
+// Journal is a file recording the changes made to the host, one JSON encoded
+// entry per line. Entries are appended as the changes are made so that these
+// can be undone even if the process that made them did not exit cleanly.
+type Journal struct {
+	path    string
+	version string
+}
+
+// New creates a journal stored at the specified path. Appended entries are
+// recorded with the specified toolkit version.
+func New(path string, version string) *Journal {
+	return &Journal{path: path, version: version}
+}
+
+// Path returns the path at which the journal is stored
+func (j *Journal) Path() string {
+	return j.path
+}
+
+// Append appends the specified entries to the journal and syncs it to disk
+func (j *Journal) Append(entries ...Entry) error {
+	err := os.MkdirAll(filepath.Dir(j.path), 0755)
+	if err != nil {
+		return fmt.Errorf("unable to create journal directory: %v", err)
+	}
+
+	f, err := os.OpenFile(j.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return fmt.Errorf("unable to open journal: %v", err)
+	}
+	defer f.Close()
+
+	for _, e := range entries {
+		line, err := j.encode(e)
+		if err != nil {
+			return err
+		}
+		_, err = f.Write(line)
+		if err != nil {
+			return fmt.Errorf("unable to write journal entry: %v", err)
+		}
+	}
+
+	err = f.Sync()
+	if err != nil {
+		return fmt.Errorf("unable to sync journal: %v", err)
+	}
+	return nil
+}
+
+// Load reads the entries of the journal. If the journal does not exist, no
+// entries are returned. A partially written last entry (e.g. if the process
+// was killed while appending it) is ignored.
+func (j *Journal) Load() ([]Entry, error) {
+	contents, err := ioutil.ReadFile(j.path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to read journal: %v", err)
+	}
+
+	lines := bytes.Split(contents, []byte("\n"))
+	var entries []Entry
+	for i, line := range lines {
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+
+		var e Entry
+		err := json.Unmarshal(line, &e)
+		if err != nil && i == len(lines)-1 {
+			log.Warnf("Ignoring incomplete entry at the end of journal '%v'", j.path)
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse journal entry on line %v: %v", i+1, err)
+		}
+		entries = append(entries, e)
+	}
+
+	return entries, nil
+}
+
+// Commit marks the entries recording the writes of the specified files as
+// committed, along with the checksums of the files as written
+func (j *Journal) Commit(paths []string) error {
+	written := make(map[string]bool)
+	for _, path := range paths {
+		written[path] = true
+	}
+
+	entries, err := j.Load()
+	if err != nil {
+		return err
+	}
+
+	for i, e := range entries {
+		if e.Op != OpWriteFile || e.Committed || !written[e.Path] {
+			continue
+		}
+
+		checksum, err := Checksum(e.Path)
+		if err != nil {
+			return err
+		}
+		entries[i].Committed = true
+		entries[i].Checksum = checksum
+	}
+
+	return j.Replace(entries)
+}
+
+// Replace replaces the entries of the journal with the specified entries. If
+// no entries are specified, the journal is removed. As for Append, entries
+// without a time or version are recorded with the current time and version.
+func (j *Journal) Replace(entries []Entry) error {
+	if len(entries) == 0 {
+		return j.Remove()
+	}
+
+	var contents []byte
+	for _, e := range entries {
+		line, err := j.encode(e)
+		if err != nil {
+			return err
+		}
+		contents = append(contents, line...)
+	}
+
+	err := atomicfile.WriteFile(j.path, contents, 0600)
+	if err != nil {
+		return fmt.Errorf("unable to write journal: %v", err)
+	}
+	return nil
+}
+
+// encode encodes the specified entry as a line of the journal. The current
+// time and the version of the journal are filled in if not set.
+func (j *Journal) encode(e Entry) ([]byte, error) {
+	if e.Time.IsZero() {
+		e.Time = time.Now().UTC()
+	}
+	if e.Version == "" {
+		e.Version = j.version
+	}
+
+	line, err := json.Marshal(e)
+	if err != nil {
+		return nil, fmt.Errorf("unable to encode journal entry: %v", err)
+	}
+	return append(line, '\n'), nil
+}
+
+// Remove removes the journal
+func (j *Journal) Remove() error {
+	err := os.Remove(j.path)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("unable to remove journal: %v", err)
+	}
+	return nil
+}
+
+// Checksum returns the checksum of the contents of the file at the specified
+// path. The empty string is returned if the file does not exist.
+func Checksum(path string) (string, error) {
+	contents, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("unable to read '%v': %v", path, err)
+	}
+
+	sum := sha256.Sum256(contents)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// RuntimeChanges returns the entries recording the changes made to the config
+// of the specified runtime at the specified path when the specified runtimes
+// are added to it and the specified default runtime is set. Runtimes that
+// already exist and a default runtime that is already set are not recorded,
+// since these are not changed.
+func RuntimeChanges(runtime string, path string, c engine.Interface, names []string, defaultRuntime string) []Entry {
+	var entries []Entry
+	for _, name := range names {
+		if c.HasRuntime(name) {
+			continue
+		}
+		entries = append(entries, Entry{Op: OpAddRuntime, Runtime: runtime, Path: path, Name: name})
+	}
+
+	current := c.DefaultRuntime()
+	if defaultRuntime != "" && defaultRuntime != current {
+		entries = append(entries, Entry{Op: OpSetDefaultRuntime, Runtime: runtime, Path: path, Name: defaultRuntime, Previous: current})
+	}
+
+	return entries
+}
@@ -0,0 +1,176 @@
+/**
+# Copyright (c) 2021, NVIDIA CORPORATION.  All rights reserved.
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#     http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+*/
+
+package journal
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	engine "container-toolkit/pkg/config/engine/docker"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAppendAndLoad(t *testing.T) {
+	dir, err := ioutil.TempDir("", "journal-test-")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	j := New(filepath.Join(dir, "nvidia", "toolkit.journal"), "1.2.3")
+
+	entries, err := j.Load()
+	require.NoError(t, err)
+	require.Empty(t, entries)
+
+	require.NoError(t, j.Append(Entry{Op: OpInstallToolkit, Path: "/usr/local/nvidia/toolkit"}))
+	require.NoError(t, j.Append(
+		Entry{Op: OpSetupRuntime, Runtime: "docker", Options: []byte(`{"Config":"/etc/docker/daemon.json"}`)},
+		Entry{Op: OpSetupRuntime, Runtime: "crio", Options: []byte(`{"HooksDir":"/usr/share/containers/oci/hooks.d"}`)},
+	))
+
+	entries, err = j.Load()
+	require.NoError(t, err)
+	require.Len(t, entries, 3)
+	for _, e := range entries {
+		require.Equal(t, "1.2.3", e.Version)
+		require.False(t, e.Time.IsZero())
+	}
+	require.Equal(t, OpInstallToolkit, entries[0].Op)
+	require.JSONEq(t, `{"Config":"/etc/docker/daemon.json"}`, string(entries[1].Options))
+	require.Equal(t, "crio", entries[2].Runtime)
+
+	require.NoError(t, j.Replace(entries[:1]))
+	entries, err = j.Load()
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+
+	require.NoError(t, j.Replace(nil))
+	require.NoFileExists(t, j.Path())
+}
+
+func TestLoad(t *testing.T) {
+	testCases := []struct {
+		contents        string
+		expectedEntries int
+		expectedError   bool
+	}{
+		{
+			contents:        `{"op":"install-toolkit"}` + "\n" + `{"op":"setup-runtime"}` + "\n",
+			expectedEntries: 2,
+		},
+		{
+			contents:        `{"op":"install-toolkit"}` + "\n" + `{"op":"setup-`,
+			expectedEntries: 1,
+		},
+		{
+			contents:      `{"op":"install-` + "\n" + `{"op":"setup-runtime"}` + "\n",
+			expectedError: true,
+		},
+	}
+
+	for i, tc := range testCases {
+		dir, err := ioutil.TempDir("", "journal-test-")
+		require.NoError(t, err, "%d: %v", i, tc)
+		defer os.RemoveAll(dir)
+
+		path := filepath.Join(dir, "toolkit.journal")
+		require.NoError(t, ioutil.WriteFile(path, []byte(tc.contents), 0600), "%d: %v", i, tc)
+
+		entries, err := New(path, "").Load()
+		if tc.expectedError {
+			require.Error(t, err, "%d: %v", i, tc)
+			continue
+		}
+		require.NoError(t, err, "%d: %v", i, tc)
+		require.Len(t, entries, tc.expectedEntries, "%d: %v", i, tc)
+	}
+}
+
+func TestCommit(t *testing.T) {
+	dir, err := ioutil.TempDir("", "journal-test-")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	written := filepath.Join(dir, "written.json")
+	other := filepath.Join(dir, "other.json")
+	require.NoError(t, ioutil.WriteFile(written, []byte("{}"), 0644))
+
+	j := New(filepath.Join(dir, "toolkit.journal"), "1.2.3")
+	require.NoError(t, j.Append(
+		Entry{Op: OpWriteFile, Path: written},
+		Entry{Op: OpWriteFile, Path: other},
+	))
+	require.NoError(t, j.Commit([]string{written}))
+
+	checksum, err := Checksum(written)
+	require.NoError(t, err)
+	require.NotEmpty(t, checksum)
+
+	entries, err := j.Load()
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	require.True(t, entries[0].Committed)
+	require.Equal(t, checksum, entries[0].Checksum)
+	require.False(t, entries[1].Committed)
+
+	checksum, err = Checksum(other)
+	require.NoError(t, err)
+	require.Empty(t, checksum)
+}
+
+func TestRuntimeChanges(t *testing.T) {
+	testCases := []struct {
+		config          string
+		defaultRuntime  string
+		expectedEntries []Entry
+	}{
+		{
+			config:         `{}`,
+			defaultRuntime: "nvidia",
+			expectedEntries: []Entry{
+				{Op: OpAddRuntime, Runtime: "docker", Path: "daemon.json", Name: "nvidia"},
+				{Op: OpAddRuntime, Runtime: "docker", Path: "daemon.json", Name: "nvidia-experimental"},
+				{Op: OpSetDefaultRuntime, Runtime: "docker", Path: "daemon.json", Name: "nvidia"},
+			},
+		},
+		{
+			config:         `{"default-runtime": "runc", "runtimes": {"nvidia": {}}}`,
+			defaultRuntime: "nvidia",
+			expectedEntries: []Entry{
+				{Op: OpAddRuntime, Runtime: "docker", Path: "daemon.json", Name: "nvidia-experimental"},
+				{Op: OpSetDefaultRuntime, Runtime: "docker", Path: "daemon.json", Name: "nvidia", Previous: "runc"},
+			},
+		},
+		{
+			config: `{"default-runtime": "nvidia", "runtimes": {"nvidia": {}, "nvidia-experimental": {}}}`,
+		},
+		{
+			config:         `{"default-runtime": "nvidia", "runtimes": {"nvidia": {}, "nvidia-experimental": {}}}`,
+			defaultRuntime: "nvidia",
+		},
+	}
+
+	for i, tc := range testCases {
+		c, err := engine.Parse([]byte(tc.config))
+		require.NoError(t, err, "%d: %v", i, tc)
+
+		entries := RuntimeChanges("docker", "daemon.json", c, []string{"nvidia", "nvidia-experimental"}, tc.defaultRuntime)
+		require.Equal(t, tc.expectedEntries, entries, "%d: %v", i, tc)
+	}
+}
@@ -0,0 +1,81 @@
+/**
+# Copyright (c) 2021, NVIDIA CORPORATION.  All rights reserved.
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#     http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+*/
+
+package shlex
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSplit(t *testing.T) {
+	testCases := []struct {
+		input         string
+		expected      []string
+		expectedError bool
+	}{
+		{
+			input: "",
+		},
+		{
+			input: "   ",
+		},
+		{
+			input:    "--config=/etc/containerd/config.toml   --set-as-default",
+			expected: []string{"--config=/etc/containerd/config.toml", "--set-as-default"},
+		},
+		{
+			input:    "--config '/etc/my config/config.toml'",
+			expected: []string{"--config", "/etc/my config/config.toml"},
+		},
+		{
+			input:    `--config="/etc/my config/config.toml"`,
+			expected: []string{"--config=/etc/my config/config.toml"},
+		},
+		{
+			input:    `--config=/etc/my\ config/config.toml`,
+			expected: []string{"--config=/etc/my config/config.toml"},
+		},
+		{
+			input:    `"a \"quoted\" \$word\n" 'single \ quoted'`,
+			expected: []string{`a "quoted" $word\n`, `single \ quoted`},
+		},
+		{
+			input:    `'' ""`,
+			expected: []string{"", ""},
+		},
+		{
+			input:         "--config '/etc/config.toml",
+			expectedError: true,
+		},
+		{
+			input:         `--config "/etc/config.toml`,
+			expectedError: true,
+		},
+	}
+
+	for i, tc := range testCases {
+		words, err := Split(tc.input)
+		if tc.expectedError {
+			require.Error(t, err, "%d: %v", i, tc)
+			continue
+		}
+
+		require.NoError(t, err, "%d: %v", i, tc)
+		require.EqualValues(t, tc.expected, words, "%d: %v", i, tc)
+	}
+}
@@ -0,0 +1,327 @@
+/**
+# Copyright (c) 2021, NVIDIA CORPORATION.  All rights reserved.
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#     http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+*/
+
+package state
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"container-toolkit/internal/atomicfile"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const suffix = ".nvidia-toolkit-state"
+
+// State records the changes made to a runtime config file. It is stored next
+// to the config file so that a cleanup is able to undo the changes made by a
+// setup, even if these are performed by different processes.
+type State struct {
+	path string
+	// Original is a snapshot of the config file before it was first
+	// modified. If this is nil, the original contents are unknown.
+	Original *File `json:"original,omitempty"`
+	// Written is the checksum of the contents last written to the config file.
+	Written string `json:"written,omitempty"`
+	// DefaultRuntime is the default runtime that was configured before the
+	// toolkit first changed it, with the empty string indicating that no
+	// default runtime was configured. If this is nil, the default runtime was
+	// not changed or the previous value is unknown.
+	DefaultRuntime *string `json:"defaultRuntime,omitempty"`
+	// Owned records the entries of the config that were created by the
+	// toolkit. If this is nil, no such record exists (e.g. for a state saved
+	// by an older version of the toolkit).
+	Owned *Ownership `json:"owned,omitempty"`
+}
+
+// Ownership records the runtimes, default runtime, files and directories that
+// were created by the toolkit. Only these are removed on cleanup.
+type Ownership struct {
+	Runtimes       []string `json:"runtimes,omitempty"`
+	DefaultRuntime string   `json:"defaultRuntime,omitempty"`
+	Files          []string `json:"files,omitempty"`
+	// Dirs are the directories created by the toolkit, with parents listed
+	// before their subdirectories
+	Dirs []string `json:"dirs,omitempty"`
+}
+
+// File holds the contents of a file at a point in time
+type File struct {
+	Exists   bool        `json:"exists"`
+	Contents []byte      `json:"contents,omitempty"`
+	Mode     os.FileMode `json:"mode,omitempty"`
+}
+
+// Path returns the path of the file in which the state for the specified
+// config file is stored.
+func Path(config string) string {
+	return filepath.Join(filepath.Dir(config), "."+filepath.Base(config)+suffix)
+}
+
+// Load loads the state for the specified config file. If no state exists, nil
+// is returned.
+func Load(config string) (*State, error) {
+	contents, err := ioutil.ReadFile(Path(config))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to read state: %v", err)
+	}
+
+	s := &State{path: config}
+	err = json.Unmarshal(contents, s)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse state: %v", err)
+	}
+	return s, nil
+}
+
+// New returns an empty state for the specified config file. This is used for
+// configs for which no snapshot is required.
+func New(config string) *State {
+	return &State{path: config}
+}
+
+// Snapshot returns the state for the specified config file, taking a snapshot
+// of the file if no state exists yet. If the file was modified since it was
+// last written by the toolkit, the existing snapshot is discarded since
+// restoring it would also undo these modifications.
+func Snapshot(config string) (*State, error) {
+	s, err := Load(config)
+	if err != nil {
+		return nil, err
+	}
+
+	if s != nil {
+		if s.Original != nil && s.Written != "" && !s.IsUnmodified() {
+			log.Warnf("Config '%v' was modified since it was last updated; its original contents cannot be restored", config)
+			s.Original = nil
+		}
+		return s, nil
+	}
+
+	log.Infof("Taking snapshot of config '%v'", config)
+	snapshot, err := takeSnapshot(config)
+	if err != nil {
+		return nil, err
+	}
+
+	s = &State{
+		path:     config,
+		Original: snapshot,
+	}
+	return s, nil
+}
+
+// Save writes the state to disk
+func (s *State) Save() error {
+	contents, err := json.Marshal(s)
+	if err != nil {
+		return fmt.Errorf("unable to encode state: %v", err)
+	}
+
+	err = atomicfile.WriteFile(Path(s.path), contents, 0600)
+	if err != nil {
+		return fmt.Errorf("unable to write state: %v", err)
+	}
+	return nil
+}
+
+// Update records the current contents of the config file as written by the
+// toolkit and saves the state.
+func (s *State) Update() error {
+	written, err := checksum(s.path)
+	if err != nil {
+		return err
+	}
+	s.Written = written
+	return s.Save()
+}
+
+// RecordDefaultRuntime records the default runtime that is configured before
+// the toolkit changes it. Only the first recorded value is kept so that the
+// value from before the toolkit was first set up is restored on cleanup.
+func (s *State) RecordDefaultRuntime(name string) {
+	if s.DefaultRuntime != nil {
+		return
+	}
+	s.DefaultRuntime = &name
+}
+
+// Own returns the ownership record of the state, creating an empty record if
+// none exists.
+func (s *State) Own() *Ownership {
+	if s.Owned == nil {
+		s.Owned = &Ownership{}
+	}
+	return s.Owned
+}
+
+// AddRuntime records that the specified runtime is created by the toolkit. A
+// runtime that already exists and is not owned by the toolkit is not recorded
+// so that it is left in place on cleanup.
+func (o *Ownership) AddRuntime(name string, exists bool) {
+	if o.OwnsRuntime(name) {
+		return
+	}
+	if exists {
+		log.Infof("Runtime '%v' was not created by the toolkit and will not be removed on cleanup", name)
+		return
+	}
+	o.Runtimes = append(o.Runtimes, name)
+}
+
+// OwnsRuntime checks whether the specified runtime was created by the toolkit
+func (o *Ownership) OwnsRuntime(name string) bool {
+	return contains(o.Runtimes, name)
+}
+
+// AddFile records that the specified file is created by the toolkit. A file
+// that already exists and is not owned by the toolkit is not recorded so that
+// it is left in place on cleanup.
+func (o *Ownership) AddFile(path string, exists bool) {
+	if o.OwnsFile(path) {
+		return
+	}
+	if exists {
+		log.Infof("File '%v' was not created by the toolkit and will not be removed on cleanup", path)
+		return
+	}
+	o.Files = append(o.Files, path)
+}
+
+// OwnsFile checks whether the specified file was created by the toolkit
+func (o *Ownership) OwnsFile(path string) bool {
+	return contains(o.Files, path)
+}
+
+// AddDir records that the specified directory is created by the toolkit
+func (o *Ownership) AddDir(path string) {
+	if contains(o.Dirs, path) {
+		return
+	}
+	o.Dirs = append(o.Dirs, path)
+}
+
+// Remove removes the state from disk
+func (s *State) Remove() error {
+	err := os.Remove(Path(s.path))
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("unable to remove state: %v", err)
+	}
+	return nil
+}
+
+// IsUnmodified checks whether the config file is unchanged since it was last
+// written by the toolkit.
+func (s *State) IsUnmodified() bool {
+	current, err := checksum(s.path)
+	if err != nil {
+		log.Warnf("Unable to determine checksum of '%v': %v", s.path, err)
+		return false
+	}
+	return s.Written != "" && current == s.Written
+}
+
+// CanRestore checks whether the original contents of the config file are
+// known and the file is unchanged since it was last written by the toolkit.
+func (s *State) CanRestore() bool {
+	return s.Original != nil && s.IsUnmodified()
+}
+
+// Restore restores the config file to its original contents if it is
+// unchanged since it was last written by the toolkit. If the file did not
+// exist originally, it is removed. The return value indicates whether the
+// file was restored.
+func (s *State) Restore() (bool, error) {
+	if s.Original == nil {
+		log.Infof("Original contents of '%v' are unknown", s.path)
+		return false, nil
+	}
+	if !s.IsUnmodified() {
+		log.Infof("Config '%v' was modified since it was last updated", s.path)
+		return false, nil
+	}
+
+	if !s.Original.Exists {
+		log.Infof("Removing config '%v' since it did not exist originally", s.path)
+		err := os.Remove(s.path)
+		if err != nil && !os.IsNotExist(err) {
+			return false, fmt.Errorf("unable to remove config: %v", err)
+		}
+		return true, nil
+	}
+
+	log.Infof("Restoring original contents of config '%v'", s.path)
+	err := atomicfile.WriteFile(s.path, s.Original.Contents, s.Original.Mode)
+	if err != nil {
+		return false, fmt.Errorf("unable to restore config: %v", err)
+	}
+	return true, nil
+}
+
+func takeSnapshot(path string) (*File, error) {
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return &File{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to stat '%v': %v", path, err)
+	}
+	if info.IsDir() {
+		return nil, fmt.Errorf("'%v' is a directory", path)
+	}
+
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read '%v': %v", path, err)
+	}
+
+	s := File{
+		Exists:   true,
+		Contents: contents,
+		Mode:     info.Mode().Perm(),
+	}
+	return &s, nil
+}
+
+// checksum returns the checksum of the contents of the specified file. If the
+// file does not exist, the empty string is returned.
+func checksum(path string) (string, error) {
+	contents, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("unable to read '%v': %v", path, err)
+	}
+	return fmt.Sprintf("sha256:%x", sha256.Sum256(contents)), nil
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,131 @@
+/**
+# Copyright (c) 2021, NVIDIA CORPORATION.  All rights reserved.
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#     http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+*/
+
+package state
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRestore(t *testing.T) {
+	testCases := []struct {
+		description      string
+		original         *string
+		modifyAfterSetup bool
+		expectedRestored bool
+	}{
+		{
+			description:      "config did not exist",
+			expectedRestored: true,
+		},
+		{
+			description:      "config existed",
+			original:         stringPtr(`{"log-level": "debug"}`),
+			expectedRestored: true,
+		},
+		{
+			description:      "config modified after setup",
+			original:         stringPtr(`{"log-level": "debug"}`),
+			modifyAfterSetup: true,
+			expectedRestored: false,
+		},
+	}
+
+	for _, tc := range testCases {
+		dir, err := ioutil.TempDir("", "state-test-")
+		require.NoError(t, err)
+		defer os.RemoveAll(dir)
+
+		config := filepath.Join(dir, "daemon.json")
+		if tc.original != nil {
+			require.NoError(t, ioutil.WriteFile(config, []byte(*tc.original), 0640))
+		}
+
+		s, err := Snapshot(config)
+		require.NoError(t, err, tc.description)
+		require.NoError(t, s.Save(), tc.description)
+
+		require.NoError(t, ioutil.WriteFile(config, []byte(`{"runtimes": {}}`), 0644), tc.description)
+		require.NoError(t, s.Update(), tc.description)
+
+		if tc.modifyAfterSetup {
+			require.NoError(t, ioutil.WriteFile(config, []byte(`{"runtimes": {}, "debug": true}`), 0644), tc.description)
+		}
+
+		loaded, err := Load(config)
+		require.NoError(t, err, tc.description)
+		require.NotNil(t, loaded, tc.description)
+
+		restored, err := loaded.Restore()
+		require.NoError(t, err, tc.description)
+		require.Equal(t, tc.expectedRestored, restored, tc.description)
+
+		if !tc.expectedRestored {
+			continue
+		}
+
+		if tc.original == nil {
+			require.NoFileExists(t, config, tc.description)
+			continue
+		}
+		contents, err := ioutil.ReadFile(config)
+		require.NoError(t, err, tc.description)
+		require.Equal(t, *tc.original, string(contents), tc.description)
+	}
+}
+
+func TestSnapshotKeepsFirstSnapshot(t *testing.T) {
+	dir, err := ioutil.TempDir("", "state-test-")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	config := filepath.Join(dir, "config.toml")
+	require.NoError(t, ioutil.WriteFile(config, []byte("version = 2\n"), 0644))
+
+	for i := 0; i < 2; i++ {
+		s, err := Snapshot(config)
+		require.NoError(t, err)
+		require.NoError(t, s.Save())
+
+		require.NoError(t, ioutil.WriteFile(config, []byte("version = 2\n# updated\n"), 0644))
+		require.NoError(t, s.Update())
+	}
+
+	s, err := Load(config)
+	require.NoError(t, err)
+	require.NotNil(t, s.Original)
+	require.Equal(t, "version = 2\n", string(s.Original.Contents))
+
+	// A modification by a third party between setups invalidates the snapshot
+	require.NoError(t, ioutil.WriteFile(config, []byte("version = 2\n# modified\n"), 0644))
+	s, err = Snapshot(config)
+	require.NoError(t, err)
+	require.Nil(t, s.Original)
+
+	require.NoError(t, s.Remove())
+	s, err = Load(config)
+	require.NoError(t, err)
+	require.Nil(t, s)
+}
+
+func stringPtr(s string) *string {
+	return &s
+}
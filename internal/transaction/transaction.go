@@ -0,0 +1,294 @@
+/**
+# Copyright (c) 2021, NVIDIA CORPORATION.  All rights reserved.
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#     http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+*/
+
+package transaction
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"container-toolkit/internal/atomicfile"
+	"container-toolkit/internal/journal"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const backupSuffix = ".rollback"
+
+// Transaction records how to undo the changes made to the host by the steps
+// of an operation. If a step fails, the changes made by the preceding steps
+// are rolled back in reverse order so that the host is left as it was before
+// the operation started. If a journal is set, the files written and the
+// directories created are also recorded in it so that these changes can be
+// undone by a later process.
+type Transaction struct {
+	rollbacks []action
+	commits   []action
+	journal   *journal.Journal
+	// written are the files whose writes are recorded in the journal
+	written []string
+}
+
+type action struct {
+	description string
+	run         func() error
+}
+
+// New creates an empty transaction
+func New() *Transaction {
+	return &Transaction{}
+}
+
+// Run calls the specified function with a new transaction. If the function
+// returns an error, the transaction is rolled back and the error is returned.
+// Otherwise the transaction is committed.
+func Run(fn func(tx *Transaction) error) error {
+	tx := New()
+
+	err := fn(tx)
+	if err != nil {
+		rerr := tx.Rollback()
+		if rerr != nil {
+			log.Errorf("Unable to roll back all changes: %v", rerr)
+		}
+		return err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		log.Warnf("Unable to commit all changes: %v", err)
+	}
+	return nil
+}
+
+// OnRollback registers a function that undoes a change. The functions are
+// called in reverse order of registration on rollback. The description is
+// used for logging and should describe the undo operation (e.g. 'restore
+// /etc/docker/daemon.json').
+func (t *Transaction) OnRollback(description string, undo func() error) {
+	t.rollbacks = append(t.rollbacks, action{description: description, run: undo})
+}
+
+// OnCommit registers a function that is called when the transaction is
+// committed. This is used to discard backups that are no longer required.
+func (t *Transaction) OnCommit(description string, fn func() error) {
+	t.commits = append(t.commits, action{description: description, run: fn})
+}
+
+// SetJournal sets the journal in which the changes made by the following steps
+// are recorded. If the journal is nil, the changes are not recorded.
+func (t *Transaction) SetJournal(j *journal.Journal) {
+	t.journal = j
+}
+
+// Record appends the specified entries to the journal of the transaction. If
+// no journal is set, the entries are discarded.
+func (t *Transaction) Record(entries ...journal.Entry) error {
+	if t.journal == nil || len(entries) == 0 {
+		return nil
+	}
+	return t.journal.Append(entries...)
+}
+
+// BackupFile records the current contents of the specified file so that these
+// are restored on rollback. If the file does not exist, it is removed on
+// rollback instead. The write of the file is recorded in the journal along
+// with its previous contents.
+func (t *Transaction) BackupFile(path string) error {
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		err := t.recordWrite(path, nil)
+		if err != nil {
+			return err
+		}
+		t.OnRollback(fmt.Sprintf("remove %v", path), func() error {
+			return removeIfExists(path)
+		})
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("unable to stat '%v': %v", path, err)
+	}
+
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("unable to read '%v': %v", path, err)
+	}
+
+	err = t.recordWrite(path, &journal.Backup{Contents: contents, Mode: info.Mode().Perm()})
+	if err != nil {
+		return err
+	}
+
+	t.OnRollback(fmt.Sprintf("restore %v", path), func() error {
+		return atomicfile.WriteFile(path, contents, info.Mode().Perm())
+	})
+	return nil
+}
+
+// MkdirAll creates the specified directory along with any missing parents.
+// The directories that are created are removed on rollback if they are empty
+// and are recorded in the journal.
+func (t *Transaction) MkdirAll(path string, perm os.FileMode) error {
+	var missing []string
+	for dir := filepath.Clean(path); ; dir = filepath.Dir(dir) {
+		if _, err := os.Stat(dir); err == nil {
+			break
+		}
+		missing = append(missing, dir)
+		if dir == filepath.Dir(dir) {
+			break
+		}
+	}
+
+	// The parents are registered first so that these are removed last
+	for i := len(missing) - 1; i >= 0; i-- {
+		dir := missing[i]
+		err := t.Record(journal.Entry{Op: journal.OpCreateDir, Path: dir})
+		if err != nil {
+			return fmt.Errorf("unable to record directory '%v' in journal: %v", dir, err)
+		}
+		t.OnRollback(fmt.Sprintf("remove directory %v", dir), func() error {
+			return removeIfExists(dir)
+		})
+	}
+
+	err := os.MkdirAll(path, perm)
+	if err != nil {
+		return fmt.Errorf("unable to create directory '%v': %v", path, err)
+	}
+	return nil
+}
+
+// MoveAside moves the specified file or directory to a backup location so that
+// it can be replaced. On rollback, the replacement is removed and the original
+// is moved back. The backup is removed when the transaction is committed. If
+// the path does not exist, it is removed on rollback.
+func (t *Transaction) MoveAside(path string) error {
+	backup := path + backupSuffix
+
+	// A backup left behind by an interrupted transaction is discarded
+	err := os.RemoveAll(backup)
+	if err != nil {
+		return fmt.Errorf("unable to remove stale backup '%v': %v", backup, err)
+	}
+
+	err = os.Rename(path, backup)
+	if os.IsNotExist(err) {
+		t.OnRollback(fmt.Sprintf("remove %v", path), func() error {
+			return os.RemoveAll(path)
+		})
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("unable to move '%v' to '%v': %v", path, backup, err)
+	}
+
+	t.OnRollback(fmt.Sprintf("restore %v", path), func() error {
+		err := os.RemoveAll(path)
+		if err != nil {
+			return err
+		}
+		return os.Rename(backup, path)
+	})
+	t.OnCommit(fmt.Sprintf("remove %v", backup), func() error {
+		return os.RemoveAll(backup)
+	})
+	return nil
+}
+
+// Rollback undoes the registered changes in reverse order. A failure to undo
+// one change does not prevent the remaining changes from being undone. The
+// transaction is empty afterwards.
+func (t *Transaction) Rollback() error {
+	var failed []string
+	for i := len(t.rollbacks) - 1; i >= 0; i-- {
+		a := t.rollbacks[i]
+		log.Infof("Rolling back: %v", a.description)
+
+		err := a.run()
+		if err != nil {
+			log.Errorf("Unable to %v: %v", a.description, err)
+			failed = append(failed, a.description)
+		}
+	}
+	t.rollbacks = nil
+	t.commits = nil
+	t.written = nil
+
+	if len(failed) > 0 {
+		return fmt.Errorf("unable to %v", strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+// Commit discards the registered changes so that these are no longer rolled
+// back and calls the functions registered with OnCommit. The writes recorded
+// in the journal are marked as committed. The transaction is empty
+// afterwards.
+func (t *Transaction) Commit() error {
+	var failed []string
+	for _, a := range t.commits {
+		err := a.run()
+		if err != nil {
+			log.Warnf("Unable to %v: %v", a.description, err)
+			failed = append(failed, a.description)
+		}
+	}
+
+	if t.journal != nil && len(t.written) > 0 {
+		err := t.journal.Commit(t.written)
+		if err != nil {
+			log.Warnf("Unable to commit journal entries: %v", err)
+			failed = append(failed, "commit journal entries")
+		}
+	}
+
+	t.rollbacks = nil
+	t.commits = nil
+	t.written = nil
+
+	if len(failed) > 0 {
+		return fmt.Errorf("unable to %v", strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+// recordWrite records the write of the specified file in the journal along
+// with its previous contents, which are nil if the file does not exist
+func (t *Transaction) recordWrite(path string, backup *journal.Backup) error {
+	if t.journal == nil {
+		return nil
+	}
+
+	err := t.Record(journal.Entry{Op: journal.OpWriteFile, Path: path, Backup: backup})
+	if err != nil {
+		return fmt.Errorf("unable to record '%v' in journal: %v", path, err)
+	}
+	t.written = append(t.written, path)
+	return nil
+}
+
+func removeIfExists(path string) error {
+	err := os.Remove(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,237 @@
+/**
+# Copyright (c) 2021, NVIDIA CORPORATION.  All rights reserved.
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#     http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+*/
+
+package transaction
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"container-toolkit/internal/journal"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRollbackOrder(t *testing.T) {
+	var undone []int
+
+	tx := New()
+	for i := 0; i < 3; i++ {
+		i := i
+		tx.OnRollback(fmt.Sprintf("undo %v", i), func() error {
+			undone = append(undone, i)
+			if i == 1 {
+				return fmt.Errorf("failed")
+			}
+			return nil
+		})
+	}
+
+	err := tx.Rollback()
+	require.Error(t, err)
+	require.Equal(t, []int{2, 1, 0}, undone)
+
+	undone = nil
+	require.NoError(t, tx.Rollback())
+	require.Empty(t, undone)
+}
+
+func TestRun(t *testing.T) {
+	testCases := []struct {
+		err              error
+		expectedRollback bool
+		expectedCommit   bool
+	}{
+		{
+			expectedCommit: true,
+		},
+		{
+			err:              fmt.Errorf("failed"),
+			expectedRollback: true,
+		},
+	}
+
+	for i, tc := range testCases {
+		rolledBack := false
+		committed := false
+
+		err := Run(func(tx *Transaction) error {
+			tx.OnRollback("undo", func() error {
+				rolledBack = true
+				return nil
+			})
+			tx.OnCommit("commit", func() error {
+				committed = true
+				return nil
+			})
+			return tc.err
+		})
+
+		require.Equal(t, tc.err, err, "%d: %v", i, tc)
+		require.Equal(t, tc.expectedRollback, rolledBack, "%d: %v", i, tc)
+		require.Equal(t, tc.expectedCommit, committed, "%d: %v", i, tc)
+	}
+}
+
+func TestBackupFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "transaction-test-")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	existing := filepath.Join(dir, "existing.json")
+	require.NoError(t, ioutil.WriteFile(existing, []byte("original"), 0600))
+	created := filepath.Join(dir, "created.json")
+
+	tx := New()
+	require.NoError(t, tx.BackupFile(existing))
+	require.NoError(t, tx.BackupFile(created))
+
+	require.NoError(t, ioutil.WriteFile(existing, []byte("modified"), 0644))
+	require.NoError(t, ioutil.WriteFile(created, []byte("created"), 0644))
+
+	require.NoError(t, tx.Rollback())
+
+	contents, err := ioutil.ReadFile(existing)
+	require.NoError(t, err)
+	require.Equal(t, "original", string(contents))
+
+	_, err = os.Stat(created)
+	require.True(t, os.IsNotExist(err))
+}
+
+func TestMkdirAll(t *testing.T) {
+	dir, err := ioutil.TempDir("", "transaction-test-")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	tx := New()
+	require.NoError(t, tx.MkdirAll(filepath.Join(dir, "a", "b", "c"), 0755))
+	require.DirExists(t, filepath.Join(dir, "a", "b", "c"))
+
+	require.NoError(t, tx.MkdirAll(dir, 0755))
+
+	require.NoError(t, tx.Rollback())
+	require.NoDirExists(t, filepath.Join(dir, "a"))
+	require.DirExists(t, dir)
+}
+
+func TestMoveAside(t *testing.T) {
+	testCases := []struct {
+		exists   bool
+		rollback bool
+	}{
+		{exists: true, rollback: true},
+		{exists: true, rollback: false},
+		{exists: false, rollback: true},
+		{exists: false, rollback: false},
+	}
+
+	for i, tc := range testCases {
+		dir, err := ioutil.TempDir("", "transaction-test-")
+		require.NoError(t, err)
+		defer os.RemoveAll(dir)
+
+		path := filepath.Join(dir, "toolkit")
+		if tc.exists {
+			require.NoError(t, os.Mkdir(path, 0755))
+			require.NoError(t, ioutil.WriteFile(filepath.Join(path, "original"), nil, 0644))
+		}
+
+		tx := New()
+		require.NoError(t, tx.MoveAside(path), "%d: %v", i, tc)
+		require.NoDirExists(t, path, "%d: %v", i, tc)
+
+		require.NoError(t, os.Mkdir(path, 0755), "%d: %v", i, tc)
+		require.NoError(t, ioutil.WriteFile(filepath.Join(path, "replacement"), nil, 0644), "%d: %v", i, tc)
+
+		if tc.rollback {
+			require.NoError(t, tx.Rollback(), "%d: %v", i, tc)
+		} else {
+			require.NoError(t, tx.Commit(), "%d: %v", i, tc)
+		}
+
+		require.NoDirExists(t, path+backupSuffix, "%d: %v", i, tc)
+		switch {
+		case !tc.rollback:
+			require.FileExists(t, filepath.Join(path, "replacement"), "%d: %v", i, tc)
+		case tc.exists:
+			require.FileExists(t, filepath.Join(path, "original"), "%d: %v", i, tc)
+			require.NoFileExists(t, filepath.Join(path, "replacement"), "%d: %v", i, tc)
+		default:
+			require.NoDirExists(t, path, "%d: %v", i, tc)
+		}
+	}
+}
+
+func TestJournal(t *testing.T) {
+	dir, err := ioutil.TempDir("", "transaction-test-")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	existing := filepath.Join(dir, "existing")
+	created := filepath.Join(dir, "a", "b")
+	missing := filepath.Join(created, "missing")
+	require.NoError(t, ioutil.WriteFile(existing, []byte("original"), 0640))
+
+	j := journal.New(filepath.Join(dir, "toolkit.journal"), "1.2.3")
+
+	tx := New()
+	tx.SetJournal(j)
+	require.NoError(t, tx.BackupFile(existing))
+	require.NoError(t, tx.MkdirAll(created, 0755))
+	require.NoError(t, tx.BackupFile(missing))
+	require.NoError(t, ioutil.WriteFile(existing, []byte("updated"), 0640))
+	require.NoError(t, ioutil.WriteFile(missing, []byte("created"), 0644))
+
+	entries, err := j.Load()
+	require.NoError(t, err)
+	require.Len(t, entries, 4)
+	require.Equal(t, journal.Entry{Op: journal.OpWriteFile, Path: existing, Backup: &journal.Backup{Contents: []byte("original"), Mode: 0640}}, clearTime(entries[0]))
+	require.Equal(t, journal.Entry{Op: journal.OpCreateDir, Path: filepath.Dir(created)}, clearTime(entries[1]))
+	require.Equal(t, journal.Entry{Op: journal.OpCreateDir, Path: created}, clearTime(entries[2]))
+	require.Equal(t, journal.Entry{Op: journal.OpWriteFile, Path: missing}, clearTime(entries[3]))
+
+	require.NoError(t, tx.Commit())
+
+	entries, err = j.Load()
+	require.NoError(t, err)
+	for _, i := range []int{0, 3} {
+		checksum, err := journal.Checksum(entries[i].Path)
+		require.NoError(t, err)
+		require.True(t, entries[i].Committed)
+		require.Equal(t, checksum, entries[i].Checksum)
+	}
+
+	// Without a journal, the changes are not recorded
+	tx.SetJournal(nil)
+	require.NoError(t, tx.BackupFile(existing))
+	require.NoError(t, tx.Commit())
+
+	entries, err = j.Load()
+	require.NoError(t, err)
+	require.Len(t, entries, 4)
+}
+
+// clearTime clears the time and version of the specified journal entry
+func clearTime(e journal.Entry) journal.Entry {
+	e.Time = time.Time{}
+	e.Version = ""
+	return e
+}
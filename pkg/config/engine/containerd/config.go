@@ -0,0 +1,380 @@
+/**
+# Copyright (c) 2021, NVIDIA CORPORATION.  All rights reserved.
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#     http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+*/
+
+package containerd
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+
+	"container-toolkit/internal/atomicfile"
+	"container-toolkit/pkg/config/engine"
+
+	toml "github.com/pelletier/go-toml"
+	log "github.com/sirupsen/logrus"
+)
+
+// The names of the CRI plugin sections in which runtimes are configured for
+// each supported config version.
+const (
+	criPluginV1 = "cri"
+	criPluginV2 = "io.containerd.grpc.v1.cri"
+	criPluginV3 = "io.containerd.cri.v1.runtime"
+
+	// DefaultRuntimeType is the runtime_type of the runtimes added to a config
+	// if no runtime type is specified
+	DefaultRuntimeType = "io.containerd.runc.v2"
+)
+
+// Config represents a containerd config of a specific version
+type Config struct {
+	*toml.Tree
+	// Version is the version of the config
+	Version int
+	// RuntimeType is the runtime_type of the runtimes added to the config
+	RuntimeType string
+	// UseDefaultRuntimeName specifies whether the default runtime is set using
+	// the default_runtime_name setting for a v1 config. This setting is only
+	// supported from containerd v1.3. If it is not set, the deprecated
+	// default_runtime section is used instead.
+	UseDefaultRuntimeName bool
+
+	cri       string
+	binaryKey string
+	// legacyRuntimeFields indicates whether the runtime_root and runtime_engine
+	// fields are included when a runtime config is initialised. These fields
+	// were removed in containerd 2.0.
+	legacyRuntimeFields bool
+}
+
+var _ engine.Interface = (*Config)(nil)
+
+// New creates a config of the specified version for the specified TOML tree
+func New(tree *toml.Tree, version int) (*Config, error) {
+	cri, err := CRIPlugin(version)
+	if err != nil {
+		return nil, err
+	}
+
+	c := Config{
+		Tree:                  tree,
+		Version:               version,
+		RuntimeType:           DefaultRuntimeType,
+		UseDefaultRuntimeName: true,
+		cri:                   cri,
+		binaryKey:             "BinaryName",
+		legacyRuntimeFields:   version < 3,
+	}
+	if version == 1 {
+		c.binaryKey = "Runtime"
+	}
+
+	return &c, nil
+}
+
+// Load loads the containerd config at the specified path. An empty config is
+// returned if the file does not exist.
+func Load(path string, useLegacyConfig bool) (*Config, error) {
+	contents, err := ioutil.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("unable to read config: %v", err)
+	}
+	return Parse(contents, useLegacyConfig)
+}
+
+// Parse parses the specified contents of a containerd config. The version of
+// the config is determined as described for ParseVersion.
+func Parse(contents []byte, useLegacyConfig bool) (*Config, error) {
+	tree, err := toml.LoadBytes(contents)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse config: %v", err)
+	}
+
+	version, err := ParseVersion(tree, useLegacyConfig)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse version: %v", err)
+	}
+
+	c, err := New(tree, version)
+	if err != nil {
+		return nil, err
+	}
+	c.UseDefaultRuntimeName = !useLegacyConfig
+
+	return c, nil
+}
+
+// ParseVersion parses the version field out of the containerd config. If the
+// config is empty, version 2 is assumed unless a legacy config is requested.
+// A config with content but no version field is a version 1 config.
+func ParseVersion(config *toml.Tree, useLegacyConfig bool) (int, error) {
+	var defaultVersion int
+	if !useLegacyConfig {
+		defaultVersion = 2
+	} else {
+		defaultVersion = 1
+	}
+
+	var version int
+	switch v := config.Get("version").(type) {
+	case nil:
+		switch len(config.Keys()) {
+		case 0: // No config exists, or the config file is empty, use version inferred from containerd
+			version = defaultVersion
+		default: // A config file exists, has content, and no version is set
+			version = 1
+		}
+	case int64:
+		version = int(v)
+	default:
+		return -1, fmt.Errorf("unsupported type for version field: %v", v)
+	}
+	log.Infof("Config version: %v", version)
+
+	if version == 1 {
+		log.Warnf("Support for containerd config version 1 is deprecated")
+	}
+
+	return version, nil
+}
+
+// CRIPlugin returns the name of the CRI plugin section for the specified
+// config version
+func CRIPlugin(version int) (string, error) {
+	switch version {
+	case 1:
+		return criPluginV1, nil
+	case 2:
+		return criPluginV2, nil
+	case 3:
+		return criPluginV3, nil
+	}
+	return "", fmt.Errorf("unsupported containerd config version: %v", version)
+}
+
+// AddRuntime adds a runtime class with the specified name to the config. The
+// options of an existing runc runtime class are used as a template for the
+// new runtime class.
+func (c *Config) AddRuntime(name string, path string, setAsDefault bool) error {
+	c.Set("version", int64(c.Version))
+
+	runtimeClassPath := c.runtimeClassPath(name)
+	switch runc := c.GetPath(c.runcPath()).(type) {
+	case *toml.Tree:
+		runc, _ = toml.Load(runc.String())
+		c.SetPath(runtimeClassPath, runc)
+	}
+
+	c.initRuntime(runtimeClassPath, path)
+
+	if setAsDefault {
+		return c.SetDefaultRuntime(name)
+	}
+	return nil
+}
+
+// RemoveRuntime removes the specified runtime class from the config. Tables
+// that are left empty are removed along with it.
+func (c *Config) RemoveRuntime(name string) error {
+	c.deletePath(c.runtimeClassPath(name))
+
+	if len(c.Keys()) == 1 && c.Keys()[0] == "version" {
+		c.Delete("version")
+	}
+	return nil
+}
+
+// HasRuntime checks whether the specified runtime class is defined in the
+// config
+func (c *Config) HasRuntime(name string) bool {
+	return c.GetPath(c.runtimeClassPath(name)) != nil
+}
+
+// DefaultRuntime returns the default_runtime_name set in the config
+func (c *Config) DefaultRuntime() string {
+	runtime, _ := c.GetPath(c.defaultRuntimeNamePath()).(string)
+	return runtime
+}
+
+// SetDefaultRuntime sets the specified runtime class as the default runtime.
+// For a v1 config that does not use the default_runtime_name setting, the
+// default_runtime section is initialised using the binary of the runtime
+// class instead.
+func (c *Config) SetDefaultRuntime(name string) error {
+	defaultRuntimePath := append(c.containerdPath(), "default_runtime")
+
+	if c.Version == 1 && !c.UseDefaultRuntimeName {
+		binary, ok := c.GetPath(c.runtimeClassBinaryPath(name)).(string)
+		if !ok {
+			return fmt.Errorf("runtime class %v does not exist", name)
+		}
+		log.Warnf("Setting default_runtime is deprecated")
+		c.initRuntime(defaultRuntimePath, binary)
+		return nil
+	}
+
+	c.SetPath(c.defaultRuntimeNamePath(), name)
+	if c.Version == 1 && c.GetPath(defaultRuntimePath) != nil {
+		log.Warnf("The setting of default_runtime (%v) in containerd is deprecated", defaultRuntimePath)
+	}
+	return nil
+}
+
+// UnsetDefaultRuntime removes the default_runtime_name from the config
+func (c *Config) UnsetDefaultRuntime() error {
+	c.deletePath(c.defaultRuntimeNamePath())
+	return nil
+}
+
+// RemoveLegacyDefaultRuntime removes the deprecated default_runtime section
+// of a v1 config if it refers to one of the specified runtime binaries. Fields
+// of the section that are not set by SetDefaultRuntime are preserved.
+func (c *Config) RemoveLegacyDefaultRuntime(binaries []string) {
+	defaultRuntimePath := append(c.containerdPath(), "default_runtime")
+	defaultRuntimeOptionsPath := append(defaultRuntimePath, "options")
+	if runtime, ok := c.GetPath(append(defaultRuntimeOptionsPath, c.binaryKey)).(string); ok {
+		for _, binary := range binaries {
+			if path.Base(binary) == path.Base(runtime) {
+				c.DeletePath(append(defaultRuntimeOptionsPath, c.binaryKey))
+				break
+			}
+		}
+	}
+
+	if options, ok := c.GetPath(defaultRuntimeOptionsPath).(*toml.Tree); ok {
+		if len(options.Keys()) == 0 {
+			c.DeletePath(defaultRuntimeOptionsPath)
+		}
+	}
+
+	if runtime, ok := c.GetPath(defaultRuntimePath).(*toml.Tree); ok {
+		fields := []string{"runtime_type", "runtime_root", "runtime_engine", "privileged_without_host_devices"}
+		if len(runtime.Keys()) <= len(fields) {
+			matches := []string{}
+			for _, f := range fields {
+				e := runtime.Get(f)
+				if e != nil {
+					matches = append(matches, f)
+				}
+			}
+			if len(matches) == len(runtime.Keys()) {
+				for _, m := range matches {
+					runtime.Delete(m)
+				}
+			}
+		}
+	}
+
+	c.deleteEmpty(defaultRuntimePath)
+}
+
+// Render returns the TOML representation of the config with the changes
+// applied to the specified original contents so that comments and formatting
+// are preserved. If this is not possible, an error is returned instead of
+// rewriting the entire config.
+func (c *Config) Render(original []byte) (string, error) {
+	patched, err := PatchConfig(original, c.Tree)
+	if err != nil {
+		return "", fmt.Errorf("unable to preserve the formatting of the config: %v", err)
+	}
+	return string(patched), nil
+}
+
+// Save writes the config to the specified path. If the file exists, the
+// changes are applied to its existing contents as described for Render. If
+// the config is empty, the file is removed instead.
+func (c *Config) Save(path string) error {
+	original, err := ioutil.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("unable to read '%v': %v", path, err)
+	}
+
+	output, err := c.Render(original)
+	if err != nil {
+		return fmt.Errorf("unable to update '%v': %v", path, err)
+	}
+
+	if len(strings.TrimSpace(output)) == 0 {
+		log.Infof("Config empty, removing file")
+		err := os.Remove(path)
+		if err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("unable to remove empty file: %v", err)
+		}
+		return nil
+	}
+
+	err = atomicfile.WriteFile(path, []byte(output), 0644)
+	if err != nil {
+		return fmt.Errorf("unable to write output: %v", err)
+	}
+	return nil
+}
+
+// initRuntime creates a runtime config if it does not exist and ensures that the
+// runtimes binary path is specified.
+func (c *Config) initRuntime(path []string, binary string) {
+	if c.GetPath(path) == nil {
+		c.SetPath(append(path, "runtime_type"), c.RuntimeType)
+		if c.legacyRuntimeFields {
+			c.SetPath(append(path, "runtime_root"), "")
+			c.SetPath(append(path, "runtime_engine"), "")
+		}
+		c.SetPath(append(path, "privileged_without_host_devices"), false)
+	}
+
+	binaryPath := append(path, "options", c.binaryKey)
+	c.SetPath(binaryPath, binary)
+}
+
+// deletePath deletes the specified path from the config along with any of its
+// parent tables that are left empty
+func (c *Config) deletePath(path []string) {
+	c.DeletePath(path)
+	c.deleteEmpty(path[:len(path)-1])
+}
+
+// deleteEmpty deletes the table at the specified path and its parent tables
+// if these are empty
+func (c *Config) deleteEmpty(path []string) {
+	for i := len(path); i > 0; i-- {
+		if table, ok := c.GetPath(path[:i]).(*toml.Tree); ok && len(table.Keys()) == 0 {
+			c.DeletePath(path[:i])
+		}
+	}
+}
+
+func (c *Config) runcPath() []string {
+	return c.runtimeClassPath("runc")
+}
+
+func (c *Config) runtimeClassBinaryPath(runtimeClass string) []string {
+	return append(c.runtimeClassPath(runtimeClass), "options", c.binaryKey)
+}
+
+func (c *Config) runtimeClassPath(runtimeClass string) []string {
+	return append(c.containerdPath(), "runtimes", runtimeClass)
+}
+
+func (c *Config) defaultRuntimeNamePath() []string {
+	return append(c.containerdPath(), "default_runtime_name")
+}
+
+func (c *Config) containerdPath() []string {
+	return []string{"plugins", c.cri, "containerd"}
+}
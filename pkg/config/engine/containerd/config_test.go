@@ -0,0 +1,243 @@
+/**
+# Copyright (c) 2021, NVIDIA CORPORATION.  All rights reserved.
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#     http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+*/
+
+package containerd
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAddRuntime(t *testing.T) {
+	const binary = "/usr/bin/nvidia-container-runtime"
+
+	testCases := []struct {
+		version                      int
+		useDefaultRuntimeName        bool
+		setAsDefault                 bool
+		expectedRuntimePath          []string
+		expectedLegacyFields         bool
+		expectedDefaultRuntimeName   interface{}
+		expectedDefaultRuntimeBinary interface{}
+	}{
+		{
+			version:              1,
+			expectedRuntimePath:  []string{"plugins", "cri", "containerd", "runtimes", "nvidia", "options", "Runtime"},
+			expectedLegacyFields: true,
+		},
+		{
+			version:                      1,
+			setAsDefault:                 true,
+			expectedRuntimePath:          []string{"plugins", "cri", "containerd", "runtimes", "nvidia", "options", "Runtime"},
+			expectedLegacyFields:         true,
+			expectedDefaultRuntimeBinary: binary,
+		},
+		{
+			version:                    1,
+			useDefaultRuntimeName:      true,
+			setAsDefault:               true,
+			expectedRuntimePath:        []string{"plugins", "cri", "containerd", "runtimes", "nvidia", "options", "Runtime"},
+			expectedLegacyFields:       true,
+			expectedDefaultRuntimeName: "nvidia",
+		},
+		{
+			version:                    2,
+			useDefaultRuntimeName:      true,
+			setAsDefault:               true,
+			expectedRuntimePath:        []string{"plugins", "io.containerd.grpc.v1.cri", "containerd", "runtimes", "nvidia", "options", "BinaryName"},
+			expectedLegacyFields:       true,
+			expectedDefaultRuntimeName: "nvidia",
+		},
+		{
+			version:             3,
+			expectedRuntimePath: []string{"plugins", "io.containerd.cri.v1.runtime", "containerd", "runtimes", "nvidia", "options", "BinaryName"},
+		},
+	}
+
+	for i, tc := range testCases {
+		c, err := Parse(nil, false)
+		require.NoError(t, err, "%d: %v", i, tc)
+
+		c, err = New(c.Tree, tc.version)
+		require.NoError(t, err, "%d: %v", i, tc)
+		c.UseDefaultRuntimeName = tc.useDefaultRuntimeName
+
+		err = c.AddRuntime("nvidia", binary, tc.setAsDefault)
+		require.NoError(t, err, "%d: %v", i, tc)
+		require.True(t, c.HasRuntime("nvidia"), "%d: %v", i, tc)
+
+		require.EqualValues(t, tc.version, c.Get("version"), "%d: %v", i, tc)
+		require.Equal(t, binary, c.GetPath(tc.expectedRuntimePath), "%d: %v", i, tc)
+
+		runtimePath := tc.expectedRuntimePath[:len(tc.expectedRuntimePath)-2]
+		require.Equal(t, DefaultRuntimeType, c.GetPath(append(runtimePath, "runtime_type")), "%d: %v", i, tc)
+		require.Equal(t, tc.expectedLegacyFields, c.GetPath(append(runtimePath, "runtime_root")) != nil, "%d: %v", i, tc)
+
+		containerdPath := runtimePath[:len(runtimePath)-2]
+		require.EqualValues(t, tc.expectedDefaultRuntimeName, c.GetPath(append(containerdPath, "default_runtime_name")), "%d: %v", i, tc)
+		require.EqualValues(t, tc.expectedDefaultRuntimeBinary, c.GetPath(append(containerdPath, "default_runtime", "options", "Runtime")), "%d: %v", i, tc)
+	}
+}
+
+func TestAddRuntimeCopiesRunc(t *testing.T) {
+	config := `version = 2
+
+[plugins."io.containerd.grpc.v1.cri".containerd.runtimes.runc]
+  runtime_type = "runc_runtime_type"
+
+  [plugins."io.containerd.grpc.v1.cri".containerd.runtimes.runc.options]
+    SystemdCgroup = true
+`
+	c, err := Parse([]byte(config), false)
+	require.NoError(t, err)
+
+	err = c.AddRuntime("nvidia", "/usr/bin/nvidia-container-runtime", false)
+	require.NoError(t, err)
+
+	runtimePath := []string{"plugins", "io.containerd.grpc.v1.cri", "containerd", "runtimes", "nvidia"}
+	require.Equal(t, "runc_runtime_type", c.GetPath(append(runtimePath, "runtime_type")))
+	require.Equal(t, true, c.GetPath(append(runtimePath, "options", "SystemdCgroup")))
+	require.Equal(t, "/usr/bin/nvidia-container-runtime", c.GetPath(append(runtimePath, "options", "BinaryName")))
+	require.Equal(t, "", c.DefaultRuntime())
+}
+
+func TestRemoveRuntime(t *testing.T) {
+	testCases := []struct {
+		description string
+		config      string
+		expected    string
+	}{
+		{
+			description: "only runtime",
+			config: `version = 2
+
+[plugins."io.containerd.grpc.v1.cri".containerd]
+  default_runtime_name = "nvidia"
+
+  [plugins."io.containerd.grpc.v1.cri".containerd.runtimes.nvidia]
+    runtime_type = "io.containerd.runc.v2"
+`,
+			expected: "",
+		},
+		{
+			description: "other runtimes are preserved",
+			config: `version = 2
+
+[plugins."io.containerd.grpc.v1.cri".containerd]
+  default_runtime_name = "nvidia"
+
+  [plugins."io.containerd.grpc.v1.cri".containerd.runtimes.nvidia]
+    runtime_type = "io.containerd.runc.v2"
+
+  [plugins."io.containerd.grpc.v1.cri".containerd.runtimes.runc]
+    runtime_type = "io.containerd.runc.v2"
+`,
+			expected: `version = 2
+
+[plugins."io.containerd.grpc.v1.cri".containerd]
+
+  [plugins."io.containerd.grpc.v1.cri".containerd.runtimes.runc]
+    runtime_type = "io.containerd.runc.v2"
+`,
+		},
+		{
+			description: "missing runtime",
+			config: `version = 2
+
+[plugins."io.containerd.grpc.v1.cri".containerd.runtimes.runc]
+  runtime_type = "io.containerd.runc.v2"
+`,
+			expected: `version = 2
+
+[plugins."io.containerd.grpc.v1.cri".containerd.runtimes.runc]
+  runtime_type = "io.containerd.runc.v2"
+`,
+		},
+	}
+
+	for _, tc := range testCases {
+		c, err := Parse([]byte(tc.config), false)
+		require.NoError(t, err, tc.description)
+
+		err = c.UnsetDefaultRuntime()
+		require.NoError(t, err, tc.description)
+		require.Equal(t, "", c.DefaultRuntime(), tc.description)
+
+		err = c.RemoveRuntime("nvidia")
+		require.NoError(t, err, tc.description)
+		require.False(t, c.HasRuntime("nvidia"), tc.description)
+
+		output, err := c.Render([]byte(tc.config))
+		require.NoError(t, err, tc.description)
+		require.Equal(t, tc.expected, output, tc.description)
+	}
+}
+
+func TestSave(t *testing.T) {
+	dir, err := ioutil.TempDir("", "containerd-test-")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	config := filepath.Join(dir, "config.toml")
+
+	c, err := Load(config, false)
+	require.NoError(t, err)
+	require.Equal(t, 2, c.Version)
+
+	err = c.AddRuntime("nvidia", "/usr/bin/nvidia-container-runtime", true)
+	require.NoError(t, err)
+	require.NoError(t, c.Save(config))
+
+	c, err = Load(config, false)
+	require.NoError(t, err)
+	require.True(t, c.HasRuntime("nvidia"))
+	require.Equal(t, "nvidia", c.DefaultRuntime())
+
+	require.NoError(t, c.UnsetDefaultRuntime())
+	require.NoError(t, c.RemoveRuntime("nvidia"))
+	require.NoError(t, c.Save(config))
+
+	_, err = os.Stat(config)
+	require.True(t, os.IsNotExist(err))
+}
+
+func TestSaveUnsupported(t *testing.T) {
+	dir, err := ioutil.TempDir("", "containerd-test-")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	config := filepath.Join(dir, "config.toml")
+	original := "version = 2\n\n# the runtimes\n[plugins.\"io.containerd.grpc.v1.cri\".containerd]\nruntimes = { runc = { runtime_type = \"io.containerd.runc.v2\" } }\n"
+	require.NoError(t, ioutil.WriteFile(config, []byte(original), 0644))
+
+	c, err := Load(config, false)
+	require.NoError(t, err)
+
+	err = c.AddRuntime("nvidia", "/usr/bin/nvidia-container-runtime", true)
+	require.NoError(t, err)
+
+	_, err = c.Render([]byte(original))
+	require.Error(t, err)
+	require.Error(t, c.Save(config))
+
+	contents, err := ioutil.ReadFile(config)
+	require.NoError(t, err)
+	require.Equal(t, original, string(contents))
+}
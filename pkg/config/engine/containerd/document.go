@@ -0,0 +1,705 @@
+/**
+# Copyright (c) 2021, NVIDIA CORPORATION.  All rights reserved.
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#     http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+*/
+
+package containerd
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	toml "github.com/pelletier/go-toml"
+)
+
+var bareKeyPattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// PatchConfig applies the differences between the TOML document in original
+// and the updated config to the lines of the original document. Only the lines
+// defining keys and tables that are added, changed or removed are touched,
+// meaning that comments, key order, and formatting of the remainder of the
+// document are preserved. An error is returned if a change cannot be applied
+// to the document in this way.
+func PatchConfig(original []byte, updated *toml.Tree) ([]byte, error) {
+	current, err := toml.LoadBytes(original)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse original config: %v", err)
+	}
+
+	changes, err := diffTrees(current, updated, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	d := newDocument(original)
+	for _, c := range changes {
+		err := c.applyTo(d)
+		if err != nil {
+			return nil, err
+		}
+	}
+	patched := d.bytes()
+
+	// As a safety net we ensure that the patched document is equivalent to
+	// the updated config.
+	result, err := toml.LoadBytes(patched)
+	if err != nil {
+		return nil, fmt.Errorf("patched config is invalid: %v", err)
+	}
+	expected, err := updated.ToTomlString()
+	if err != nil {
+		return nil, err
+	}
+	actual, err := result.ToTomlString()
+	if err != nil {
+		return nil, err
+	}
+	if actual != expected {
+		return nil, fmt.Errorf("patched config does not match updated config")
+	}
+
+	return patched, nil
+}
+
+// change represents a single setting or deletion of a key
+type change struct {
+	path   []string
+	value  interface{}
+	delete bool
+}
+
+func (c change) applyTo(d *document) error {
+	if c.delete {
+		return d.delete(c.path)
+	}
+	if _, isTable := c.value.(*toml.Tree); isTable {
+		return d.setTable(c.path)
+	}
+	return d.set(c.path, c.value)
+}
+
+// diffTrees returns the changes required to transform the current tree into
+// the updated tree. Deletions are returned before settings, and for each
+// table the keys of the table itself are set before those of its subtables.
+func diffTrees(current *toml.Tree, updated *toml.Tree, path []string) ([]change, error) {
+	var changes []change
+
+	if current != nil {
+		for _, k := range sortedKeys(current) {
+			if updated.GetPath([]string{k}) == nil {
+				changes = append(changes, change{path: appendPath(path, k), delete: true})
+			}
+		}
+	}
+
+	var tables []string
+	for _, k := range sortedKeys(updated) {
+		value := updated.GetPath([]string{k})
+		var existing interface{}
+		if current != nil {
+			existing = current.GetPath([]string{k})
+		}
+
+		switch value.(type) {
+		case *toml.Tree:
+			tables = append(tables, k)
+			continue
+		case []*toml.Tree:
+			if renderValue(value) != renderValue(existing) {
+				return nil, fmt.Errorf("modifying array of tables %v is not supported", appendPath(path, k))
+			}
+			continue
+		}
+
+		if _, isTable := existing.(*toml.Tree); isTable {
+			changes = append(changes, change{path: appendPath(path, k), delete: true})
+		} else if existing != nil && renderValue(existing) == renderValue(value) {
+			continue
+		}
+		changes = append(changes, change{path: appendPath(path, k), value: value})
+	}
+
+	for _, k := range tables {
+		var existing *toml.Tree
+		if current != nil {
+			switch e := current.GetPath([]string{k}).(type) {
+			case *toml.Tree:
+				existing = e
+			case nil:
+			default:
+				changes = append(changes, change{path: appendPath(path, k), delete: true})
+			}
+		}
+
+		table := updated.GetPath([]string{k}).(*toml.Tree)
+		if existing == nil && len(table.Keys()) == 0 {
+			changes = append(changes, change{path: appendPath(path, k), value: table})
+			continue
+		}
+
+		tableChanges, err := diffTrees(existing, table, appendPath(path, k))
+		if err != nil {
+			return nil, err
+		}
+		changes = append(changes, tableChanges...)
+	}
+
+	// Deletions are applied first so that settings are not affected by them
+	sort.SliceStable(changes, func(i, j int) bool {
+		return changes[i].delete && !changes[j].delete
+	})
+
+	return changes, nil
+}
+
+func sortedKeys(t *toml.Tree) []string {
+	keys := t.Keys()
+	sort.Strings(keys)
+	return keys
+}
+
+func appendPath(path []string, key string) []string {
+	return append(append([]string{}, path...), key)
+}
+
+// renderValue returns the TOML representation of the specified value
+func renderValue(value interface{}) string {
+	if value == nil {
+		return ""
+	}
+	t, err := toml.TreeFromMap(map[string]interface{}{"v": value})
+	if err != nil {
+		return fmt.Sprintf("%v", value)
+	}
+	s, err := t.ToTomlString()
+	if err != nil {
+		return fmt.Sprintf("%v", value)
+	}
+	return strings.TrimSpace(strings.TrimPrefix(s, "v = "))
+}
+
+// renderKey returns the TOML representation of the specified (dotted) key
+func renderKey(path []string) string {
+	var parts []string
+	for _, p := range path {
+		if bareKeyPattern.MatchString(p) {
+			parts = append(parts, p)
+		} else {
+			parts = append(parts, strconv.Quote(p))
+		}
+	}
+	return strings.Join(parts, ".")
+}
+
+type entryKind int
+
+const (
+	headerEntry entryKind = iota
+	keyValueEntry
+)
+
+// entry represents a table header or key-value pair in a TOML document
+type entry struct {
+	kind entryKind
+	// path is the full path of the table or key
+	path []string
+	// table is the path of the table in which a key is defined
+	table []string
+	// array indicates that the entry is (in) an array of tables
+	array bool
+	// indent is the leading whitespace of the first line of the entry
+	indent string
+	// start and end are the indices of the first and one past the last line
+	// of the entry
+	start int
+	end   int
+	// valueStart and valueEnd are the column on the first line at which the
+	// value of a key starts and the column on the last line at which it ends
+	valueStart int
+	valueEnd   int
+}
+
+// document represents the lines of a TOML document
+type document struct {
+	lines   []string
+	entries []entry
+}
+
+func newDocument(contents []byte) *document {
+	text := strings.TrimSuffix(string(contents), "\n")
+	d := &document{}
+	if text != "" {
+		d.lines = strings.Split(text, "\n")
+	}
+	d.parse()
+	return d
+}
+
+func (d *document) bytes() []byte {
+	if len(d.lines) == 0 {
+		return nil
+	}
+	return []byte(strings.Join(d.lines, "\n") + "\n")
+}
+
+// parse (re)builds the entries of the document from its lines
+func (d *document) parse() {
+	d.entries = nil
+
+	var table []string
+	var array bool
+	for i := 0; i < len(d.lines); i++ {
+		line := d.lines[i]
+		trimmed := strings.TrimLeft(line, " \t")
+		indent := line[:len(line)-len(trimmed)]
+
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+
+		if strings.HasPrefix(trimmed, "[") {
+			array = strings.HasPrefix(trimmed, "[[")
+			offset := 1
+			if array {
+				offset = 2
+			}
+			path, _ := parseKey(trimmed[offset:])
+			table = path
+			d.entries = append(d.entries, entry{
+				kind:   headerEntry,
+				path:   path,
+				array:  array,
+				indent: indent,
+				start:  i,
+				end:    i + 1,
+			})
+			continue
+		}
+
+		key, n := parseKey(trimmed)
+		if len(key) == 0 || !strings.HasPrefix(trimmed[n:], "=") {
+			continue
+		}
+		valueStart := len(indent) + n + 1
+		for valueStart < len(line) && (line[valueStart] == ' ' || line[valueStart] == '\t') {
+			valueStart++
+		}
+		lastLine, valueEnd := scanValue(d.lines, i, valueStart)
+
+		d.entries = append(d.entries, entry{
+			kind:       keyValueEntry,
+			path:       append(append([]string{}, table...), key...),
+			table:      table,
+			array:      array,
+			indent:     indent,
+			start:      i,
+			end:        lastLine + 1,
+			valueStart: valueStart,
+			valueEnd:   valueEnd,
+		})
+		i = lastLine
+	}
+}
+
+// set sets the value of the key with the specified path. If the key exists,
+// its value is replaced. Otherwise the key is added to the table containing
+// it, with the table being created if required.
+func (d *document) set(path []string, value interface{}) error {
+	rendered := renderValue(value)
+
+	if e := d.find(keyValueEntry, path); e != nil {
+		if e.array {
+			return fmt.Errorf("modifying %v in an array of tables is not supported", path)
+		}
+		first := d.lines[e.start][:e.valueStart]
+		last := d.lines[e.end-1][e.valueEnd:]
+		d.replace(e.start, e.end, first+rendered+last)
+		return nil
+	}
+
+	table := path[:len(path)-1]
+	key := path[len(path)-1]
+
+	if len(table) == 0 {
+		d.insertRootKey(renderKey([]string{key}) + " = " + rendered)
+		return nil
+	}
+
+	if err := d.setTable(table); err != nil {
+		return err
+	}
+	header := d.find(headerEntry, table)
+	if header.array {
+		return fmt.Errorf("modifying array of tables %v is not supported", table)
+	}
+
+	// Add the key after the last key in the table
+	insertAt := header.end
+	indent := d.keyIndent(header)
+	for _, e := range d.entries {
+		if e.kind == keyValueEntry && e.start >= header.start && pathEqual(e.table, table) {
+			insertAt = e.end
+			indent = e.indent
+		}
+	}
+	d.insert(insertAt, indent+renderKey([]string{key})+" = "+rendered)
+
+	return nil
+}
+
+// setTable ensures that a header for the specified table is present
+func (d *document) setTable(table []string) error {
+	if d.find(headerEntry, table) != nil {
+		return nil
+	}
+	if err := d.checkImplicitTable(table); err != nil {
+		return err
+	}
+	d.insertTable(table)
+	return nil
+}
+
+// delete removes the key or table with the specified path. For tables all
+// entries (including subtables) that are part of the table are removed.
+func (d *document) delete(path []string) error {
+	for {
+		var target *entry
+		for i := range d.entries {
+			e := d.entries[i]
+			if !hasPrefix(e.path, path) {
+				continue
+			}
+			if e.kind == keyValueEntry && len(e.table) > len(path) {
+				// This entry is removed together with its header
+				continue
+			}
+			target = &e
+			break
+		}
+		if target == nil {
+			return nil
+		}
+
+		if target.kind == keyValueEntry {
+			d.remove(target.start, target.end)
+			continue
+		}
+
+		// For a table we remove the header and all key-value pairs up to the
+		// next header.
+		end := len(d.lines)
+		for _, e := range d.entries {
+			if e.kind == headerEntry && e.start > target.start {
+				end = e.start
+				break
+			}
+		}
+		for end > target.start+1 && strings.TrimSpace(d.lines[end-1]) == "" {
+			end--
+		}
+		d.remove(target.start, end)
+	}
+}
+
+// checkImplicitTable ensures that the specified table is not defined using
+// dotted keys or an inline table, since adding keys to such tables is not
+// supported.
+func (d *document) checkImplicitTable(table []string) error {
+	for _, e := range d.entries {
+		if e.kind != keyValueEntry {
+			continue
+		}
+		if hasPrefix(table, e.path) || (hasPrefix(e.path, table) && len(e.table) < len(table)) {
+			return fmt.Errorf("modifying %v defined using dotted keys or an inline table is not supported", table)
+		}
+	}
+	return nil
+}
+
+// insertRootKey inserts a key-value pair into the root table
+func (d *document) insertRootKey(line string) {
+	insertAt := -1
+	for _, e := range d.entries {
+		if e.kind == headerEntry {
+			break
+		}
+		insertAt = e.end
+	}
+	if insertAt >= 0 {
+		d.insert(insertAt, line)
+		return
+	}
+
+	for _, e := range d.entries {
+		if e.kind == headerEntry {
+			d.insert(e.start, line, "")
+			return
+		}
+	}
+	d.insert(d.lastContentLine(0, len(d.lines)), line)
+}
+
+// insertTable inserts an (empty) header for the specified table after the
+// last entry of the closest ancestor that is present in the document.
+func (d *document) insertTable(table []string) {
+	insertAt := d.lastContentLine(0, len(d.lines))
+	for depth := len(table) - 1; depth > 0; depth-- {
+		var found bool
+		for _, e := range d.entries {
+			if hasPrefix(e.path, table[:depth]) {
+				insertAt = e.end
+				found = true
+			}
+		}
+		if found {
+			break
+		}
+	}
+
+	header := d.headerIndent(len(table)) + "[" + renderKey(table) + "]"
+	if insertAt > 0 {
+		d.insert(insertAt, "", header)
+	} else {
+		d.insert(insertAt, header)
+	}
+}
+
+// headerIndent returns the indent for a header at the specified depth based
+// on the existing headers in the document.
+func (d *document) headerIndent(depth int) string {
+	indented := false
+	for _, e := range d.entries {
+		if e.kind != headerEntry {
+			continue
+		}
+		if len(e.path) == depth {
+			return e.indent
+		}
+		if e.indent != "" {
+			indented = true
+		}
+	}
+	if indented {
+		return strings.Repeat("  ", depth-1)
+	}
+	return ""
+}
+
+// keyIndent returns the indent for a key in the table with the specified
+// header based on the existing keys in the document.
+func (d *document) keyIndent(header *entry) string {
+	for _, e := range d.entries {
+		if e.kind == keyValueEntry && len(e.table) > 0 {
+			for _, h := range d.entries {
+				if h.kind == headerEntry && pathEqual(h.path, e.table) {
+					if strings.HasPrefix(e.indent, h.indent) && len(e.indent) > len(h.indent) {
+						return header.indent + e.indent[len(h.indent):]
+					}
+					return header.indent
+				}
+			}
+		}
+	}
+	return header.indent
+}
+
+// lastContentLine returns the index one past the last non-blank line in the
+// specified range.
+func (d *document) lastContentLine(start int, end int) int {
+	for end > start && strings.TrimSpace(d.lines[end-1]) == "" {
+		end--
+	}
+	return end
+}
+
+func (d *document) find(kind entryKind, path []string) *entry {
+	for i := range d.entries {
+		if d.entries[i].kind == kind && pathEqual(d.entries[i].path, path) {
+			return &d.entries[i]
+		}
+	}
+	return nil
+}
+
+func (d *document) insert(at int, lines ...string) {
+	var updated []string
+	updated = append(updated, d.lines[:at]...)
+	updated = append(updated, lines...)
+	updated = append(updated, d.lines[at:]...)
+	d.lines = updated
+	d.parse()
+}
+
+func (d *document) replace(start int, end int, lines ...string) {
+	var updated []string
+	updated = append(updated, d.lines[:start]...)
+	updated = append(updated, lines...)
+	updated = append(updated, d.lines[end:]...)
+	d.lines = updated
+	d.parse()
+}
+
+// remove removes the specified lines from the document. Blank lines that
+// would be duplicated or would lead the document as a result are also
+// removed.
+func (d *document) remove(start int, end int) {
+	for end < len(d.lines) && strings.TrimSpace(d.lines[end]) == "" {
+		if start == 0 || strings.TrimSpace(d.lines[start-1]) == "" {
+			end++
+			continue
+		}
+		break
+	}
+	if end == len(d.lines) {
+		start = d.lastContentLine(0, start)
+	}
+	d.replace(start, end)
+}
+
+// parseKey parses a (dotted) key at the start of the specified string and
+// returns the key and the number of bytes consumed.
+func parseKey(s string) ([]string, int) {
+	var key []string
+	i := 0
+	for {
+		for i < len(s) && (s[i] == ' ' || s[i] == '\t') {
+			i++
+		}
+		if i >= len(s) {
+			return key, i
+		}
+
+		switch s[i] {
+		case '"':
+			end := i + 1
+			for end < len(s) && s[end] != '"' {
+				if s[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			if end >= len(s) {
+				return key, i
+			}
+			unquoted, err := strconv.Unquote(s[i : end+1])
+			if err != nil {
+				unquoted = s[i+1 : end]
+			}
+			key = append(key, unquoted)
+			i = end + 1
+		case '\'':
+			end := strings.IndexByte(s[i+1:], '\'')
+			if end < 0 {
+				return key, i
+			}
+			key = append(key, s[i+1:i+1+end])
+			i = i + end + 2
+		default:
+			end := i
+			for end < len(s) && (s[end] == '_' || s[end] == '-' ||
+				(s[end] >= 'a' && s[end] <= 'z') || (s[end] >= 'A' && s[end] <= 'Z') || (s[end] >= '0' && s[end] <= '9')) {
+				end++
+			}
+			if end == i {
+				return key, i
+			}
+			key = append(key, s[i:end])
+			i = end
+		}
+
+		for i < len(s) && (s[i] == ' ' || s[i] == '\t') {
+			i++
+		}
+		if i >= len(s) || s[i] != '.' {
+			return key, i
+		}
+		i++
+	}
+}
+
+// scanValue finds the end of a value that starts at the specified line and
+// column. The index of the last line of the value and the column on that line
+// after the last character of the value are returned.
+func scanValue(lines []string, line int, column int) (int, int) {
+	depth := 0
+	var inString string
+	for l := line; l < len(lines); l++ {
+		s := lines[l]
+		end := len(s)
+		c := 0
+		if l == line {
+			c = column
+		}
+		for ; c < len(s); c++ {
+			if inString != "" {
+				if s[c] == '\\' && inString[0] == '"' {
+					c++
+					continue
+				}
+				if strings.HasPrefix(s[c:], inString) {
+					c += len(inString) - 1
+					inString = ""
+				}
+				continue
+			}
+
+			switch {
+			case strings.HasPrefix(s[c:], `"""`), strings.HasPrefix(s[c:], `'''`):
+				inString = s[c : c+3]
+				c += 2
+			case s[c] == '"' || s[c] == '\'':
+				inString = s[c : c+1]
+			case s[c] == '[' || s[c] == '{':
+				depth++
+			case s[c] == ']' || s[c] == '}':
+				depth--
+			case s[c] == '#':
+				end = c
+			}
+			if end != len(s) {
+				break
+			}
+		}
+
+		// Single-line strings cannot span lines
+		if len(inString) == 1 {
+			inString = ""
+		}
+		if depth <= 0 && inString == "" {
+			return l, len(strings.TrimRight(s[:end], " \t"))
+		}
+	}
+	last := len(lines) - 1
+	return last, len(lines[last])
+}
+
+func pathEqual(a []string, b []string) bool {
+	return len(a) == len(b) && hasPrefix(a, b)
+}
+
+// hasPrefix checks whether the path starts with the specified prefix
+func hasPrefix(path []string, prefix []string) bool {
+	if len(prefix) > len(path) {
+		return false
+	}
+	for i := range prefix {
+		if path[i] != prefix[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,173 @@
+/**
+# Copyright (c) 2021, NVIDIA CORPORATION.  All rights reserved.
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#     http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+*/
+
+package containerd
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/pelletier/go-toml"
+	"github.com/stretchr/testify/require"
+)
+
+const commentedConfigV2 = `# Managed by config management; do not edit
+version = 2
+root = "/var/lib/containerd"  # containerd state
+
+[plugins]
+
+  [plugins."io.containerd.grpc.v1.cri"]
+    # The sandbox image is mirrored locally
+    sandbox_image = "registry.local/pause:3.1"
+
+    [plugins."io.containerd.grpc.v1.cri".containerd]
+      snapshotter = "overlayfs"
+      default_runtime_name = "runc" # set by the installer
+
+      [plugins."io.containerd.grpc.v1.cri".containerd.runtimes]
+
+        [plugins."io.containerd.grpc.v1.cri".containerd.runtimes.runc]
+          runtime_type = "io.containerd.runc.v2"
+
+          [plugins."io.containerd.grpc.v1.cri".containerd.runtimes.runc.options]
+            SystemdCgroup = true
+
+    [plugins."io.containerd.grpc.v1.cri".registry]
+      config_path = "/etc/containerd/certs.d"
+
+[timeouts]
+  "io.containerd.timeout.shim.cleanup" = "5s"
+`
+
+func TestPatchConfigRoundTrip(t *testing.T) {
+	testCases := []struct {
+		description string
+		original    string
+	}{
+		{
+			description: "empty config",
+		},
+		{
+			description: "commented config",
+			original:    commentedConfigV2,
+		},
+		{
+			description: "config without indentation",
+			original: strings.Join([]string{
+				"version = 2",
+				"",
+				"[plugins.\"io.containerd.grpc.v1.cri\".containerd]",
+				"snapshotter = \"overlayfs\"",
+				"",
+				"[metrics]",
+				"address = \"\"",
+				"",
+			}, "\n"),
+		},
+	}
+
+	for _, tc := range testCases {
+		cfg, err := Parse([]byte(tc.original), false)
+		require.NoError(t, err, tc.description)
+
+		err = cfg.AddRuntime("nvidia", "/test/runtime/dir/nvidia-container-runtime", true)
+		require.NoError(t, err, tc.description)
+
+		updated, err := PatchConfig([]byte(tc.original), cfg.Tree)
+		require.NoError(t, err, tc.description)
+
+		// All lines of the original config -- except for the default runtime
+		// name -- must be present in the updated config in the same order.
+		updatedLines := strings.Split(string(updated), "\n")
+		next := 0
+		for _, line := range strings.Split(tc.original, "\n") {
+			if strings.Contains(line, "default_runtime_name") {
+				continue
+			}
+			for next < len(updatedLines) && updatedLines[next] != line {
+				next++
+			}
+			require.Less(t, next, len(updatedLines), "%v: missing line %q in:\n%s", tc.description, line, updated)
+		}
+		require.Contains(t, string(updated), `default_runtime_name = "nvidia"`, tc.description)
+
+		cfg, err = Parse(updated, false)
+		require.NoError(t, err, tc.description)
+
+		err = cfg.UnsetDefaultRuntime()
+		require.NoError(t, err, tc.description)
+
+		err = cfg.RemoveRuntime("nvidia")
+		require.NoError(t, err, tc.description)
+
+		reverted, err := PatchConfig(updated, cfg.Tree)
+		require.NoError(t, err, tc.description)
+
+		expected := strings.Replace(tc.original, `      default_runtime_name = "runc" # set by the installer`+"\n", "", 1)
+		require.Equal(t, expected, string(reverted), tc.description)
+	}
+}
+
+func TestPatchConfigPreservesTrailingComment(t *testing.T) {
+	original := strings.Join([]string{
+		"[plugins.cri.containerd]",
+		"  default_runtime_name = \"runc\" # the default",
+		"",
+	}, "\n")
+
+	cfg, err := toml.LoadBytes([]byte(original))
+	require.NoError(t, err)
+	cfg.SetPath([]string{"plugins", "cri", "containerd", "default_runtime_name"}, "nvidia")
+
+	patched, err := PatchConfig([]byte(original), cfg)
+	require.NoError(t, err)
+
+	expected := strings.Join([]string{
+		"[plugins.cri.containerd]",
+		"  default_runtime_name = \"nvidia\" # the default",
+		"",
+	}, "\n")
+	require.Equal(t, expected, string(patched))
+}
+
+func TestPatchConfigUnsupported(t *testing.T) {
+	testCases := []struct {
+		description string
+		original    string
+		path        []string
+	}{
+		{
+			description: "dotted keys",
+			original:    "[plugins]\ncri.containerd.snapshotter = \"overlayfs\"\n",
+			path:        []string{"plugins", "cri", "containerd", "default_runtime_name"},
+		},
+		{
+			description: "inline table",
+			original:    "[plugins.cri.containerd]\nruntimes = { runc = { runtime_type = \"io.containerd.runc.v2\" } }\n",
+			path:        []string{"plugins", "cri", "containerd", "runtimes", "nvidia", "runtime_type"},
+		},
+	}
+
+	for _, tc := range testCases {
+		cfg, err := toml.LoadBytes([]byte(tc.original))
+		require.NoError(t, err, tc.description)
+		cfg.SetPath(tc.path, "value")
+
+		_, err = PatchConfig([]byte(tc.original), cfg)
+		require.Error(t, err, tc.description)
+	}
+}
@@ -0,0 +1,204 @@
+/**
+# Copyright (c) 2021, NVIDIA CORPORATION.  All rights reserved.
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#     http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+*/
+
+package crio
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"container-toolkit/internal/atomicfile"
+	"container-toolkit/pkg/config/engine"
+
+	hooks "github.com/containers/podman/v2/pkg/hooks/1.0.0"
+	rspec "github.com/opencontainers/runtime-spec/specs-go"
+)
+
+// Config represents the OCI hooks in a cri-o hooks directory. Since cri-o
+// invokes the nvidia-container-toolkit as a prestart hook instead of through
+// a dedicated runtime, a runtime is represented by a hook file with the name
+// of the runtime as its filename.
+type Config struct {
+	// hooks maps the filenames of the hooks in the directory to their
+	// definitions. The definition is nil for files that cannot be parsed.
+	hooks map[string]*hooks.Hook
+	// modified holds the filenames of the hooks that were added or removed
+	modified map[string]struct{}
+}
+
+var _ engine.Interface = (*Config)(nil)
+
+// New creates an empty hooks config
+func New() *Config {
+	return &Config{
+		hooks:    make(map[string]*hooks.Hook),
+		modified: make(map[string]struct{}),
+	}
+}
+
+// Load loads the hooks with a .json extension from the specified hooks
+// directory. An empty config is returned if the directory does not exist.
+func Load(hooksDir string) (*Config, error) {
+	c := New()
+
+	files, err := ioutil.ReadDir(hooksDir)
+	if os.IsNotExist(err) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to read hooks directory: %v", err)
+	}
+
+	for _, file := range files {
+		if file.IsDir() || !strings.HasSuffix(file.Name(), ".json") {
+			continue
+		}
+
+		contents, err := ioutil.ReadFile(filepath.Join(hooksDir, file.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("unable to read hook '%v': %v", file.Name(), err)
+		}
+
+		var hook hooks.Hook
+		if err := json.Unmarshal(contents, &hook); err != nil {
+			c.hooks[file.Name()] = nil
+			continue
+		}
+		c.hooks[file.Name()] = &hook
+	}
+
+	return c, nil
+}
+
+// NewHook returns a prestart hook that invokes the nvidia-container-toolkit
+// executable at the specified path for all containers
+func NewHook(path string) hooks.Hook {
+	envPath := "PATH=/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin:" + filepath.Dir(path)
+	always := true
+
+	hook := hooks.Hook{
+		Version: "1.0.0",
+		Stages:  []string{"prestart"},
+		Hook: rspec.Hook{
+			Path: path,
+			Args: []string{"nvidia-container-toolkit", "prestart"},
+			Env:  []string{envPath},
+		},
+		When: hooks.When{
+			Always:   &always,
+			Commands: []string{".*"},
+		},
+	}
+	return hook
+}
+
+// AddRuntime adds a hook with the specified filename that invokes the
+// nvidia-container-toolkit executable at the specified path. An existing hook
+// with the same filename is replaced. Setting a default runtime is not
+// supported.
+func (c *Config) AddRuntime(name string, path string, setAsDefault bool) error {
+	if setAsDefault {
+		return c.SetDefaultRuntime(name)
+	}
+
+	hook := NewHook(path)
+	c.hooks[name] = &hook
+	c.modified[name] = struct{}{}
+	return nil
+}
+
+// RemoveRuntime removes the hook with the specified filename
+func (c *Config) RemoveRuntime(name string) error {
+	delete(c.hooks, name)
+	c.modified[name] = struct{}{}
+	return nil
+}
+
+// HasRuntime checks whether a hook with the specified filename exists
+func (c *Config) HasRuntime(name string) bool {
+	_, exists := c.hooks[name]
+	return exists
+}
+
+// Hook returns the definition of the hook with the specified filename. nil is
+// returned if the hook does not exist or cannot be parsed.
+func (c *Config) Hook(name string) *hooks.Hook {
+	return c.hooks[name]
+}
+
+// DefaultRuntime always returns the empty string since cri-o hooks have no
+// notion of a default runtime
+func (c *Config) DefaultRuntime() string {
+	return ""
+}
+
+// SetDefaultRuntime returns an error since cri-o hooks have no notion of a
+// default runtime
+func (c *Config) SetDefaultRuntime(name string) error {
+	return fmt.Errorf("setting a default runtime is not supported for cri-o hooks")
+}
+
+// UnsetDefaultRuntime is a no-op since cri-o hooks have no notion of a
+// default runtime
+func (c *Config) UnsetDefaultRuntime() error {
+	return nil
+}
+
+// Save writes the added hooks to and removes the removed hooks from the
+// specified hooks directory. Hooks that were not modified are left as is.
+func (c *Config) Save(hooksDir string) error {
+	var names []string
+	for name := range c.modified {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		hookPath := filepath.Join(hooksDir, name)
+
+		hook, exists := c.hooks[name]
+		if !exists {
+			err := os.Remove(hookPath)
+			if err != nil && !os.IsNotExist(err) {
+				return fmt.Errorf("unable to remove hook '%v': %v", hookPath, err)
+			}
+			continue
+		}
+
+		err := os.MkdirAll(hooksDir, 0755)
+		if err != nil {
+			return fmt.Errorf("unable to create hooks directory: %v", err)
+		}
+
+		contents, err := json.Marshal(hook)
+		if err != nil {
+			return fmt.Errorf("unable to convert hook '%v' to JSON: %v", name, err)
+		}
+
+		err = atomicfile.WriteFile(hookPath, append(contents, '\n'), 0644)
+		if err != nil {
+			return fmt.Errorf("unable to write hook '%v': %v", hookPath, err)
+		}
+	}
+
+	c.modified = make(map[string]struct{})
+	return nil
+}
@@ -0,0 +1,90 @@
+/**
+# Copyright (c) 2021, NVIDIA CORPORATION.  All rights reserved.
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#     http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+*/
+
+package crio
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	hooks "github.com/containers/podman/v2/pkg/hooks/1.0.0"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewHook(t *testing.T) {
+	hook := NewHook("/toolkit/nvidia-container-toolkit")
+
+	require.Equal(t, "/toolkit/nvidia-container-toolkit", hook.Hook.Path)
+	require.Equal(t, []string{"nvidia-container-toolkit", "prestart"}, hook.Hook.Args)
+	require.Equal(t, []string{"PATH=/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin:/toolkit"}, hook.Hook.Env)
+	require.Equal(t, []string{"prestart"}, hook.Stages)
+}
+
+func TestSave(t *testing.T) {
+	dir, err := ioutil.TempDir("", "crio-test-")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	hooksDir := filepath.Join(dir, "hooks.d")
+	foreignHook := filepath.Join(hooksDir, "foreign.json")
+
+	c, err := Load(hooksDir)
+	require.NoError(t, err)
+	require.False(t, c.HasRuntime("oci-nvidia-hook.json"))
+
+	err = c.AddRuntime("oci-nvidia-hook.json", "/toolkit/nvidia-container-toolkit", false)
+	require.NoError(t, err)
+	require.NoError(t, c.Save(hooksDir))
+	require.NoError(t, ioutil.WriteFile(foreignHook, []byte("not a hook"), 0644))
+
+	contents, err := ioutil.ReadFile(filepath.Join(hooksDir, "oci-nvidia-hook.json"))
+	require.NoError(t, err)
+
+	var hook hooks.Hook
+	require.NoError(t, json.Unmarshal(contents, &hook))
+	require.Equal(t, "/toolkit/nvidia-container-toolkit", hook.Hook.Path)
+
+	c, err = Load(hooksDir)
+	require.NoError(t, err)
+	require.True(t, c.HasRuntime("oci-nvidia-hook.json"))
+	require.NotNil(t, c.Hook("oci-nvidia-hook.json"))
+	require.True(t, c.HasRuntime("foreign.json"))
+	require.Nil(t, c.Hook("foreign.json"))
+
+	require.NoError(t, c.RemoveRuntime("oci-nvidia-hook.json"))
+	require.NoError(t, c.Save(hooksDir))
+
+	_, err = os.Stat(filepath.Join(hooksDir, "oci-nvidia-hook.json"))
+	require.True(t, os.IsNotExist(err))
+
+	// Hooks that were not modified are left as is
+	contents, err = ioutil.ReadFile(foreignHook)
+	require.NoError(t, err)
+	require.Equal(t, "not a hook", string(contents))
+}
+
+func TestSetDefaultRuntime(t *testing.T) {
+	c := New()
+
+	require.Error(t, c.SetDefaultRuntime("oci-nvidia-hook.json"))
+	require.Error(t, c.AddRuntime("oci-nvidia-hook.json", "/toolkit/nvidia-container-toolkit", true))
+	require.False(t, c.HasRuntime("oci-nvidia-hook.json"))
+	require.NoError(t, c.UnsetDefaultRuntime())
+	require.Equal(t, "", c.DefaultRuntime())
+}
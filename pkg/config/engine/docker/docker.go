@@ -0,0 +1,147 @@
+/**
+# Copyright (c) 2021, NVIDIA CORPORATION.  All rights reserved.
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#     http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+*/
+
+package docker
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"container-toolkit/internal/atomicfile"
+	"container-toolkit/pkg/config/engine"
+)
+
+// Config represents the contents of a docker daemon.json file
+type Config map[string]interface{}
+
+var _ engine.Interface = (Config)(nil)
+
+// Load loads the docker config at the specified path. An empty config is
+// returned if the file does not exist.
+func Load(path string) (Config, error) {
+	info, err := os.Stat(path)
+	if err == nil && info.IsDir() {
+		return nil, fmt.Errorf("config file is a directory")
+	}
+
+	contents, err := ioutil.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("unable to read config: %v", err)
+	}
+	return Parse(contents)
+}
+
+// Parse parses the specified contents of a docker config. Empty contents
+// result in an empty config.
+func Parse(contents []byte) (Config, error) {
+	cfg := make(Config)
+	if len(bytes.TrimSpace(contents)) == 0 {
+		return cfg, nil
+	}
+
+	reader := bytes.NewReader(contents)
+	if err := json.NewDecoder(reader).Decode(&cfg); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// AddRuntime adds a runtime with the specified name to the config. An existing
+// runtime with the same name is replaced.
+func (c Config) AddRuntime(name string, path string, setAsDefault bool) error {
+	runtimes, _ := c["runtimes"].(map[string]interface{})
+	if runtimes == nil {
+		runtimes = make(map[string]interface{})
+	}
+
+	runtimes[name] = map[string]interface{}{
+		"path": path,
+		"args": []string{},
+	}
+	c["runtimes"] = runtimes
+
+	if setAsDefault {
+		return c.SetDefaultRuntime(name)
+	}
+	return nil
+}
+
+// RemoveRuntime removes the runtime with the specified name from the config.
+// The runtimes setting is removed if no runtimes remain.
+func (c Config) RemoveRuntime(name string) error {
+	runtimes, ok := c["runtimes"].(map[string]interface{})
+	if !ok {
+		return nil
+	}
+
+	delete(runtimes, name)
+	if len(runtimes) == 0 {
+		delete(c, "runtimes")
+	}
+	return nil
+}
+
+// HasRuntime checks whether a runtime with the specified name is defined in
+// the config
+func (c Config) HasRuntime(name string) bool {
+	runtimes, _ := c["runtimes"].(map[string]interface{})
+	_, exists := runtimes[name]
+	return exists
+}
+
+// DefaultRuntime returns the default-runtime set in the config
+func (c Config) DefaultRuntime() string {
+	runtime, _ := c["default-runtime"].(string)
+	return runtime
+}
+
+// SetDefaultRuntime sets the default-runtime in the config
+func (c Config) SetDefaultRuntime(name string) error {
+	c["default-runtime"] = name
+	return nil
+}
+
+// UnsetDefaultRuntime removes the default-runtime from the config
+func (c Config) UnsetDefaultRuntime() error {
+	delete(c, "default-runtime")
+	return nil
+}
+
+// Bytes returns the contents of the docker config file for the config
+func (c Config) Bytes() ([]byte, error) {
+	output, err := json.MarshalIndent(c, "", "    ")
+	if err != nil {
+		return nil, fmt.Errorf("unable to convert to JSON: %v", err)
+	}
+	return output, nil
+}
+
+// Save writes the config to the specified path
+func (c Config) Save(path string) error {
+	output, err := c.Bytes()
+	if err != nil {
+		return err
+	}
+
+	err = atomicfile.WriteFile(path, output, 0644)
+	if err != nil {
+		return fmt.Errorf("unable to write output: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,184 @@
+/**
+# Copyright (c) 2021, NVIDIA CORPORATION.  All rights reserved.
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#     http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+*/
+
+package docker
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAddRuntime(t *testing.T) {
+	testCases := []struct {
+		config         Config
+		setAsDefault   bool
+		expectedConfig Config
+	}{
+		{
+			config: Config{},
+			expectedConfig: Config{
+				"runtimes": map[string]interface{}{
+					"nvidia": map[string]interface{}{
+						"path": "/usr/bin/nvidia-container-runtime",
+						"args": []string{},
+					},
+				},
+			},
+		},
+		{
+			config:       Config{},
+			setAsDefault: true,
+			expectedConfig: Config{
+				"default-runtime": "nvidia",
+				"runtimes": map[string]interface{}{
+					"nvidia": map[string]interface{}{
+						"path": "/usr/bin/nvidia-container-runtime",
+						"args": []string{},
+					},
+				},
+			},
+		},
+		{
+			config: Config{
+				"default-runtime": "runc",
+				"runtimes": map[string]interface{}{
+					"runc": map[string]interface{}{
+						"path": "runc",
+						"args": []string{},
+					},
+					"nvidia": map[string]interface{}{
+						"path": "/some/other/path",
+					},
+				},
+			},
+			expectedConfig: Config{
+				"default-runtime": "runc",
+				"runtimes": map[string]interface{}{
+					"runc": map[string]interface{}{
+						"path": "runc",
+						"args": []string{},
+					},
+					"nvidia": map[string]interface{}{
+						"path": "/usr/bin/nvidia-container-runtime",
+						"args": []string{},
+					},
+				},
+			},
+		},
+	}
+
+	for i, tc := range testCases {
+		err := tc.config.AddRuntime("nvidia", "/usr/bin/nvidia-container-runtime", tc.setAsDefault)
+		require.NoError(t, err, "%d: %v", i, tc)
+		require.True(t, tc.config.HasRuntime("nvidia"), "%d: %v", i, tc)
+		require.EqualValues(t, tc.expectedConfig, tc.config, "%d: %v", i, tc)
+	}
+}
+
+func TestRemoveRuntime(t *testing.T) {
+	testCases := []struct {
+		config         Config
+		expectedConfig Config
+	}{
+		{
+			config:         Config{},
+			expectedConfig: Config{},
+		},
+		{
+			config: Config{
+				"default-runtime": "nvidia",
+				"runtimes": map[string]interface{}{
+					"nvidia": map[string]interface{}{
+						"path": "/usr/bin/nvidia-container-runtime",
+						"args": []string{},
+					},
+				},
+			},
+			expectedConfig: Config{},
+		},
+		{
+			config: Config{
+				"default-runtime": "runc",
+				"runtimes": map[string]interface{}{
+					"runc": map[string]interface{}{
+						"path": "runc",
+						"args": []string{},
+					},
+					"nvidia": map[string]interface{}{
+						"path": "/usr/bin/nvidia-container-runtime",
+						"args": []string{},
+					},
+				},
+			},
+			expectedConfig: Config{
+				"runtimes": map[string]interface{}{
+					"runc": map[string]interface{}{
+						"path": "runc",
+						"args": []string{},
+					},
+				},
+			},
+		},
+	}
+
+	for i, tc := range testCases {
+		err := tc.config.UnsetDefaultRuntime()
+		require.NoError(t, err, "%d: %v", i, tc)
+		require.Equal(t, "", tc.config.DefaultRuntime(), "%d: %v", i, tc)
+
+		err = tc.config.RemoveRuntime("nvidia")
+		require.NoError(t, err, "%d: %v", i, tc)
+		require.False(t, tc.config.HasRuntime("nvidia"), "%d: %v", i, tc)
+		require.EqualValues(t, tc.expectedConfig, tc.config, "%d: %v", i, tc)
+	}
+}
+
+func TestSave(t *testing.T) {
+	dir, err := ioutil.TempDir("", "docker-test-")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	config := filepath.Join(dir, "daemon.json")
+
+	c, err := Load(config)
+	require.NoError(t, err)
+	require.Empty(t, c)
+
+	err = c.AddRuntime("nvidia", "/usr/bin/nvidia-container-runtime", true)
+	require.NoError(t, err)
+	require.NoError(t, c.Save(config))
+
+	contents, err := ioutil.ReadFile(config)
+	require.NoError(t, err)
+	require.Equal(t, `{
+    "default-runtime": "nvidia",
+    "runtimes": {
+        "nvidia": {
+            "args": [],
+            "path": "/usr/bin/nvidia-container-runtime"
+        }
+    }
+}`, string(contents))
+
+	c, err = Load(config)
+	require.NoError(t, err)
+	require.True(t, c.HasRuntime("nvidia"))
+	require.Equal(t, "nvidia", c.DefaultRuntime())
+}
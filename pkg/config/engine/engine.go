@@ -0,0 +1,46 @@
+/**
+# Copyright (c) 2021, NVIDIA CORPORATION.  All rights reserved.
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#     http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+*/
+
+// Package engine defines a common interface for editing the runtimes that are
+// configured for a container engine. Implementations are provided for docker
+// (daemon.json), containerd (config.toml) and cri-o (OCI hooks) in the
+// subpackages of this package.
+package engine
+
+// Interface defines the operations for editing the config of a container
+// engine. A config is loaded using the Load function of the implementing
+// package and the changes are written out using Save.
+type Interface interface {
+	// AddRuntime adds a runtime with the specified name that invokes the
+	// executable at the specified path. If setAsDefault is set, the runtime
+	// is also set as the default runtime.
+	AddRuntime(name string, path string, setAsDefault bool) error
+	// RemoveRuntime removes the runtime with the specified name. Removing a
+	// runtime that does not exist is not an error.
+	RemoveRuntime(name string) error
+	// HasRuntime checks whether a runtime with the specified name exists.
+	HasRuntime(name string) bool
+	// DefaultRuntime returns the name of the default runtime. The empty
+	// string is returned if no default runtime is set.
+	DefaultRuntime() string
+	// SetDefaultRuntime sets the runtime with the specified name as the
+	// default runtime.
+	SetDefaultRuntime(name string) error
+	// UnsetDefaultRuntime removes the setting of the default runtime.
+	UnsetDefaultRuntime() error
+	// Save writes the config to the specified path.
+	Save(path string) error
+}
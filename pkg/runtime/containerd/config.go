@@ -0,0 +1,104 @@
+/**
+# Copyright (c) 2020-2021, NVIDIA CORPORATION.  All rights reserved.
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#     http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+*/
+
+package containerd
+
+import (
+	engine "container-toolkit/pkg/config/engine/containerd"
+
+	"github.com/pelletier/go-toml"
+)
+
+// newConfig creates a containerd config of the specified version for the
+// specified TOML tree with the runtime settings for the given options applied
+func newConfig(tree *toml.Tree, o *Options, version int) (*engine.Config, error) {
+	c, err := engine.New(tree, version)
+	if err != nil {
+		return nil, err
+	}
+	c.RuntimeType = o.RuntimeType
+	// For v1 config, the `default_runtime_name` setting is only supported
+	// for containerd version at least v1.3
+	c.UseDefaultRuntimeName = !o.UseLegacyConfig
+
+	return c, nil
+}
+
+// updateConfig adds the nvidia runtimes to the specified config. If a default
+// runtime is specified in the options, this is also set as the default runtime.
+func updateConfig(tree *toml.Tree, o *Options, version int) error {
+	c, err := newConfig(tree, o, version)
+	if err != nil {
+		return err
+	}
+
+	defaultRuntime := o.getDefaultRuntime()
+	runtimeBinaries := o.getRuntimeBinaries()
+	for _, runtimeClass := range o.runtimeClasses() {
+		err := c.AddRuntime(runtimeClass, runtimeBinaries[runtimeClass], runtimeClass == defaultRuntime)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// revertConfig removes the nvidia runtimes from the specified config. If the
+// default runtime was set by the toolkit, the previous default runtime is
+// restored if known. Otherwise the default runtime name is removed.
+func revertConfig(tree *toml.Tree, o *Options, version int) error {
+	c, err := newConfig(tree, o, version)
+	if err != nil {
+		return err
+	}
+
+	var runtimeClasses []string
+	switch version {
+	case 1:
+		var binaries []string
+		for _, binary := range o.getRuntimeBinaries() {
+			binaries = append(binaries, binary)
+		}
+		c.RemoveLegacyDefaultRuntime(binaries)
+		runtimeClasses = o.ownedRuntimes(nvidiaRuntimeBinaries)
+	default:
+		runtimeClasses = o.ownedRuntimes(o.getRuntimeBinaries())
+	}
+
+	if runtime := c.DefaultRuntime(); o.ownsDefaultRuntime(runtime, runtimeClasses) {
+		if o.previousDefaultRuntime != nil && *o.previousDefaultRuntime != "" {
+			// The previous default runtime is restored as the default runtime
+			// name, even for a legacy config.
+			c.UseDefaultRuntimeName = true
+			err = c.SetDefaultRuntime(*o.previousDefaultRuntime)
+		} else {
+			err = c.UnsetDefaultRuntime()
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, runtimeClass := range runtimeClasses {
+		err := c.RemoveRuntime(runtimeClass)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -14,7 +14,7 @@
 # limitations under the License.
 */
 
-package main
+package containerd
 
 import (
 	"testing"
@@ -89,12 +89,12 @@ func TestUpdateV1ConfigDefaultRuntime(t *testing.T) {
 	}
 
 	for i, tc := range testCases {
-		o := &options{
-			useLegacyConfig: tc.legacyConfig,
-			setAsDefault:    tc.setAsDefault,
-			runtimeClass:    tc.runtimeClass,
-			runtimeType:     runtimeType,
-			runtimeDir:      runtimeDir,
+		o := &Options{
+			UseLegacyConfig: tc.legacyConfig,
+			SetAsDefault:    tc.setAsDefault,
+			RuntimeClass:    tc.runtimeClass,
+			RuntimeType:     runtimeType,
+			RuntimeDir:      runtimeDir,
 		}
 
 		config, err := toml.TreeFromMap(map[string]interface{}{})
@@ -150,10 +150,10 @@ func TestUpdateV1Config(t *testing.T) {
 	}
 
 	for i, tc := range testCases {
-		o := &options{
-			runtimeClass: tc.runtimeClass,
-			runtimeType:  runtimeType,
-			runtimeDir:   runtimeDir,
+		o := &Options{
+			RuntimeClass: tc.runtimeClass,
+			RuntimeType:  runtimeType,
+			RuntimeDir:   runtimeDir,
 		}
 
 		config, err := toml.TreeFromMap(map[string]interface{}{})
@@ -217,10 +217,10 @@ func TestUpdateV1ConfigWithRuncPresent(t *testing.T) {
 	}
 
 	for i, tc := range testCases {
-		o := &options{
-			runtimeClass: tc.runtimeClass,
-			runtimeType:  runtimeType,
-			runtimeDir:   runtimeDir,
+		o := &Options{
+			RuntimeClass: tc.runtimeClass,
+			RuntimeType:  runtimeType,
+			RuntimeDir:   runtimeDir,
 		}
 
 		config, err := toml.TreeFromMap(runcConfigMapV1("/runc-binary"))
@@ -301,8 +301,8 @@ func TestRevertV1Config(t *testing.T) {
 	}
 
 	for i, tc := range testCases {
-		o := &options{
-			runtimeClass: "nvidia",
+		o := &Options{
+			RuntimeClass: "nvidia",
 		}
 
 		config, err := toml.TreeFromMap(tc.config)
@@ -14,11 +14,13 @@
 # limitations under the License.
 */
 
-package main
+package containerd
 
 import (
 	"testing"
 
+	"container-toolkit/internal/state"
+
 	"github.com/pelletier/go-toml"
 	"github.com/stretchr/testify/require"
 )
@@ -69,10 +71,10 @@ func TestUpdateV2ConfigDefaultRuntime(t *testing.T) {
 	}
 
 	for i, tc := range testCases {
-		o := &options{
-			setAsDefault: tc.setAsDefault,
-			runtimeClass: tc.runtimeClass,
-			runtimeDir:   runtimeDir,
+		o := &Options{
+			SetAsDefault: tc.setAsDefault,
+			RuntimeClass: tc.runtimeClass,
+			RuntimeDir:   runtimeDir,
 		}
 
 		config, err := toml.TreeFromMap(map[string]interface{}{})
@@ -114,10 +116,10 @@ func TestUpdateV2Config(t *testing.T) {
 	}
 
 	for i, tc := range testCases {
-		o := &options{
-			runtimeClass: tc.runtimeClass,
-			runtimeType:  runtimeType,
-			runtimeDir:   runtimeDir,
+		o := &Options{
+			RuntimeClass: tc.runtimeClass,
+			RuntimeType:  runtimeType,
+			RuntimeDir:   runtimeDir,
 		}
 
 		config, err := toml.TreeFromMap(map[string]interface{}{})
@@ -182,10 +184,10 @@ func TestUpdateV2ConfigWithRuncPresent(t *testing.T) {
 	}
 
 	for i, tc := range testCases {
-		o := &options{
-			runtimeClass: tc.runtimeClass,
-			runtimeType:  runtimeType,
-			runtimeDir:   runtimeDir,
+		o := &Options{
+			RuntimeClass: tc.runtimeClass,
+			RuntimeType:  runtimeType,
+			RuntimeDir:   runtimeDir,
 		}
 
 		config, err := toml.TreeFromMap(runcConfigMapV2("/runc-binary"))
@@ -220,10 +222,14 @@ func TestUpdateV2ConfigWithRuncPresent(t *testing.T) {
 }
 
 func TestRevertV2Config(t *testing.T) {
+	runc := "runc"
+
 	testCases := []struct {
 		config map[string]interface {
 		}
-		expected map[string]interface{}
+		previousDefaultRuntime *string
+		owned                  *state.Ownership
+		expected               map[string]interface{}
 	}{
 		{},
 		{
@@ -262,11 +268,75 @@ func TestRevertV2Config(t *testing.T) {
 				},
 			},
 		},
+		{
+			config: map[string]interface{}{
+				"version": int64(2),
+				"plugins": map[string]interface{}{
+					"io.containerd.grpc.v1.cri": map[string]interface{}{
+						"containerd": map[string]interface{}{
+							"runtimes": map[string]interface{}{
+								"nvidia":              runtimeMapV2("/test/runtime/dir/nvidia-container-runtime"),
+								"nvidia-experimental": runtimeMapV2("/test/runtime/dir/nvidia-container-runtime-experimental"),
+							},
+							"default_runtime_name": "nvidia",
+						},
+					},
+				},
+			},
+			previousDefaultRuntime: &runc,
+			expected: map[string]interface{}{
+				"version": int64(2),
+				"plugins": map[string]interface{}{
+					"io.containerd.grpc.v1.cri": map[string]interface{}{
+						"containerd": map[string]interface{}{
+							"default_runtime_name": "runc",
+						},
+					},
+				},
+			},
+		},
+		{
+			config: map[string]interface{}{
+				"version": int64(2),
+				"plugins": map[string]interface{}{
+					"io.containerd.grpc.v1.cri": map[string]interface{}{
+						"containerd": map[string]interface{}{
+							"runtimes": map[string]interface{}{
+								"nvidia":              runtimeMapV2("/usr/bin/nvidia-container-runtime"),
+								"nvidia-experimental": runtimeMapV2("/test/runtime/dir/nvidia-container-runtime-experimental"),
+								"NAME":                runtimeMapV2("/test/runtime/dir/nvidia-container-runtime"),
+							},
+							"default_runtime_name": "NAME",
+						},
+					},
+				},
+			},
+			previousDefaultRuntime: &runc,
+			owned: &state.Ownership{
+				Runtimes:       []string{"NAME", "nvidia-experimental"},
+				DefaultRuntime: "NAME",
+			},
+			expected: map[string]interface{}{
+				"version": int64(2),
+				"plugins": map[string]interface{}{
+					"io.containerd.grpc.v1.cri": map[string]interface{}{
+						"containerd": map[string]interface{}{
+							"runtimes": map[string]interface{}{
+								"nvidia": runtimeMapV2("/usr/bin/nvidia-container-runtime"),
+							},
+							"default_runtime_name": "runc",
+						},
+					},
+				},
+			},
+		},
 	}
 
 	for i, tc := range testCases {
-		o := &options{
-			runtimeClass: "nvidia",
+		o := &Options{
+			RuntimeClass:           "nvidia",
+			previousDefaultRuntime: tc.previousDefaultRuntime,
+			owned:                  tc.owned,
 		}
 
 		config, err := toml.TreeFromMap(tc.config)
@@ -0,0 +1,31 @@
+/**
+# Copyright (c) 2021, NVIDIA CORPORATION.  All rights reserved.
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#     http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+*/
+
+package containerd
+
+import (
+	"github.com/pelletier/go-toml"
+)
+
+// UpdateV3Config performs an update specific to v3 of the containerd config
+func UpdateV3Config(config *toml.Tree, o *Options) error {
+	return updateConfig(config, o, 3)
+}
+
+// RevertV3Config performs a revert specific to v3 of the containerd config
+func RevertV3Config(config *toml.Tree, o *Options) error {
+	return revertConfig(config, o, 3)
+}
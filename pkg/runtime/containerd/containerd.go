@@ -0,0 +1,738 @@
+/**
+# Copyright (c) 2020-2021, NVIDIA CORPORATION.  All rights reserved.
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#     http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+*/
+
+package containerd
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"syscall"
+	"time"
+
+	"container-toolkit/internal/journal"
+	"container-toolkit/internal/state"
+	"container-toolkit/internal/transaction"
+	engine "container-toolkit/pkg/config/engine/containerd"
+
+	toml "github.com/pelletier/go-toml"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	restartModeSignal  = "signal"
+	restartModeSystemd = "systemd"
+	restartModeNone    = "NONE"
+
+	nvidiaRuntimeName               = "nvidia"
+	nvidiaRuntimeBinary             = "nvidia-container-runtime"
+	nvidiaExperimentalRuntimeName   = "nvidia-experimental"
+	nvidiaExperimentalRuntimeBinary = "nvidia-container-runtime-experimental"
+
+	defaultConfig        = "/etc/containerd/config.toml"
+	defaultSocket        = "/run/containerd/containerd.sock"
+	defaultRuntimeClass  = "nvidia"
+	defaultRuntmeType    = "io.containerd.runc.v2"
+	defaultSetAsDefault  = true
+	defaultRestartMode   = restartModeSignal
+	defaultHostRootMount = "/host"
+
+	reloadBackoff     = 5 * time.Second
+	maxReloadAttempts = 6
+
+	socketMessageToGetPID = ""
+)
+
+// nvidiaRuntimeBinaries defines a map of runtime names to binary names
+var nvidiaRuntimeBinaries = map[string]string{
+	nvidiaRuntimeName:             nvidiaRuntimeBinary,
+	nvidiaExperimentalRuntimeName: nvidiaExperimentalRuntimeBinary,
+}
+
+// Options defines the options for updating the containerd config
+type Options struct {
+	// Config is the path to the containerd config file
+	Config string `yaml:"config"`
+	// Socket is the path to the containerd socket that is used to signal containerd
+	Socket string `yaml:"socket"`
+	// RuntimeClass is the name of the runtime class for the nvidia runtime
+	RuntimeClass string `yaml:"runtimeClass"`
+	// RuntimeType is the runtime_type of the configured runtime classes
+	RuntimeType string `yaml:"runtimeType"`
+	// SetAsDefault specifies whether the nvidia runtime is set as the default runtime
+	SetAsDefault bool `yaml:"setAsDefault"`
+	// RestartMode specifies how containerd is restarted; [signal | systemd | NONE]
+	RestartMode string `yaml:"restartMode"`
+	// HostRootMount is the path to the host root used when restarting containerd using systemd
+	HostRootMount string `yaml:"hostRootMount"`
+	// RuntimeDir is the directory containing the nvidia runtime executables
+	RuntimeDir string `yaml:"-"`
+	// UseLegacyConfig specifies whether a legacy (pre v1.3) config is used if no config exists
+	UseLegacyConfig bool `yaml:"useLegacyConfig"`
+	// DropInConfig is the path to a drop-in config to which the runtimes are written
+	DropInConfig string `yaml:"dropInConfig"`
+	// DryRun specifies that the changes are printed instead of applied
+	DryRun bool `yaml:"dryRun"`
+	// previousDefaultRuntime is the default runtime to restore on cleanup.
+	// This is nil if the previous default runtime is unknown.
+	previousDefaultRuntime *string
+	// owned is the record of the config entries created by the toolkit that
+	// are removed on cleanup. This is nil if no record exists.
+	owned *state.Ownership
+}
+
+// Setup updates a containerd configuration to include the nvidia-containerd-runtime and reloads it.
+// If a step fails, the configs and their state are restored to their contents
+// from before the setup.
+func Setup(o *Options) error {
+	return transaction.Run(func(tx *transaction.Transaction) error {
+		return SetupWithRollback(context.Background(), o, tx)
+	})
+}
+
+// SetupWithRollback updates the containerd config as for Setup. The changes
+// made are registered with the specified transaction instead of being rolled
+// back on failure. This allows these to be rolled back along with later steps.
+// If the context is cancelled, the setup is aborted and an error is returned.
+func SetupWithRollback(ctx context.Context, o *Options, tx *transaction.Transaction) error {
+	log.Infof("Starting 'setup' for containerd")
+
+	if o.DryRun {
+		return SetupDryRun(o)
+	}
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	// Containerd only needs to be restarted on rollback if it was restarted
+	// to load the updated config. This is registered first so that it happens
+	// after the config is restored.
+	restarted := false
+	tx.OnRollback("restart containerd", func() error {
+		if !restarted {
+			return nil
+		}
+		return RestartContainerd(o)
+	})
+
+	err := journalChanges(o, tx)
+	if err != nil {
+		return fmt.Errorf("unable to record changes in journal: %v", err)
+	}
+
+	// The directories of the drop-in config that are created are recorded in
+	// the state so that these are also removed on cleanup
+	var created []string
+	if o.DropInConfig != "" {
+		created = missingDirs(filepath.Dir(o.DropInConfig))
+		err = tx.MkdirAll(filepath.Dir(o.DropInConfig), 0755)
+		if err != nil {
+			return fmt.Errorf("unable to create drop-in config directory: %v", err)
+		}
+	}
+
+	for _, path := range []string{o.Config, state.Path(o.Config), o.DropInConfig} {
+		if path == "" {
+			continue
+		}
+		err = tx.BackupFile(path)
+		if err != nil {
+			return fmt.Errorf("unable to back up config: %v", err)
+		}
+	}
+
+	if o.DropInConfig != "" {
+		err = setupDropIn(o, created)
+		if err != nil {
+			return fmt.Errorf("unable to setup drop-in config: %v", err)
+		}
+	} else {
+		err = setupConfig(o)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = restartContainerd(ctx, o)
+	if err != nil {
+		return fmt.Errorf("unable to restart containerd: %v", err)
+	}
+	restarted = true
+
+	log.Infof("Completed 'setup' for containerd")
+
+	return nil
+}
+
+// Cleanup reverts a containerd configuration to remove the nvidia-containerd-runtime and reloads it
+func Cleanup(o *Options) error {
+	log.Infof("Starting 'cleanup' for containerd")
+
+	if o.DryRun {
+		return CleanupDryRun(o)
+	}
+
+	var err error
+	if o.DropInConfig != "" {
+		err = CleanupDropIn(o)
+		if err != nil {
+			return fmt.Errorf("unable to cleanup drop-in config: %v", err)
+		}
+	} else {
+		err = cleanupConfig(o)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = RestartContainerd(o)
+	if err != nil {
+		return fmt.Errorf("unable to restart containerd: %v", err)
+	}
+
+	log.Infof("Completed 'cleanup' for containerd")
+
+	return nil
+}
+
+// setupConfig updates the containerd config in place
+func setupConfig(o *Options) error {
+	st, err := state.Snapshot(o.Config)
+	if err != nil {
+		return fmt.Errorf("unable to snapshot config: %v", err)
+	}
+
+	err = st.Save()
+	if err != nil {
+		return fmt.Errorf("unable to save config state: %v", err)
+	}
+
+	cfg, err := LoadConfig(o.Config)
+	if err != nil {
+		return fmt.Errorf("unable to load config: %v", err)
+	}
+
+	version, err := ParseVersion(cfg, o.UseLegacyConfig)
+	if err != nil {
+		return fmt.Errorf("unable to parse version: %v", err)
+	}
+
+	err = recordOwnership(st, cfg, o, version)
+	if err != nil {
+		return fmt.Errorf("unable to record config ownership: %v", err)
+	}
+
+	err = UpdateConfig(cfg, o, version)
+	if err != nil {
+		return fmt.Errorf("unable to update config: %v", err)
+	}
+
+	err = FlushConfig(o.Config, cfg)
+	if err != nil {
+		return fmt.Errorf("unable to flush config: %v", err)
+	}
+
+	err = st.Update()
+	if err != nil {
+		return fmt.Errorf("unable to update config state: %v", err)
+	}
+
+	return nil
+}
+
+// cleanupConfig reverts the containerd config in place. If the config is
+// unchanged since setup, its original contents are restored instead.
+func cleanupConfig(o *Options) error {
+	st, err := state.Load(o.Config)
+	if err != nil {
+		return fmt.Errorf("unable to load config state: %v", err)
+	}
+
+	if st != nil {
+		restored, err := st.Restore()
+		if err != nil {
+			return fmt.Errorf("unable to restore config: %v", err)
+		}
+		o.previousDefaultRuntime = st.DefaultRuntime
+		o.owned = st.Owned
+
+		err = st.Remove()
+		if err != nil {
+			return fmt.Errorf("unable to remove config state: %v", err)
+		}
+
+		if restored {
+			return nil
+		}
+	}
+
+	cfg, err := LoadConfig(o.Config)
+	if err != nil {
+		return fmt.Errorf("unable to load config: %v", err)
+	}
+
+	version, err := ParseVersion(cfg, o.UseLegacyConfig)
+	if err != nil {
+		return fmt.Errorf("unable to parse version: %v", err)
+	}
+
+	err = RevertConfig(cfg, o, version)
+	if err != nil {
+		return fmt.Errorf("unable to update config: %v", err)
+	}
+
+	err = FlushConfig(o.Config, cfg)
+	if err != nil {
+		return fmt.Errorf("unable to flush config: %v", err)
+	}
+
+	return nil
+}
+
+// recordOwnership records the runtime classes and default runtime that are
+// created by an update of the specified config in the config state.
+func recordOwnership(st *state.State, cfg *toml.Tree, o *Options, version int) error {
+	c, err := engine.New(cfg, version)
+	if err != nil {
+		return err
+	}
+
+	owned := st.Own()
+	for _, runtimeClass := range o.runtimeClasses() {
+		owned.AddRuntime(runtimeClass, c.HasRuntime(runtimeClass))
+	}
+
+	defaultRuntime := o.getDefaultRuntime()
+	if defaultRuntime == "" {
+		return nil
+	}
+
+	current := c.DefaultRuntime()
+	if current == defaultRuntime {
+		return nil
+	}
+	if !o.isNvidiaRuntime(current) {
+		st.RecordDefaultRuntime(current)
+	}
+	owned.DefaultRuntime = defaultRuntime
+
+	return nil
+}
+
+// journalChanges records the runtime classes added to the containerd config and
+// the change of its default runtime in the journal of the transaction. These
+// are recorded before the config is written, so that the config is restored
+// before these are undone. A drop-in config is only written by the toolkit, so
+// the runtime classes in it are undone by removing the file.
+func journalChanges(o *Options, tx *transaction.Transaction) error {
+	if o.DropInConfig != "" {
+		return nil
+	}
+
+	cfg, names, err := LoadRuntimes(o)
+	if err != nil {
+		return fmt.Errorf("unable to load config: %v", err)
+	}
+	return tx.Record(journal.RuntimeChanges("containerd", o.Config, cfg, names, o.getDefaultRuntime())...)
+}
+
+// LoadRuntimes loads the config in which the nvidia runtimes are configured
+// for the specified options and returns it along with the names of these
+// runtimes. In drop-in mode, this is the drop-in config if the containerd
+// config imports it and an empty config otherwise. The names are also
+// returned if the config cannot be loaded.
+func LoadRuntimes(o *Options) (*engine.Config, []string, error) {
+	names := o.runtimeClasses()
+
+	cfg, err := engine.Load(o.Config, o.UseLegacyConfig)
+	if err != nil {
+		return nil, names, err
+	}
+	if o.DropInConfig == "" {
+		return cfg, names, nil
+	}
+
+	var contents []byte
+	if isImported(cfg.Tree, o.importPath()) {
+		contents, err = ioutil.ReadFile(o.DropInConfig)
+		if err != nil && !os.IsNotExist(err) {
+			return nil, names, fmt.Errorf("unable to read drop-in config: %v", err)
+		}
+	}
+
+	dropIn, err := toml.LoadBytes(contents)
+	if err != nil {
+		return nil, names, fmt.Errorf("unable to parse drop-in config: %v", err)
+	}
+
+	// The drop-in config has the version of the config that imports it
+	c, err := engine.New(dropIn, cfg.Version)
+	if err != nil {
+		return nil, names, err
+	}
+	c.UseDefaultRuntimeName = cfg.UseDefaultRuntimeName
+	return c, names, nil
+}
+
+// LoadConfig loads the containerd config from disk
+func LoadConfig(config string) (*toml.Tree, error) {
+	log.Infof("Loading config: %v", config)
+
+	info, err := os.Stat(config)
+	if os.IsExist(err) && info.IsDir() {
+		return nil, fmt.Errorf("config file is a directory")
+	}
+
+	configFile := config
+	if os.IsNotExist(err) {
+		configFile = "/dev/null"
+		log.Infof("Config file does not exist, creating new one")
+	}
+
+	cfg, err := toml.LoadFile(configFile)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Infof("Successfully loaded config")
+
+	return cfg, nil
+}
+
+// ParseConfig parses the specified contents of a containerd config
+func ParseConfig(contents []byte) (*toml.Tree, error) {
+	return toml.LoadBytes(contents)
+}
+
+// ParseVersion parses the version field out of the containerd config
+func ParseVersion(config *toml.Tree, useLegacyConfig bool) (int, error) {
+	return engine.ParseVersion(config, useLegacyConfig)
+}
+
+// UpdateConfig updates the containerd config to include the nvidia-container-runtime
+func UpdateConfig(config *toml.Tree, o *Options, version int) error {
+	var err error
+
+	log.Infof("Updating config")
+	switch version {
+	case 1:
+		err = UpdateV1Config(config, o)
+	case 2:
+		err = UpdateV2Config(config, o)
+	case 3:
+		err = UpdateV3Config(config, o)
+	default:
+		err = fmt.Errorf("unsupported containerd config version: %v", version)
+	}
+	if err != nil {
+		return err
+	}
+	log.Infof("Successfully updated config")
+
+	return nil
+}
+
+// RevertConfig reverts the containerd config to remove the nvidia-container-runtime
+func RevertConfig(config *toml.Tree, o *Options, version int) error {
+	var err error
+
+	log.Infof("Reverting config")
+	switch version {
+	case 1:
+		err = RevertV1Config(config, o)
+	case 2:
+		err = RevertV2Config(config, o)
+	case 3:
+		err = RevertV3Config(config, o)
+	default:
+		err = fmt.Errorf("unsupported containerd config version: %v", version)
+	}
+	if err != nil {
+		return err
+	}
+	log.Infof("Successfully reverted config")
+
+	return nil
+}
+
+// FlushConfig flushes the updated/reverted config out to disk. If the file
+// exists, the changes are applied to its existing contents so that comments
+// and formatting are preserved.
+func FlushConfig(config string, cfg *toml.Tree) error {
+	log.Infof("Flushing config")
+
+	c := engine.Config{Tree: cfg}
+	err := c.Save(config)
+	if err != nil {
+		return err
+	}
+
+	log.Infof("Successfully flushed config")
+
+	return nil
+}
+
+// renderConfig returns the TOML representation of the config to be written to
+// the specified file by FlushConfig
+func renderConfig(config string, cfg *toml.Tree) (string, error) {
+	original, err := ioutil.ReadFile(config)
+	if err != nil && !os.IsNotExist(err) {
+		return "", fmt.Errorf("unable to read '%v': %v", config, err)
+	}
+
+	return RenderConfig(original, cfg)
+}
+
+// RenderConfig returns the TOML representation of the specified config with
+// the changes applied to the original contents of the config so that comments
+// and formatting are preserved. If this is not possible, the entire config is
+// rendered instead.
+func RenderConfig(original []byte, cfg *toml.Tree) (string, error) {
+	c := engine.Config{Tree: cfg}
+	return c.Render(original)
+}
+
+// RestartContainerd restarts containerd depending on the value of restartModeFlag
+func RestartContainerd(o *Options) error {
+	return restartContainerd(context.Background(), o)
+}
+
+// restartContainerd restarts containerd as for RestartContainerd. Retries
+// and the systemd restart are aborted if the context is cancelled.
+func restartContainerd(ctx context.Context, o *Options) error {
+	switch o.RestartMode {
+	case restartModeNone:
+		log.Warnf("Skipping sending signal to containerd due to --restart-mode=%v", o.RestartMode)
+		return nil
+	case restartModeSignal:
+		err := signalContainerd(ctx, o)
+		if err != nil {
+			return fmt.Errorf("unable to signal containerd: %v", err)
+		}
+	case restartModeSystemd:
+		return restartContainerdSystemd(ctx, o.HostRootMount)
+	default:
+		return fmt.Errorf("Invalid restart mode specified: %v", o.RestartMode)
+	}
+
+	return nil
+}
+
+// SignalContainerd sends a SIGHUP signal to the containerd daemon
+func SignalContainerd(o *Options) error {
+	return signalContainerd(context.Background(), o)
+}
+
+// signalContainerd sends a SIGHUP signal to the containerd daemon. Retries are
+// aborted if the context is cancelled.
+func signalContainerd(ctx context.Context, o *Options) error {
+	log.Infof("Sending SIGHUP signal to containerd")
+
+	// Wrap the logic to perform the SIGHUP in a function so we can retry it on failure
+	retriable := func() error {
+		conn, err := net.Dial("unix", o.Socket)
+		if err != nil {
+			return fmt.Errorf("unable to dial: %v", err)
+		}
+		defer conn.Close()
+
+		sconn, err := conn.(*net.UnixConn).SyscallConn()
+		if err != nil {
+			return fmt.Errorf("unable to get syscall connection: %v", err)
+		}
+
+		err1 := sconn.Control(func(fd uintptr) {
+			err = syscall.SetsockoptInt(int(fd), syscall.SOL_SOCKET, syscall.SO_PASSCRED, 1)
+		})
+		if err1 != nil {
+			return fmt.Errorf("unable to issue call on socket fd: %v", err1)
+		}
+		if err != nil {
+			return fmt.Errorf("unable to SetsockoptInt on socket fd: %v", err)
+		}
+
+		_, _, err = conn.(*net.UnixConn).WriteMsgUnix([]byte(socketMessageToGetPID), nil, nil)
+		if err != nil {
+			return fmt.Errorf("unable to WriteMsgUnix on socket fd: %v", err)
+		}
+
+		oob := make([]byte, 1024)
+		_, oobn, _, _, err := conn.(*net.UnixConn).ReadMsgUnix(nil, oob)
+		if err != nil {
+			return fmt.Errorf("unable to ReadMsgUnix on socket fd: %v", err)
+		}
+
+		oob = oob[:oobn]
+		scm, err := syscall.ParseSocketControlMessage(oob)
+		if err != nil {
+			return fmt.Errorf("unable to ParseSocketControlMessage from message received on socket fd: %v", err)
+		}
+
+		ucred, err := syscall.ParseUnixCredentials(&scm[0])
+		if err != nil {
+			return fmt.Errorf("unable to ParseUnixCredentials from message received on socket fd: %v", err)
+		}
+
+		err = syscall.Kill(int(ucred.Pid), syscall.SIGHUP)
+		if err != nil {
+			return fmt.Errorf("unable to send SIGHUP to 'containerd' process: %v", err)
+		}
+
+		return nil
+	}
+
+	// Try to send a SIGHUP up to maxReloadAttempts times
+	var err error
+	for i := 0; i < maxReloadAttempts; i++ {
+		err = retriable()
+		if err == nil {
+			break
+		}
+		if i == maxReloadAttempts-1 {
+			break
+		}
+		log.Warnf("Error signaling containerd, attempt %v/%v: %v", i+1, maxReloadAttempts, err)
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%v: %v", ctx.Err(), err)
+		case <-time.After(reloadBackoff):
+		}
+	}
+	if err != nil {
+		log.Warnf("Max retries reached %v/%v, aborting", maxReloadAttempts, maxReloadAttempts)
+		return err
+	}
+
+	log.Infof("Successfully signaled containerd")
+
+	return nil
+}
+
+// RestartContainerdSystemd restarts containerd using systemctl
+func RestartContainerdSystemd(hostRootMount string) error {
+	return restartContainerdSystemd(context.Background(), hostRootMount)
+}
+
+// restartContainerdSystemd restarts containerd using systemctl. The restart is
+// killed if the context is cancelled.
+func restartContainerdSystemd(ctx context.Context, hostRootMount string) error {
+	log.Infof("Restarting containerd using systemd and host root mounted at %v", hostRootMount)
+
+	command := "chroot"
+	args := []string{hostRootMount, "systemctl", "restart", "containerd"}
+
+	cmd := exec.CommandContext(ctx, command, args...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	err := cmd.Run()
+	if err != nil {
+		return fmt.Errorf("error restarting containerd using systemd: %v", err)
+	}
+
+	return nil
+}
+
+// getDefaultRuntime returns the default runtime for the configured options.
+// If the configuration is invalid or the default runtimes should not be set
+// the empty string is returned.
+func (o Options) getDefaultRuntime() string {
+	if o.SetAsDefault {
+		if o.RuntimeClass == nvidiaExperimentalRuntimeName {
+			return nvidiaExperimentalRuntimeName
+		}
+		if o.RuntimeClass == "" {
+			return defaultRuntimeClass
+		}
+		return o.RuntimeClass
+	}
+	return ""
+}
+
+// ownedRuntimes returns the runtime classes to remove on cleanup. If no record
+// of the runtime classes created by the toolkit exists, the specified runtime
+// classes are returned.
+func (o Options) ownedRuntimes(runtimeClasses map[string]string) []string {
+	if o.owned != nil {
+		return o.owned.Runtimes
+	}
+
+	var names []string
+	for name := range runtimeClasses {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ownsDefaultRuntime checks whether the specified default runtime was set by
+// the toolkit. If no record of this exists, the default runtime is considered
+// to have been set by the toolkit if it is one of the specified runtime
+// classes.
+func (o Options) ownsDefaultRuntime(name string, runtimeClasses []string) bool {
+	if o.owned != nil {
+		return name != "" && name == o.owned.DefaultRuntime
+	}
+	for _, runtimeClass := range runtimeClasses {
+		if name == runtimeClass {
+			return true
+		}
+	}
+	return false
+}
+
+// runtimeClasses returns the sorted names of the runtime classes for the given
+// options
+func (o Options) runtimeClasses() []string {
+	var names []string
+	for name := range o.getRuntimeBinaries() {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// isNvidiaRuntime checks whether the specified runtime name refers to one of the
+// nvidia runtimes
+func (o Options) isNvidiaRuntime(name string) bool {
+	if _, exists := nvidiaRuntimeBinaries[name]; exists {
+		return true
+	}
+	_, exists := o.getRuntimeBinaries()[name]
+	return exists
+}
+
+// getRuntimeBinaries returns a map of runtime names to binary paths. This includes the
+// renaming of the `nvidia` runtime as per the --runtime-class command line flag.
+func (o Options) getRuntimeBinaries() map[string]string {
+	runtimeBinaries := make(map[string]string)
+
+	for rt, bin := range nvidiaRuntimeBinaries {
+		runtime := rt
+		if o.RuntimeClass != "" && o.RuntimeClass != nvidiaExperimentalRuntimeName && runtime == defaultRuntimeClass {
+			runtime = o.RuntimeClass
+		}
+
+		runtimeBinaries[runtime] = filepath.Join(o.RuntimeDir, bin)
+	}
+
+	return runtimeBinaries
+}
@@ -0,0 +1,293 @@
+/**
+# Copyright (c) 2021, NVIDIA CORPORATION.  All rights reserved.
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#     http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+*/
+
+package containerd
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"container-toolkit/internal/state"
+
+	"github.com/pelletier/go-toml"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOptions(t *testing.T) {
+	testCases := []struct {
+		options                 Options
+		expectedDefaultRuntime  string
+		expectedRuntimeBinaries map[string]string
+	}{
+		{
+			expectedRuntimeBinaries: map[string]string{
+				"nvidia":              "nvidia-container-runtime",
+				"nvidia-experimental": "nvidia-container-runtime-experimental",
+			},
+		},
+		{
+			options: Options{
+				SetAsDefault: true,
+			},
+			expectedDefaultRuntime: "nvidia",
+			expectedRuntimeBinaries: map[string]string{
+				"nvidia":              "nvidia-container-runtime",
+				"nvidia-experimental": "nvidia-container-runtime-experimental",
+			},
+		},
+		{
+			options: Options{
+				SetAsDefault: true,
+				RuntimeClass: "nvidia",
+			},
+			expectedDefaultRuntime: "nvidia",
+			expectedRuntimeBinaries: map[string]string{
+				"nvidia":              "nvidia-container-runtime",
+				"nvidia-experimental": "nvidia-container-runtime-experimental",
+			},
+		},
+		{
+			options: Options{
+				SetAsDefault: true,
+				RuntimeClass: "NAME",
+			},
+			expectedDefaultRuntime: "NAME",
+			expectedRuntimeBinaries: map[string]string{
+				"NAME":                "nvidia-container-runtime",
+				"nvidia-experimental": "nvidia-container-runtime-experimental",
+			},
+		},
+		{
+			options: Options{
+				SetAsDefault: false,
+				RuntimeClass: "NAME",
+			},
+			expectedRuntimeBinaries: map[string]string{
+				"NAME":                "nvidia-container-runtime",
+				"nvidia-experimental": "nvidia-container-runtime-experimental",
+			},
+		},
+		{
+			options: Options{
+				SetAsDefault: true,
+				RuntimeClass: "nvidia-experimental",
+			},
+			expectedDefaultRuntime: "nvidia-experimental",
+			expectedRuntimeBinaries: map[string]string{
+				"nvidia":              "nvidia-container-runtime",
+				"nvidia-experimental": "nvidia-container-runtime-experimental",
+			},
+		},
+		{
+			options: Options{
+				SetAsDefault: false,
+				RuntimeClass: "nvidia-experimental",
+			},
+			expectedRuntimeBinaries: map[string]string{
+				"nvidia":              "nvidia-container-runtime",
+				"nvidia-experimental": "nvidia-container-runtime-experimental",
+			},
+		},
+	}
+
+	for i, tc := range testCases {
+		require.Equal(t, tc.expectedDefaultRuntime, tc.options.getDefaultRuntime(), "%d: %v", i, tc)
+		require.EqualValues(t, tc.expectedRuntimeBinaries, tc.options.getRuntimeBinaries(), "%d: %v", i, tc)
+	}
+}
+
+func TestParseVersion(t *testing.T) {
+	testCases := []struct {
+		config          map[string]interface{}
+		useLegacyConfig bool
+		expectedVersion int
+		expectedError   bool
+	}{
+		{
+			expectedVersion: 2,
+		},
+		{
+			useLegacyConfig: true,
+			expectedVersion: 1,
+		},
+		{
+			config: map[string]interface{}{
+				"root": "/var/lib/containerd",
+			},
+			expectedVersion: 1,
+		},
+		{
+			config: map[string]interface{}{
+				"version": int64(2),
+			},
+			expectedVersion: 2,
+		},
+		{
+			config: map[string]interface{}{
+				"version": int64(3),
+			},
+			expectedVersion: 3,
+		},
+		{
+			config: map[string]interface{}{
+				"version": "3",
+			},
+			expectedVersion: -1,
+			expectedError:   true,
+		},
+	}
+
+	for i, tc := range testCases {
+		config, err := toml.TreeFromMap(tc.config)
+		require.NoError(t, err, "%d: %v", i, tc)
+
+		version, err := ParseVersion(config, tc.useLegacyConfig)
+		if tc.expectedError {
+			require.Error(t, err, "%d: %v", i, tc)
+		} else {
+			require.NoError(t, err, "%d: %v", i, tc)
+		}
+		require.Equal(t, tc.expectedVersion, version, "%d: %v", i, tc)
+	}
+}
+
+func TestRecordOwnership(t *testing.T) {
+	none := ""
+	runc := "runc"
+
+	testCases := []struct {
+		config                 map[string]interface{}
+		setAsDefault           bool
+		runtimeClass           string
+		expectedOwned          *state.Ownership
+		expectedDefaultRuntime *string
+	}{
+		{
+			expectedOwned: &state.Ownership{
+				Runtimes: []string{"nvidia", "nvidia-experimental"},
+			},
+		},
+		{
+			setAsDefault: true,
+			runtimeClass: "NAME",
+			expectedOwned: &state.Ownership{
+				Runtimes:       []string{"NAME", "nvidia-experimental"},
+				DefaultRuntime: "NAME",
+			},
+			expectedDefaultRuntime: &none,
+		},
+		{
+			config: map[string]interface{}{
+				"version": int64(2),
+				"plugins": map[string]interface{}{
+					"io.containerd.grpc.v1.cri": map[string]interface{}{
+						"containerd": map[string]interface{}{
+							"runtimes": map[string]interface{}{
+								"nvidia": runtimeMapV2("/usr/bin/nvidia-container-runtime"),
+							},
+							"default_runtime_name": "runc",
+						},
+					},
+				},
+			},
+			setAsDefault: true,
+			runtimeClass: "nvidia",
+			expectedOwned: &state.Ownership{
+				Runtimes:       []string{"nvidia-experimental"},
+				DefaultRuntime: "nvidia",
+			},
+			expectedDefaultRuntime: &runc,
+		},
+	}
+
+	for i, tc := range testCases {
+		o := &Options{
+			SetAsDefault: tc.setAsDefault,
+			RuntimeClass: tc.runtimeClass,
+		}
+
+		config, err := toml.TreeFromMap(tc.config)
+		require.NoError(t, err, "%d: %v", i, tc)
+
+		st := state.New("/etc/containerd/config.toml")
+		err = recordOwnership(st, config, o, 2)
+		require.NoError(t, err, "%d: %v", i, tc)
+
+		require.Equal(t, tc.expectedOwned, st.Owned, "%d: %v", i, tc)
+		require.Equal(t, tc.expectedDefaultRuntime, st.DefaultRuntime, "%d: %v", i, tc)
+	}
+}
+
+func TestSetupRollback(t *testing.T) {
+	original := "version = 2\n\n[plugins]\n  [plugins.\"io.containerd.grpc.v1.cri\"]\n    sandbox_image = \"pause\"\n"
+
+	testCases := []struct {
+		description string
+		original    *string
+		dropIn      bool
+	}{
+		{
+			description: "config did not exist",
+		},
+		{
+			description: "config existed",
+			original:    &original,
+		},
+		{
+			description: "drop-in config",
+			original:    &original,
+			dropIn:      true,
+		},
+	}
+
+	for i, tc := range testCases {
+		dir, err := ioutil.TempDir("", "containerd-test-")
+		require.NoError(t, err, "%d: %v", i, tc)
+		defer os.RemoveAll(dir)
+
+		o := Options{
+			Config:       filepath.Join(dir, "config.toml"),
+			RuntimeClass: "nvidia",
+			RuntimeType:  "io.containerd.runc.v2",
+			SetAsDefault: true,
+			RuntimeDir:   "/test/runtime/dir",
+			// An invalid restart mode causes the setup to fail after the
+			// config was flushed.
+			RestartMode: "invalid",
+		}
+		if tc.dropIn {
+			o.DropInConfig = filepath.Join(dir, "conf.d", "nvidia.toml")
+		}
+		if tc.original != nil {
+			require.NoError(t, ioutil.WriteFile(o.Config, []byte(*tc.original), 0644), "%d: %v", i, tc)
+		}
+
+		err = Setup(&o)
+		require.Error(t, err, "%d: %v", i, tc)
+
+		if tc.original == nil {
+			require.NoFileExists(t, o.Config, "%d: %v", i, tc)
+		} else {
+			contents, err := ioutil.ReadFile(o.Config)
+			require.NoError(t, err, "%d: %v", i, tc)
+			require.Equal(t, *tc.original, string(contents), "%d: %v", i, tc)
+		}
+		require.NoFileExists(t, state.Path(o.Config), "%d: %v", i, tc)
+		require.NoDirExists(t, filepath.Join(dir, "conf.d"), "%d: %v", i, tc)
+	}
+}
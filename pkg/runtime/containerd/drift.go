@@ -0,0 +1,103 @@
+/**
+# Copyright (c) 2021, NVIDIA CORPORATION.  All rights reserved.
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#     http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+*/
+
+package containerd
+
+import (
+	"fmt"
+	"strings"
+
+	"container-toolkit/internal/dryrun"
+
+	toml "github.com/pelletier/go-toml"
+)
+
+// Drift returns a diff of the changes that a setup would make to the
+// containerd config and the drop-in config, if specified. The empty string is
+// returned if the nvidia runtimes are configured as expected. Differences in
+// the formatting of the configs are ignored.
+func Drift(o *Options) (string, error) {
+	cfg, err := LoadConfig(o.Config)
+	if err != nil {
+		return "", fmt.Errorf("unable to load config: %v", err)
+	}
+
+	version, err := ParseVersion(cfg, o.UseLegacyConfig)
+	if err != nil {
+		return "", fmt.Errorf("unable to parse version: %v", err)
+	}
+
+	current, err := renderConfig(o.Config, cfg)
+	if err != nil {
+		return "", fmt.Errorf("unable to convert to TOML: %v", err)
+	}
+
+	if o.DropInConfig == "" {
+		err = UpdateConfig(cfg, o, version)
+		if err != nil {
+			return "", fmt.Errorf("unable to update config: %v", err)
+		}
+		return configDrift(o.Config, current, cfg)
+	}
+
+	dropIn, err := NewDropInConfig(cfg, o, version)
+	if err != nil {
+		return "", fmt.Errorf("unable to create drop-in config: %v", err)
+	}
+
+	currentDropIn, err := LoadConfig(o.DropInConfig)
+	if err != nil {
+		return "", fmt.Errorf("unable to load drop-in config: %v", err)
+	}
+
+	renderedDropIn, err := renderConfig(o.DropInConfig, currentDropIn)
+	if err != nil {
+		return "", fmt.Errorf("unable to convert to TOML: %v", err)
+	}
+
+	dropInDiff, err := configDrift(o.DropInConfig, renderedDropIn, dropIn)
+	if err != nil {
+		return "", err
+	}
+
+	AddImport(cfg, o.importPath(), version)
+	configDiff, err := configDrift(o.Config, current, cfg)
+	if err != nil {
+		return "", err
+	}
+
+	return dropInDiff + configDiff, nil
+}
+
+// configDrift returns a diff between the specified rendered contents of a
+// config and the contents that would be written for the specified config
+func configDrift(config string, current string, cfg *toml.Tree) (string, error) {
+	expected, err := renderConfig(config, cfg)
+	if err != nil {
+		return "", fmt.Errorf("unable to convert to TOML: %v", err)
+	}
+
+	return dryrun.Diff(config, contentsOrNil(current), contentsOrNil(expected))
+}
+
+// contentsOrNil returns the specified rendered config as bytes, or nil if the
+// config is empty and would thus not be written
+func contentsOrNil(rendered string) []byte {
+	if len(strings.TrimSpace(rendered)) == 0 {
+		return nil
+	}
+	return []byte(rendered)
+}
@@ -0,0 +1,121 @@
+/**
+# Copyright (c) 2021, NVIDIA CORPORATION.  All rights reserved.
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#     http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+*/
+
+package containerd
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDrift(t *testing.T) {
+	dir, err := ioutil.TempDir("", "containerd-drift-test-")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	o := &Options{
+		Config:       filepath.Join(dir, "config.toml"),
+		RuntimeClass: "nvidia",
+		RuntimeType:  defaultRuntmeType,
+		SetAsDefault: true,
+		RuntimeDir:   "/test/runtime/dir",
+	}
+
+	input, err := ioutil.ReadFile(filepath.Join("testdata", "render", "commented.toml"))
+	require.NoError(t, err)
+
+	configured, err := RenderConfigContents(input, o, false)
+	require.NoError(t, err)
+
+	testCases := []struct {
+		description string
+		contents    string
+		drifted     bool
+	}{
+		{
+			description: "config does not exist",
+			drifted:     true,
+		},
+		{
+			description: "runtimes are configured",
+			contents:    configured,
+		},
+		{
+			description: "comments are ignored",
+			contents:    "# A comment added by another agent\n" + configured,
+		},
+		{
+			description: "runtimes are removed",
+			contents:    string(input),
+			drifted:     true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			os.Remove(o.Config)
+			if tc.contents != "" {
+				require.NoError(t, ioutil.WriteFile(o.Config, []byte(tc.contents), 0644))
+			}
+
+			diff, err := Drift(o)
+			require.NoError(t, err)
+			if !tc.drifted {
+				require.Empty(t, diff)
+				return
+			}
+			require.Contains(t, diff, "+++ "+o.Config)
+			require.Contains(t, diff, "/test/runtime/dir/nvidia-container-runtime")
+		})
+	}
+}
+
+func TestDriftDropIn(t *testing.T) {
+	dir, err := ioutil.TempDir("", "containerd-drift-test-")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	o := &Options{
+		Config:       filepath.Join(dir, "config.toml"),
+		DropInConfig: filepath.Join(dir, "conf.d", "nvidia.toml"),
+		RuntimeClass: "nvidia",
+		RuntimeType:  defaultRuntmeType,
+		RuntimeDir:   "/test/runtime/dir",
+	}
+	require.NoError(t, ioutil.WriteFile(o.Config, []byte("version = 2\n"), 0644))
+
+	diff, err := Drift(o)
+	require.NoError(t, err)
+	require.Contains(t, diff, "+++ "+o.DropInConfig)
+	require.Contains(t, diff, "+++ "+o.Config)
+
+	require.NoError(t, SetupDropIn(o))
+
+	diff, err = Drift(o)
+	require.NoError(t, err)
+	require.Empty(t, diff)
+
+	require.NoError(t, os.Remove(o.DropInConfig))
+
+	diff, err = Drift(o)
+	require.NoError(t, err)
+	require.Contains(t, diff, "+++ "+o.DropInConfig)
+	require.NotContains(t, diff, "+++ "+o.Config)
+}
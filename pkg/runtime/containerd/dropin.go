@@ -0,0 +1,351 @@
+/**
+# Copyright (c) 2021, NVIDIA CORPORATION.  All rights reserved.
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#     http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+*/
+
+package containerd
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"container-toolkit/internal/state"
+	engine "container-toolkit/pkg/config/engine/containerd"
+
+	toml "github.com/pelletier/go-toml"
+	log "github.com/sirupsen/logrus"
+)
+
+// SetupDropIn writes the nvidia runtimes to the drop-in config file and ensures
+// that the main containerd config imports it. The drop-in config and any of
+// its parent directories that are created are recorded as owned by the toolkit
+// in the state of the main config.
+func SetupDropIn(o *Options) error {
+	return setupDropIn(o, missingDirs(filepath.Dir(o.DropInConfig)))
+}
+
+// setupDropIn sets up the drop-in config as described for SetupDropIn. The
+// specified directories, which did not exist before the setup, are recorded
+// as created by the toolkit.
+func setupDropIn(o *Options, created []string) error {
+	cfg, err := LoadConfig(o.Config)
+	if err != nil {
+		return fmt.Errorf("unable to load config: %v", err)
+	}
+
+	version, err := ParseVersion(cfg, o.UseLegacyConfig)
+	if err != nil {
+		return fmt.Errorf("unable to parse version: %v", err)
+	}
+
+	dropIn, err := NewDropInConfig(cfg, o, version)
+	if err != nil {
+		return fmt.Errorf("unable to create drop-in config: %v", err)
+	}
+
+	st, err := state.Snapshot(o.Config)
+	if err != nil {
+		return fmt.Errorf("unable to snapshot config: %v", err)
+	}
+
+	// The drop-in config is dedicated to the toolkit and is thus always
+	// considered to be owned by it.
+	st.Own().AddFile(o.DropInConfig, false)
+	for _, dir := range created {
+		st.Own().AddDir(dir)
+	}
+
+	err = st.Save()
+	if err != nil {
+		return fmt.Errorf("unable to save config state: %v", err)
+	}
+
+	err = os.MkdirAll(filepath.Dir(o.DropInConfig), 0755)
+	if err != nil {
+		return fmt.Errorf("unable to create drop-in config directory: %v", err)
+	}
+
+	err = FlushConfig(o.DropInConfig, dropIn)
+	if err != nil {
+		return fmt.Errorf("unable to flush drop-in config: %v", err)
+	}
+
+	if AddImport(cfg, o.importPath(), version) {
+		err = FlushConfig(o.Config, cfg)
+		if err != nil {
+			return fmt.Errorf("unable to flush config: %v", err)
+		}
+	} else {
+		log.Infof("Drop-in config %v is already imported by %v", o.DropInConfig, o.Config)
+	}
+
+	err = st.Update()
+	if err != nil {
+		return fmt.Errorf("unable to update config state: %v", err)
+	}
+
+	return nil
+}
+
+// CleanupDropIn removes the drop-in config files and their entries in the
+// imports of the main containerd config. If the state of the main config
+// records the drop-in configs created by the toolkit, these are removed
+// instead of the drop-in config specified in the options.
+func CleanupDropIn(o *Options) error {
+	st, err := state.Load(o.Config)
+	if err != nil {
+		return fmt.Errorf("unable to load config state: %v", err)
+	}
+
+	dropIns := o.ownedDropIns(st)
+	for _, dropIn := range dropIns {
+		log.Infof("Removing drop-in config: %v", dropIn)
+		err := os.Remove(dropIn)
+		if err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("unable to remove drop-in config: %v", err)
+		}
+	}
+
+	if st != nil && st.Owned != nil {
+		err := removeDirs(st.Owned.Dirs)
+		if err != nil {
+			return err
+		}
+	}
+
+	if st != nil {
+		restored, err := st.Restore()
+		if err != nil {
+			return fmt.Errorf("unable to restore config: %v", err)
+		}
+
+		err = st.Remove()
+		if err != nil {
+			return fmt.Errorf("unable to remove config state: %v", err)
+		}
+
+		if restored {
+			return nil
+		}
+	}
+
+	cfg, err := LoadConfig(o.Config)
+	if err != nil {
+		return fmt.Errorf("unable to load config: %v", err)
+	}
+
+	modified := false
+	for _, dropIn := range dropIns {
+		if !RemoveImport(cfg, importPath(o.Config, dropIn)) {
+			log.Infof("Drop-in config %v is not imported by %v", dropIn, o.Config)
+			continue
+		}
+		modified = true
+	}
+
+	if !modified {
+		return nil
+	}
+
+	err = FlushConfig(o.Config, cfg)
+	if err != nil {
+		return fmt.Errorf("unable to flush config: %v", err)
+	}
+
+	return nil
+}
+
+// NewDropInConfig creates a config containing the nvidia runtimes for the
+// specified config version. Since older containerd versions replace (instead
+// of merge) a plugin section that is defined in an imported file, the CRI
+// plugin section of the main config is copied to the drop-in as is.
+func NewDropInConfig(config *toml.Tree, o *Options, version int) (*toml.Tree, error) {
+	if version < 2 {
+		return nil, fmt.Errorf("drop-in configs are not supported for containerd config version %v", version)
+	}
+
+	cri, err := engine.CRIPlugin(version)
+	if err != nil {
+		return nil, err
+	}
+
+	dropIn, err := toml.TreeFromMap(map[string]interface{}{})
+	if err != nil {
+		return nil, err
+	}
+
+	criPath := []string{"plugins", cri}
+	if plugin, ok := config.GetPath(criPath).(*toml.Tree); ok {
+		plugin, err = toml.Load(plugin.String())
+		if err != nil {
+			return nil, fmt.Errorf("unable to copy %v plugin config: %v", cri, err)
+		}
+		dropIn.SetPath(criPath, plugin)
+	}
+
+	err = UpdateConfig(dropIn, o, version)
+	if err != nil {
+		return nil, err
+	}
+
+	return dropIn, nil
+}
+
+// AddImport adds the specified path to the imports of the containerd config
+// unless an existing entry already matches it. The version of the config is
+// set if not present since imports are only supported from version 2. The
+// return value indicates whether the config was modified.
+func AddImport(config *toml.Tree, path string, version int) bool {
+	if isImported(config, path) {
+		return false
+	}
+
+	if config.Get("version") == nil {
+		config.Set("version", int64(version))
+	}
+	config.Set("imports", append(getImports(config), path))
+
+	return true
+}
+
+// isImported checks whether an entry of the imports of the containerd config
+// matches the specified path
+func isImported(config *toml.Tree, path string) bool {
+	for _, i := range getImports(config) {
+		if matched, _ := filepath.Match(i, path); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// RemoveImport removes the specified path from the imports of the containerd
+// config. The return value indicates whether the config was modified.
+func RemoveImport(config *toml.Tree, path string) bool {
+	var imports []string
+	var removed bool
+	for _, i := range getImports(config) {
+		if i == path {
+			removed = true
+			continue
+		}
+		imports = append(imports, i)
+	}
+	if !removed {
+		return false
+	}
+
+	if len(imports) == 0 {
+		config.Delete("imports")
+	} else {
+		config.Set("imports", imports)
+	}
+
+	if len(config.Keys()) == 1 && config.Keys()[0] == "version" {
+		config.Delete("version")
+	}
+
+	return true
+}
+
+func getImports(config *toml.Tree) []string {
+	var imports []string
+	switch values := config.Get("imports").(type) {
+	case []string:
+		imports = append(imports, values...)
+	case []interface{}:
+		for _, v := range values {
+			if s, ok := v.(string); ok {
+				imports = append(imports, s)
+			}
+		}
+	}
+	return imports
+}
+
+// ownedDropIns returns the drop-in configs to remove on cleanup. If the
+// specified state records the drop-in configs created by the toolkit, these
+// are returned. Otherwise the drop-in config specified in the options is
+// returned.
+func (o Options) ownedDropIns(st *state.State) []string {
+	if st != nil && st.Owned != nil {
+		return st.Owned.Files
+	}
+	return []string{o.DropInConfig}
+}
+
+// missingDirs returns the specified directory and those of its parents that
+// do not exist, with parents listed before their subdirectories
+func missingDirs(path string) []string {
+	var missing []string
+	for dir := filepath.Clean(path); ; dir = filepath.Dir(dir) {
+		if _, err := os.Stat(dir); err == nil {
+			break
+		}
+		missing = append([]string{dir}, missing...)
+		if dir == filepath.Dir(dir) {
+			break
+		}
+	}
+	return missing
+}
+
+// removeDirs removes the specified directories, starting with the last one. A
+// directory that is not empty (e.g. because it contains other drop-in configs)
+// is left in place.
+func removeDirs(dirs []string) error {
+	for i := len(dirs) - 1; i >= 0; i-- {
+		entries, err := ioutil.ReadDir(dirs[i])
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("unable to read directory: %v", err)
+		}
+		if len(entries) > 0 {
+			log.Infof("Leaving directory %v in place since it is not empty", dirs[i])
+			continue
+		}
+
+		log.Infof("Removing directory: %v", dirs[i])
+		err = os.Remove(dirs[i])
+		if err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("unable to remove directory: %v", err)
+		}
+	}
+	return nil
+}
+
+// importPath returns the path of the drop-in config as it is added to the
+// imports of the main config. containerd resolves relative imports with
+// respect to the directory of the main config, which means that a drop-in in
+// a subdirectory of that directory is referenced independently of where the
+// directory is mounted in this container.
+func (o Options) importPath() string {
+	return importPath(o.Config, o.DropInConfig)
+}
+
+// importPath returns the path of the specified drop-in config as imported by
+// the specified main config.
+func importPath(config string, dropIn string) string {
+	configDir := filepath.Dir(config)
+	relative, err := filepath.Rel(configDir, dropIn)
+	if err != nil || strings.HasPrefix(relative, "..") {
+		return dropIn
+	}
+	return relative
+}
@@ -0,0 +1,290 @@
+/**
+# Copyright (c) 2021, NVIDIA CORPORATION.  All rights reserved.
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#     http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+*/
+
+package containerd
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"container-toolkit/internal/state"
+
+	"github.com/pelletier/go-toml"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewDropInConfig(t *testing.T) {
+	const runtimeDir = "/test/runtime/dir"
+
+	testCases := []struct {
+		version       int
+		config        map[string]interface{}
+		expectedPath  []string
+		expectedError bool
+	}{
+		{
+			version:       1,
+			expectedError: true,
+		},
+		{
+			version:      2,
+			expectedPath: []string{"plugins", "io.containerd.grpc.v1.cri", "containerd"},
+		},
+		{
+			version:      2,
+			config:       runcConfigMapV2("/runc-binary"),
+			expectedPath: []string{"plugins", "io.containerd.grpc.v1.cri", "containerd"},
+		},
+		{
+			version:      3,
+			config:       runcConfigMapV3("/runc-binary"),
+			expectedPath: []string{"plugins", "io.containerd.cri.v1.runtime", "containerd"},
+		},
+	}
+
+	for i, tc := range testCases {
+		o := &Options{
+			RuntimeClass: "nvidia",
+			RuntimeType:  runtimeType,
+			RuntimeDir:   runtimeDir,
+			SetAsDefault: true,
+		}
+
+		config, err := toml.TreeFromMap(tc.config)
+		require.NoError(t, err, "%d: %v", i, tc)
+		original := config.String()
+
+		dropIn, err := NewDropInConfig(config, o, tc.version)
+		if tc.expectedError {
+			require.Error(t, err, "%d: %v", i, tc)
+			continue
+		}
+		require.NoError(t, err, "%d: %v", i, tc)
+
+		require.Equal(t, original, config.String(), "%d: %v", i, tc)
+		require.EqualValues(t, tc.version, dropIn.Get("version"), "%d: %v", i, tc)
+		require.Equal(t, "nvidia", dropIn.GetPath(append(tc.expectedPath, "default_runtime_name")), "%d: %v", i, tc)
+
+		runtimes, ok := dropIn.GetPath(append(tc.expectedPath, "runtimes")).(*toml.Tree)
+		require.True(t, ok, "%d: %v", i, tc)
+
+		expectedRuntimes := []string{"nvidia", "nvidia-experimental"}
+		if tc.config != nil {
+			expectedRuntimes = append(expectedRuntimes, "runc")
+		}
+		require.ElementsMatch(t, expectedRuntimes, runtimes.Keys(), "%d: %v", i, tc)
+	}
+}
+
+func TestAddAndRemoveImport(t *testing.T) {
+	testCases := []struct {
+		config           map[string]interface{}
+		path             string
+		expectedAdded    bool
+		expectedImports  []string
+		expectedReverted map[string]interface{}
+	}{
+		{
+			path:            "conf.d/99-nvidia.toml",
+			expectedAdded:   true,
+			expectedImports: []string{"conf.d/99-nvidia.toml"},
+		},
+		{
+			config: map[string]interface{}{
+				"version": int64(2),
+				"imports": []interface{}{"/etc/containerd/other.toml"},
+			},
+			path:            "conf.d/99-nvidia.toml",
+			expectedAdded:   true,
+			expectedImports: []string{"/etc/containerd/other.toml", "conf.d/99-nvidia.toml"},
+			expectedReverted: map[string]interface{}{
+				"version": int64(2),
+				"imports": []interface{}{"/etc/containerd/other.toml"},
+			},
+		},
+		{
+			config: map[string]interface{}{
+				"version": int64(2),
+				"imports": []interface{}{"/etc/containerd/conf.d/*.toml"},
+			},
+			path:            "/etc/containerd/conf.d/99-nvidia.toml",
+			expectedAdded:   false,
+			expectedImports: []string{"/etc/containerd/conf.d/*.toml"},
+			expectedReverted: map[string]interface{}{
+				"version": int64(2),
+				"imports": []interface{}{"/etc/containerd/conf.d/*.toml"},
+			},
+		},
+		{
+			config: map[string]interface{}{
+				"root": "/var/lib/containerd",
+			},
+			path:            "conf.d/99-nvidia.toml",
+			expectedAdded:   true,
+			expectedImports: []string{"conf.d/99-nvidia.toml"},
+			expectedReverted: map[string]interface{}{
+				"version": int64(2),
+				"root":    "/var/lib/containerd",
+			},
+		},
+	}
+
+	for i, tc := range testCases {
+		config, err := toml.TreeFromMap(tc.config)
+		require.NoError(t, err, "%d: %v", i, tc)
+
+		added := AddImport(config, tc.path, 2)
+		require.Equal(t, tc.expectedAdded, added, "%d: %v", i, tc)
+		require.Equal(t, tc.expectedImports, getImports(config), "%d: %v", i, tc)
+		require.EqualValues(t, int64(2), config.Get("version"), "%d: %v", i, tc)
+
+		removed := RemoveImport(config, tc.path)
+		require.Equal(t, tc.expectedAdded, removed, "%d: %v", i, tc)
+
+		expected, err := toml.TreeFromMap(tc.expectedReverted)
+		require.NoError(t, err, "%d: %v", i, tc)
+		require.Equal(t, expected.String(), config.String(), "%d: %v", i, tc)
+	}
+}
+
+func TestSetupDropInAlreadyImported(t *testing.T) {
+	dir, err := ioutil.TempDir("", "containerd-dropin-test-")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	o := &Options{
+		Config:       filepath.Join(dir, "config.toml"),
+		DropInConfig: filepath.Join(dir, "conf.d", "nvidia.toml"),
+		RuntimeClass: "nvidia",
+		RuntimeType:  defaultRuntmeType,
+		RuntimeDir:   "/test/runtime/dir",
+	}
+	original := "version = 2\nimports = [\"conf.d/*.toml\"]\n"
+	require.NoError(t, ioutil.WriteFile(o.Config, []byte(original), 0644))
+	require.NoError(t, os.MkdirAll(filepath.Dir(o.DropInConfig), 0755))
+
+	require.NoError(t, SetupDropIn(o))
+
+	st, err := state.Load(o.Config)
+	require.NoError(t, err)
+	require.True(t, st.IsUnmodified())
+
+	require.NoError(t, CleanupDropIn(o))
+
+	contents, err := ioutil.ReadFile(o.Config)
+	require.NoError(t, err)
+	require.Equal(t, original, string(contents))
+	require.NoFileExists(t, o.DropInConfig)
+	require.NoFileExists(t, state.Path(o.Config))
+}
+
+func TestSetupDropInCreatesDirectory(t *testing.T) {
+	dir, err := ioutil.TempDir("", "containerd-dropin-test-")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	o := &Options{
+		Config:       filepath.Join(dir, "config.toml"),
+		DropInConfig: filepath.Join(dir, "conf.d", "nvidia", "nvidia.toml"),
+		RuntimeClass: "nvidia",
+		RuntimeType:  defaultRuntmeType,
+		RuntimeDir:   "/test/runtime/dir",
+	}
+	require.NoError(t, ioutil.WriteFile(o.Config, []byte("version = 2\n"), 0644))
+
+	require.NoError(t, SetupDropIn(o))
+	require.FileExists(t, o.DropInConfig)
+
+	st, err := state.Load(o.Config)
+	require.NoError(t, err)
+	require.Equal(t, []string{filepath.Join(dir, "conf.d"), filepath.Join(dir, "conf.d", "nvidia")}, st.Owned.Dirs)
+
+	// A directory that is not empty is left in place
+	other := filepath.Join(dir, "conf.d", "other.toml")
+	require.NoError(t, ioutil.WriteFile(other, nil, 0644))
+
+	require.NoError(t, CleanupDropIn(o))
+	require.NoDirExists(t, filepath.Join(dir, "conf.d", "nvidia"))
+	require.FileExists(t, other)
+}
+
+func TestLoadRuntimesDropIn(t *testing.T) {
+	dir, err := ioutil.TempDir("", "containerd-dropin-test-")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	o := &Options{
+		Config:       filepath.Join(dir, "config.toml"),
+		DropInConfig: filepath.Join(dir, "conf.d", "nvidia.toml"),
+		RuntimeClass: "nvidia",
+		RuntimeType:  defaultRuntmeType,
+		RuntimeDir:   "/test/runtime/dir",
+		SetAsDefault: true,
+	}
+	require.NoError(t, ioutil.WriteFile(o.Config, []byte("version = 2\n"), 0644))
+	require.NoError(t, os.MkdirAll(filepath.Dir(o.DropInConfig), 0755))
+
+	require.NoError(t, SetupDropIn(o))
+
+	cfg, names, err := LoadRuntimes(o)
+	require.NoError(t, err)
+	require.Equal(t, []string{"nvidia", "nvidia-experimental"}, names)
+	require.True(t, cfg.HasRuntime("nvidia"))
+	require.Equal(t, "nvidia", cfg.DefaultRuntime())
+
+	// The runtimes of a drop-in config that is no longer imported are not
+	// configured
+	require.NoError(t, ioutil.WriteFile(o.Config, []byte("version = 2\n"), 0644))
+
+	cfg, _, err = LoadRuntimes(o)
+	require.NoError(t, err)
+	require.False(t, cfg.HasRuntime("nvidia"))
+	require.Equal(t, "", cfg.DefaultRuntime())
+}
+
+func TestImportPath(t *testing.T) {
+	testCases := []struct {
+		config       string
+		dropInConfig string
+		expected     string
+	}{
+		{
+			config:       "/etc/containerd/config.toml",
+			dropInConfig: "/etc/containerd/conf.d/99-nvidia.toml",
+			expected:     "conf.d/99-nvidia.toml",
+		},
+		{
+			config:       "/runtime/config-dir/config.toml",
+			dropInConfig: "/runtime/config-dir/conf.d/99-nvidia.toml",
+			expected:     "conf.d/99-nvidia.toml",
+		},
+		{
+			config:       "/etc/containerd/config.toml",
+			dropInConfig: "/etc/nvidia/containerd.toml",
+			expected:     "/etc/nvidia/containerd.toml",
+		},
+	}
+
+	for i, tc := range testCases {
+		o := Options{
+			Config:       tc.config,
+			DropInConfig: tc.dropInConfig,
+		}
+		require.Equal(t, tc.expected, o.importPath(), "%d: %v", i, tc)
+	}
+}
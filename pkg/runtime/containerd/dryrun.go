@@ -0,0 +1,153 @@
+/**
+# Copyright (c) 2021, NVIDIA CORPORATION.  All rights reserved.
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#     http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+*/
+
+package containerd
+
+import (
+	"fmt"
+	"strings"
+
+	"container-toolkit/internal/dryrun"
+	"container-toolkit/internal/state"
+
+	toml "github.com/pelletier/go-toml"
+)
+
+// SetupDryRun prints the changes that a setup would make to the containerd
+// config and the drop-in config, if specified.
+func SetupDryRun(o *Options) error {
+	cfg, err := LoadConfig(o.Config)
+	if err != nil {
+		return fmt.Errorf("unable to load config: %v", err)
+	}
+
+	version, err := ParseVersion(cfg, o.UseLegacyConfig)
+	if err != nil {
+		return fmt.Errorf("unable to parse version: %v", err)
+	}
+
+	if o.DropInConfig == "" {
+		err = UpdateConfig(cfg, o, version)
+		if err != nil {
+			return fmt.Errorf("unable to update config: %v", err)
+		}
+		return printConfigDiff(o.Config, cfg)
+	}
+
+	dropIn, err := NewDropInConfig(cfg, o, version)
+	if err != nil {
+		return fmt.Errorf("unable to create drop-in config: %v", err)
+	}
+
+	err = printConfigDiff(o.DropInConfig, dropIn)
+	if err != nil {
+		return err
+	}
+
+	if !AddImport(cfg, o.importPath(), version) {
+		return nil
+	}
+	return printConfigDiff(o.Config, cfg)
+}
+
+// CleanupDryRun prints the changes that a cleanup would make to the
+// containerd config and the drop-in configs, if specified.
+func CleanupDryRun(o *Options) error {
+	st, err := state.Load(o.Config)
+	if err != nil {
+		return fmt.Errorf("unable to load config state: %v", err)
+	}
+
+	var dropIns []string
+	if o.DropInConfig != "" {
+		dropIns = o.ownedDropIns(st)
+	}
+
+	for _, dropIn := range dropIns {
+		current, err := dryrun.ReadFile(dropIn)
+		if err != nil {
+			return err
+		}
+
+		err = dryrun.PrintDiff(dropIn, current, nil)
+		if err != nil {
+			return err
+		}
+	}
+
+	if st != nil && st.CanRestore() {
+		current, err := dryrun.ReadFile(o.Config)
+		if err != nil {
+			return err
+		}
+
+		var original []byte
+		if st.Original.Exists {
+			original = st.Original.Contents
+		}
+		return dryrun.PrintDiff(o.Config, current, original)
+	}
+
+	if st != nil {
+		o.previousDefaultRuntime = st.DefaultRuntime
+		o.owned = st.Owned
+	}
+
+	cfg, err := LoadConfig(o.Config)
+	if err != nil {
+		return fmt.Errorf("unable to load config: %v", err)
+	}
+
+	if o.DropInConfig != "" {
+		for _, dropIn := range dropIns {
+			RemoveImport(cfg, importPath(o.Config, dropIn))
+		}
+		return printConfigDiff(o.Config, cfg)
+	}
+
+	version, err := ParseVersion(cfg, o.UseLegacyConfig)
+	if err != nil {
+		return fmt.Errorf("unable to parse version: %v", err)
+	}
+
+	err = RevertConfig(cfg, o, version)
+	if err != nil {
+		return fmt.Errorf("unable to update config: %v", err)
+	}
+
+	return printConfigDiff(o.Config, cfg)
+}
+
+// printConfigDiff prints a diff between the specified config file on disk and
+// the contents that would be written for the specified config by FlushConfig.
+func printConfigDiff(config string, cfg *toml.Tree) error {
+	current, err := dryrun.ReadFile(config)
+	if err != nil {
+		return err
+	}
+
+	output, err := renderConfig(config, cfg)
+	if err != nil {
+		return fmt.Errorf("unable to convert to TOML: %v", err)
+	}
+
+	var updated []byte
+	if len(strings.TrimSpace(output)) > 0 {
+		updated = []byte(output)
+	}
+
+	return dryrun.PrintDiff(config, current, updated)
+}
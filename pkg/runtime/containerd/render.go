@@ -0,0 +1,50 @@
+/**
+# Copyright (c) 2021, NVIDIA CORPORATION.  All rights reserved.
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#     http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+*/
+
+package containerd
+
+import (
+	"fmt"
+)
+
+// RenderConfigContents returns the contents of the specified containerd config
+// with the nvidia runtimes added or, if revert is set, removed.
+func RenderConfigContents(input []byte, o *Options, revert bool) (string, error) {
+	if o.DropInConfig != "" {
+		return "", fmt.Errorf("drop-in configs are not supported by the render command")
+	}
+
+	cfg, err := ParseConfig(input)
+	if err != nil {
+		return "", fmt.Errorf("unable to parse config: %v", err)
+	}
+
+	version, err := ParseVersion(cfg, o.UseLegacyConfig)
+	if err != nil {
+		return "", fmt.Errorf("unable to parse version: %v", err)
+	}
+
+	if revert {
+		err = RevertConfig(cfg, o, version)
+	} else {
+		err = UpdateConfig(cfg, o, version)
+	}
+	if err != nil {
+		return "", fmt.Errorf("unable to update config: %v", err)
+	}
+
+	return RenderConfig(input, cfg)
+}
@@ -0,0 +1,87 @@
+/**
+# Copyright (c) 2021, NVIDIA CORPORATION.  All rights reserved.
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#     http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+*/
+
+package containerd
+
+import (
+	"flag"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+var updateGolden = flag.Bool("update", false, "update the golden files of the render tests")
+
+func TestRenderConfigContents(t *testing.T) {
+	testCases := []struct {
+		input        string
+		runtimeClass string
+		setAsDefault bool
+		revert       bool
+		golden       string
+	}{
+		{
+			input:        "empty.toml",
+			runtimeClass: "nvidia",
+			golden:       "empty.golden.toml",
+		},
+		{
+			input:        "commented.toml",
+			runtimeClass: "nvidia",
+			golden:       "commented.golden.toml",
+		},
+		{
+			input:        "commented.toml",
+			runtimeClass: "NAME",
+			setAsDefault: true,
+			golden:       "commented-default.golden.toml",
+		},
+		{
+			input:        "commented.golden.toml",
+			runtimeClass: "nvidia",
+			revert:       true,
+			golden:       "commented-reverted.golden.toml",
+		},
+	}
+
+	for i, tc := range testCases {
+		o := &Options{
+			RuntimeClass: tc.runtimeClass,
+			RuntimeType:  defaultRuntmeType,
+			SetAsDefault: tc.setAsDefault,
+			RuntimeDir:   "/test/runtime/dir",
+		}
+
+		input, err := ioutil.ReadFile(filepath.Join("testdata", "render", tc.input))
+		require.NoError(t, err, "%d: %v", i, tc)
+
+		output, err := RenderConfigContents(input, o, tc.revert)
+		require.NoError(t, err, "%d: %v", i, tc)
+
+		golden := filepath.Join("testdata", "render", tc.golden)
+		if *updateGolden {
+			err = ioutil.WriteFile(golden, []byte(output), 0644)
+			require.NoError(t, err, "%d: %v", i, tc)
+		}
+
+		expected, err := ioutil.ReadFile(golden)
+		require.NoError(t, err, "%d: %v", i, tc)
+
+		require.Equal(t, string(expected), output, "%d: %v", i, tc)
+	}
+}
@@ -0,0 +1,260 @@
+/**
+# Copyright (c) 2021, NVIDIA CORPORATION.  All rights reserved.
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#     http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+*/
+package crio
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"container-toolkit/internal/dryrun"
+	"container-toolkit/internal/journal"
+	"container-toolkit/internal/state"
+	"container-toolkit/internal/transaction"
+	engine "container-toolkit/pkg/config/engine/crio"
+
+	hooks "github.com/containers/podman/v2/pkg/hooks/1.0.0"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	defaultHooksDir     = "/usr/share/containers/oci/hooks.d"
+	defaultHookFilename = "oci-nvidia-hook.json"
+	hooksStateName      = "nvidia-hooks"
+	toolkitExecutable   = "nvidia-container-toolkit"
+)
+
+// Options defines the options for creating the cri-o hooks
+type Options struct {
+	// HooksDir is the path to the cri-o hooks directory
+	HooksDir string `yaml:"hooksDir"`
+	// HookFilename is the filename of the hook in the hooks directory
+	HookFilename string `yaml:"hookFilename"`
+	// ToolkitDir is the directory containing the nvidia-container-toolkit executable
+	ToolkitDir string `yaml:"-"`
+	// DryRun specifies that the file operations are printed instead of performed
+	DryRun bool `yaml:"dryRun"`
+}
+
+// Setup installs the prestart hook required to launch GPU-enabled containers.
+// If a step fails, the hooks directory is left as it was before the setup.
+func Setup(o *Options) error {
+	return transaction.Run(func(tx *transaction.Transaction) error {
+		return SetupWithRollback(context.Background(), o, tx)
+	})
+}
+
+// SetupWithRollback installs the prestart hook as for Setup. The changes made
+// are registered with the specified transaction instead of being rolled back
+// on failure. This allows these to be rolled back along with later steps. If
+// the context is cancelled, the setup is aborted and an error is returned.
+func SetupWithRollback(ctx context.Context, o *Options, tx *transaction.Transaction) error {
+	log.Infof("Starting 'setup' for crio")
+
+	if o.DryRun {
+		return dryrun.PrintOperation("write", getHookPath(o.HooksDir, o.HookFilename))
+	}
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	err := tx.MkdirAll(o.HooksDir, 0755)
+	if err != nil {
+		return fmt.Errorf("error creating hooks directory %v: %v", o.HooksDir, err)
+	}
+
+	// The creation of the hook is recorded before its write, so that on replay
+	// it is only removed if restoring the file leaves it in place
+	hookPath := getHookPath(o.HooksDir, o.HookFilename)
+	if _, err := os.Stat(hookPath); os.IsNotExist(err) {
+		err := tx.Record(journal.Entry{Op: journal.OpCreateHook, Runtime: "crio", Path: hookPath})
+		if err != nil {
+			return fmt.Errorf("error recording hook in journal: %v", err)
+		}
+	}
+
+	for _, path := range []string{state.Path(StatePath(o.HooksDir)), hookPath} {
+		err = tx.BackupFile(path)
+		if err != nil {
+			return fmt.Errorf("error backing up hooks: %v", err)
+		}
+	}
+
+	st, err := state.Load(StatePath(o.HooksDir))
+	if err != nil {
+		return fmt.Errorf("error loading hooks state: %v", err)
+	}
+	if st == nil {
+		st = state.New(StatePath(o.HooksDir))
+	}
+
+	st.Own().AddFile(hookPath, isForeignHook(hookPath))
+
+	err = st.Save()
+	if err != nil {
+		return fmt.Errorf("error saving hooks state: %v", err)
+	}
+
+	cfg, err := engine.Load(o.HooksDir)
+	if err != nil {
+		return fmt.Errorf("error loading hooks: %v", err)
+	}
+
+	err = cfg.AddRuntime(o.HookFilename, getToolkitPath(o.ToolkitDir), false)
+	if err != nil {
+		return fmt.Errorf("error creating hook: %v", err)
+	}
+
+	err = cfg.Save(o.HooksDir)
+	if err != nil {
+		return fmt.Errorf("error creating hook: %v", err)
+	}
+
+	return nil
+}
+
+// Cleanup removes the prestart hooks created by the toolkit. If no record of
+// the created hooks exists, the specified prestart hook is removed.
+func Cleanup(o *Options) error {
+	log.Infof("Starting 'cleanup' for crio")
+
+	st, err := state.Load(StatePath(o.HooksDir))
+	if err != nil {
+		return fmt.Errorf("error loading hooks state: %v", err)
+	}
+
+	if o.DryRun {
+		return cleanupDryRun(o, st)
+	}
+
+	if st == nil || st.Owned == nil {
+		hookPath := getHookPath(o.HooksDir, o.HookFilename)
+		if _, err := os.Stat(hookPath); err != nil {
+			return fmt.Errorf("error removing hook '%v': %v", hookPath, err)
+		}
+		err := removeHook(hookPath)
+		if err != nil {
+			return err
+		}
+	} else {
+		for _, hookPath := range st.Owned.Files {
+			log.Infof("Removing hook '%v'", hookPath)
+			err := removeHook(hookPath)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	if st != nil {
+		err = st.Remove()
+		if err != nil {
+			return fmt.Errorf("error removing hooks state: %v", err)
+		}
+	}
+
+	return nil
+}
+
+// cleanupDryRun prints the hooks that a cleanup would remove
+func cleanupDryRun(o *Options, st *state.State) error {
+	hookPaths := []string{getHookPath(o.HooksDir, o.HookFilename)}
+	if st != nil && st.Owned != nil {
+		hookPaths = st.Owned.Files
+	}
+
+	for _, hookPath := range hookPaths {
+		if _, err := os.Stat(hookPath); os.IsNotExist(err) {
+			continue
+		}
+		err := dryrun.PrintOperation("remove", hookPath)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// removeHook removes the hook at the specified path from its hooks directory
+func removeHook(hookPath string) error {
+	hooksDir, hookFilename := filepath.Split(hookPath)
+
+	cfg, err := engine.Load(hooksDir)
+	if err != nil {
+		return fmt.Errorf("error loading hooks: %v", err)
+	}
+
+	err = cfg.RemoveRuntime(hookFilename)
+	if err != nil {
+		return fmt.Errorf("error removing hook '%v': %v", hookPath, err)
+	}
+
+	err = cfg.Save(hooksDir)
+	if err != nil {
+		return fmt.Errorf("error removing hook '%v': %v", hookPath, err)
+	}
+	return nil
+}
+
+// LoadRuntimes loads the hooks in the hooks directory and returns these along
+// with the filename of the prestart hook for the specified options. The
+// filename is also returned if the hooks cannot be loaded.
+func LoadRuntimes(o *Options) (*engine.Config, []string, error) {
+	names := []string{o.HookFilename}
+	cfg, err := engine.Load(o.HooksDir)
+	if err != nil {
+		return nil, names, err
+	}
+	return cfg, names, nil
+}
+
+func getHookPath(hooksDir string, hookFilename string) string {
+	return filepath.Join(hooksDir, hookFilename)
+}
+
+// StatePath returns the path for which the state of the hooks created by the
+// toolkit is recorded. The state is stored in the hooks directory itself and
+// is ignored by cri-o since it does not have a .json extension.
+func StatePath(hooksDir string) string {
+	return filepath.Join(hooksDir, hooksStateName)
+}
+
+// isForeignHook checks whether a hook file exists at the specified path that
+// was not generated by the toolkit. Such a hook is overwritten on setup, but
+// is not recorded as created by the toolkit.
+func isForeignHook(hookPath string) bool {
+	contents, err := ioutil.ReadFile(hookPath)
+	if err != nil {
+		return false
+	}
+
+	var hook hooks.Hook
+	err = json.Unmarshal(contents, &hook)
+	if err != nil {
+		return true
+	}
+	return filepath.Base(hook.Hook.Path) != toolkitExecutable
+}
+
+// getToolkitPath returns the path to the nvidia-container-toolkit executable
+// in the specified toolkit directory
+func getToolkitPath(toolkitDir string) string {
+	return filepath.Join(toolkitDir, toolkitExecutable)
+}
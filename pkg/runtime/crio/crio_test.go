@@ -0,0 +1,58 @@
+/**
+# Copyright (c) 2021, NVIDIA CORPORATION.  All rights reserved.
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#     http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+*/
+
+package crio
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"container-toolkit/internal/state"
+	"container-toolkit/internal/transaction"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSetupRollback(t *testing.T) {
+	dir, err := ioutil.TempDir("", "crio-test-")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	o := Options{
+		HooksDir:     filepath.Join(dir, "hooks.d"),
+		HookFilename: "oci-nvidia-hook.json",
+		ToolkitDir:   "/test/toolkit/dir",
+	}
+	require.NoError(t, os.MkdirAll(o.HooksDir, 0755))
+
+	err = transaction.Run(func(tx *transaction.Transaction) error {
+		err := SetupWithRollback(context.Background(), &o, tx)
+		require.NoError(t, err)
+		require.FileExists(t, getHookPath(o.HooksDir, o.HookFilename))
+		require.FileExists(t, state.Path(StatePath(o.HooksDir)))
+
+		return fmt.Errorf("later step failed")
+	})
+	require.Error(t, err)
+
+	require.NoFileExists(t, getHookPath(o.HooksDir, o.HookFilename))
+	require.NoFileExists(t, state.Path(StatePath(o.HooksDir)))
+	require.DirExists(t, o.HooksDir)
+}
@@ -0,0 +1,72 @@
+/**
+# Copyright (c) 2021, NVIDIA CORPORATION.  All rights reserved.
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#     http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+*/
+
+package crio
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"container-toolkit/internal/dryrun"
+	engine "container-toolkit/pkg/config/engine/crio"
+)
+
+// Drift returns a diff of the changes that a setup would make to the prestart
+// hook. The empty string is returned if the hook is installed as expected.
+// Differences in the formatting of the hook are ignored.
+func Drift(o *Options) (string, error) {
+	hookPath := getHookPath(o.HooksDir, o.HookFilename)
+
+	cfg, err := engine.Load(o.HooksDir)
+	if err != nil {
+		return "", fmt.Errorf("error loading hooks: %v", err)
+	}
+
+	var current []byte
+	if cfg.HasRuntime(o.HookFilename) {
+		current, err = renderHook(cfg, o.HookFilename)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	err = cfg.AddRuntime(o.HookFilename, getToolkitPath(o.ToolkitDir), false)
+	if err != nil {
+		return "", fmt.Errorf("error creating hook: %v", err)
+	}
+
+	expected, err := renderHook(cfg, o.HookFilename)
+	if err != nil {
+		return "", err
+	}
+
+	return dryrun.Diff(hookPath, current, expected)
+}
+
+// renderHook returns the JSON representation of the hook with the specified
+// filename. A hook that cannot be parsed is rendered as an empty document.
+func renderHook(cfg *engine.Config, hookFilename string) ([]byte, error) {
+	hook := cfg.Hook(hookFilename)
+	if hook == nil {
+		return []byte("{}\n"), nil
+	}
+
+	contents, err := json.MarshalIndent(hook, "", "    ")
+	if err != nil {
+		return nil, fmt.Errorf("error converting hook to JSON: %v", err)
+	}
+	return append(contents, '\n'), nil
+}
@@ -0,0 +1,614 @@
+/**
+# Copyright (c) 2021, NVIDIA CORPORATION.  All rights reserved.
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#     http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+*/
+
+package docker
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"path/filepath"
+	"sort"
+	"syscall"
+	"time"
+
+	"container-toolkit/internal/dryrun"
+	"container-toolkit/internal/journal"
+	"container-toolkit/internal/state"
+	"container-toolkit/internal/transaction"
+	engine "container-toolkit/pkg/config/engine/docker"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	nvidiaRuntimeName               = "nvidia"
+	nvidiaRuntimeBinary             = "nvidia-container-runtime"
+	nvidiaExperimentalRuntimeName   = "nvidia-experimental"
+	nvidiaExperimentalRuntimeBinary = "nvidia-container-runtime-experimental"
+
+	defaultConfig       = "/etc/docker/daemon.json"
+	defaultSocket       = "/var/run/docker.sock"
+	defaultSetAsDefault = true
+	// defaultRuntimeName specifies the NVIDIA runtime to be use as the default runtime if setting the default runtime is enabled
+	defaultRuntimeName = nvidiaRuntimeName
+
+	reloadBackoff     = 5 * time.Second
+	maxReloadAttempts = 6
+
+	defaultDockerRuntime  = "runc"
+	socketMessageToGetPID = "GET /info HTTP/1.0\r\n\r\n"
+)
+
+// nvidiaRuntimeBinaries defines a map of runtime names to binary names
+var nvidiaRuntimeBinaries = map[string]string{
+	nvidiaRuntimeName:             nvidiaRuntimeBinary,
+	nvidiaExperimentalRuntimeName: nvidiaExperimentalRuntimeBinary,
+}
+
+// Options defines the options for updating the docker config
+type Options struct {
+	// Config is the path to the docker config file
+	Config string `yaml:"config"`
+	// Socket is the path to the docker socket that is used to signal docker
+	Socket string `yaml:"socket"`
+	// RuntimeName is the name of the nvidia runtime
+	RuntimeName string `yaml:"runtimeName"`
+	// SetAsDefault specifies whether the nvidia runtime is set as the default runtime
+	SetAsDefault bool `yaml:"setAsDefault"`
+	// RuntimeDir is the directory containing the nvidia runtime executables
+	RuntimeDir string `yaml:"-"`
+	// DryRun specifies that the changes are printed instead of applied
+	DryRun bool `yaml:"dryRun"`
+	// previousDefaultRuntime is the default runtime to restore on cleanup.
+	// This is nil if the previous default runtime is unknown.
+	previousDefaultRuntime *string
+	// owned is the record of the config entries created by the toolkit that
+	// are removed on cleanup. This is nil if no record exists.
+	owned *state.Ownership
+}
+
+// Setup updates docker configuration to include the nvidia runtime and reloads it.
+// If a step fails, the config and its state are restored to their contents
+// from before the setup.
+func Setup(o *Options) error {
+	return transaction.Run(func(tx *transaction.Transaction) error {
+		return SetupWithRollback(context.Background(), o, tx)
+	})
+}
+
+// SetupWithRollback updates docker configuration as for Setup. The changes made
+// are registered with the specified transaction instead of being rolled back
+// on failure. This allows these to be rolled back along with later steps. If
+// the context is cancelled, the setup is aborted and an error is returned.
+func SetupWithRollback(ctx context.Context, o *Options, tx *transaction.Transaction) error {
+	log.Infof("Starting 'setup' for docker")
+
+	if o.DryRun {
+		return setupDryRun(o)
+	}
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	// Docker only needs to be reloaded on rollback if it was signalled to
+	// load the updated config. This is registered first so that it happens
+	// after the config is restored.
+	signalled := false
+	tx.OnRollback("reload docker", func() error {
+		if !signalled {
+			return nil
+		}
+		return SignalDocker(o.Socket)
+	})
+
+	err := journalChanges(o, tx)
+	if err != nil {
+		return fmt.Errorf("unable to record changes in journal: %v", err)
+	}
+
+	for _, path := range []string{o.Config, state.Path(o.Config)} {
+		err := tx.BackupFile(path)
+		if err != nil {
+			return fmt.Errorf("unable to back up config: %v", err)
+		}
+	}
+
+	st, err := state.Snapshot(o.Config)
+	if err != nil {
+		return fmt.Errorf("unable to snapshot config: %v", err)
+	}
+
+	err = st.Save()
+	if err != nil {
+		return fmt.Errorf("unable to save config state: %v", err)
+	}
+
+	cfg, err := LoadConfig(o.Config)
+	if err != nil {
+		return fmt.Errorf("unable to load config: %v", err)
+	}
+
+	recordOwnership(st, cfg, o)
+
+	err = UpdateConfig(cfg, o)
+	if err != nil {
+		return fmt.Errorf("unable to update config: %v", err)
+	}
+
+	err = FlushConfig(cfg, o.Config)
+	if err != nil {
+		return fmt.Errorf("unable to flush config: %v", err)
+	}
+
+	err = st.Update()
+	if err != nil {
+		return fmt.Errorf("unable to update config state: %v", err)
+	}
+
+	err = signalDocker(ctx, o.Socket)
+	if err != nil {
+		return fmt.Errorf("unable to signal docker: %v", err)
+	}
+	signalled = true
+
+	log.Infof("Completed 'setup' for docker")
+
+	return nil
+}
+
+// Cleanup reverts docker configuration to remove the nvidia runtime and reloads it
+func Cleanup(o *Options) error {
+	log.Infof("Starting 'cleanup' for docker")
+
+	if o.DryRun {
+		return cleanupDryRun(o)
+	}
+
+	st, err := state.Load(o.Config)
+	if err != nil {
+		return fmt.Errorf("unable to load config state: %v", err)
+	}
+
+	restored := false
+	if st != nil {
+		restored, err = st.Restore()
+		if err != nil {
+			return fmt.Errorf("unable to restore config: %v", err)
+		}
+		o.previousDefaultRuntime = st.DefaultRuntime
+		o.owned = st.Owned
+	}
+
+	if !restored {
+		err = revertConfig(o)
+		if err != nil {
+			return err
+		}
+	}
+
+	if st != nil {
+		err = st.Remove()
+		if err != nil {
+			return fmt.Errorf("unable to remove config state: %v", err)
+		}
+	}
+
+	err = SignalDocker(o.Socket)
+	if err != nil {
+		return fmt.Errorf("unable to signal docker: %v", err)
+	}
+
+	log.Infof("Completed 'cleanup' for docker")
+
+	return nil
+}
+
+// setupDryRun prints the changes that a setup would make to the docker config
+func setupDryRun(o *Options) error {
+	cfg, err := LoadConfig(o.Config)
+	if err != nil {
+		return fmt.Errorf("unable to load config: %v", err)
+	}
+
+	err = UpdateConfig(cfg, o)
+	if err != nil {
+		return fmt.Errorf("unable to update config: %v", err)
+	}
+
+	return printConfigDiff(o.Config, cfg)
+}
+
+// cleanupDryRun prints the changes that a cleanup would make to the docker config
+func cleanupDryRun(o *Options) error {
+	st, err := state.Load(o.Config)
+	if err != nil {
+		return fmt.Errorf("unable to load config state: %v", err)
+	}
+
+	current, err := dryrun.ReadFile(o.Config)
+	if err != nil {
+		return err
+	}
+
+	if st != nil && st.CanRestore() {
+		var original []byte
+		if st.Original.Exists {
+			original = st.Original.Contents
+		}
+		return dryrun.PrintDiff(o.Config, current, original)
+	}
+
+	if st != nil {
+		o.previousDefaultRuntime = st.DefaultRuntime
+		o.owned = st.Owned
+	}
+
+	cfg, err := LoadConfig(o.Config)
+	if err != nil {
+		return fmt.Errorf("unable to load config: %v", err)
+	}
+
+	err = RevertConfig(cfg, o)
+	if err != nil {
+		return fmt.Errorf("unable to update config: %v", err)
+	}
+
+	return printConfigDiff(o.Config, cfg)
+}
+
+// printConfigDiff prints a diff between the docker config on disk and the
+// specified config
+func printConfigDiff(config string, cfg map[string]interface{}) error {
+	current, err := dryrun.ReadFile(config)
+	if err != nil {
+		return err
+	}
+
+	output, err := RenderConfig(cfg)
+	if err != nil {
+		return err
+	}
+
+	return dryrun.PrintDiff(config, current, output)
+}
+
+// recordOwnership records the runtimes and default runtime that are created by
+// an update of the specified config in the config state.
+func recordOwnership(st *state.State, config map[string]interface{}, o *Options) {
+	c := engine.Config(config)
+
+	owned := st.Own()
+	for _, name := range o.runtimeNames() {
+		owned.AddRuntime(name, c.HasRuntime(name))
+	}
+
+	defaultRuntime := o.getDefaultRuntime()
+	if defaultRuntime == "" {
+		return
+	}
+
+	current := c.DefaultRuntime()
+	if current == defaultRuntime {
+		return
+	}
+	if !o.isNvidiaRuntime(current) {
+		st.RecordDefaultRuntime(current)
+	}
+	owned.DefaultRuntime = defaultRuntime
+}
+
+// revertConfig removes the nvidia runtimes from the docker config on disk
+func revertConfig(o *Options) error {
+	cfg, err := LoadConfig(o.Config)
+	if err != nil {
+		return fmt.Errorf("unable to load config: %v", err)
+	}
+
+	err = RevertConfig(cfg, o)
+	if err != nil {
+		return fmt.Errorf("unable to update config: %v", err)
+	}
+
+	err = FlushConfig(cfg, o.Config)
+	if err != nil {
+		return fmt.Errorf("unable to flush config: %v", err)
+	}
+
+	return nil
+}
+
+// journalChanges records the nvidia runtimes added to the docker config and
+// the change of its default runtime in the journal of the transaction. These
+// are recorded before the config is written, so that the config is restored
+// before these are undone.
+func journalChanges(o *Options, tx *transaction.Transaction) error {
+	cfg, names, err := LoadRuntimes(o)
+	if err != nil {
+		return fmt.Errorf("unable to load config: %v", err)
+	}
+	return tx.Record(journal.RuntimeChanges("docker", o.Config, cfg, names, o.getDefaultRuntime())...)
+}
+
+// LoadRuntimes loads the docker config and returns it along with the names of
+// the nvidia runtimes that are configured in it for the specified options. The
+// names are also returned if the config cannot be loaded.
+func LoadRuntimes(o *Options) (engine.Config, []string, error) {
+	names := o.runtimeNames()
+	cfg, err := engine.Load(o.Config)
+	if err != nil {
+		return nil, names, err
+	}
+	return cfg, names, nil
+}
+
+// LoadConfig loads the docker config from disk
+func LoadConfig(config string) (map[string]interface{}, error) {
+	log.Infof("Loading config: %v", config)
+
+	cfg, err := engine.Load(config)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Infof("Successfully loaded config")
+	return cfg, nil
+}
+
+// ParseConfig parses the specified contents of a docker config. Empty contents
+// result in an empty config.
+func ParseConfig(contents []byte) (map[string]interface{}, error) {
+	return engine.Parse(contents)
+}
+
+// UpdateConfig updates the docker config to include the nvidia runtimes
+func UpdateConfig(config map[string]interface{}, o *Options) error {
+	c := engine.Config(config)
+
+	defaultRuntime := o.getDefaultRuntime()
+	if defaultRuntime != "" {
+		err := c.SetDefaultRuntime(defaultRuntime)
+		if err != nil {
+			return err
+		}
+	}
+
+	runtimeBinaries := o.getRuntimeBinaries()
+	for _, name := range o.runtimeNames() {
+		err := c.AddRuntime(name, runtimeBinaries[name], false)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RevertConfig reverts the docker config to remove the nvidia runtimes. If a
+// record of the runtimes created by the toolkit exists, only these are
+// removed. If the default runtime was set by the toolkit, the default runtime
+// from before the setup is restored if known.
+func RevertConfig(config map[string]interface{}, o *Options) error {
+	c := engine.Config(config)
+
+	var err error
+	if o.ownsDefaultRuntime(c.DefaultRuntime()) {
+		switch {
+		case o.previousDefaultRuntime == nil:
+			err = c.SetDefaultRuntime(defaultDockerRuntime)
+		case *o.previousDefaultRuntime == "":
+			err = c.UnsetDefaultRuntime()
+		default:
+			err = c.SetDefaultRuntime(*o.previousDefaultRuntime)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, name := range o.ownedRuntimes() {
+		err := c.RemoveRuntime(name)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RenderConfig returns the contents of the docker config file for the
+// specified config
+func RenderConfig(cfg map[string]interface{}) ([]byte, error) {
+	return engine.Config(cfg).Bytes()
+}
+
+// FlushConfig flushes the updated/reverted config out to disk
+func FlushConfig(cfg map[string]interface{}, config string) error {
+	log.Infof("Flushing config")
+
+	err := engine.Config(cfg).Save(config)
+	if err != nil {
+		return err
+	}
+
+	log.Infof("Successfully flushed config")
+
+	return nil
+}
+
+// SignalDocker sends a SIGHUP signal to docker daemon
+func SignalDocker(socket string) error {
+	return signalDocker(context.Background(), socket)
+}
+
+// signalDocker sends a SIGHUP signal to docker daemon. Retries are aborted if
+// the context is cancelled.
+func signalDocker(ctx context.Context, socket string) error {
+	log.Infof("Sending SIGHUP signal to docker")
+
+	// Wrap the logic to perform the SIGHUP in a function so we can retry it on failure
+	retriable := func() error {
+		conn, err := net.Dial("unix", socket)
+		if err != nil {
+			return fmt.Errorf("unable to dial: %v", err)
+		}
+		defer conn.Close()
+
+		sconn, err := conn.(*net.UnixConn).SyscallConn()
+		if err != nil {
+			return fmt.Errorf("unable to get syscall connection: %v", err)
+		}
+
+		err1 := sconn.Control(func(fd uintptr) {
+			err = syscall.SetsockoptInt(int(fd), syscall.SOL_SOCKET, syscall.SO_PASSCRED, 1)
+		})
+		if err1 != nil {
+			return fmt.Errorf("unable to issue call on socket fd: %v", err1)
+		}
+		if err != nil {
+			return fmt.Errorf("unable to SetsockoptInt on socket fd: %v", err)
+		}
+
+		_, _, err = conn.(*net.UnixConn).WriteMsgUnix([]byte(socketMessageToGetPID), nil, nil)
+		if err != nil {
+			return fmt.Errorf("unable to WriteMsgUnix on socket fd: %v", err)
+		}
+
+		oob := make([]byte, 1024)
+		_, oobn, _, _, err := conn.(*net.UnixConn).ReadMsgUnix(nil, oob)
+		if err != nil {
+			return fmt.Errorf("unable to ReadMsgUnix on socket fd: %v", err)
+		}
+
+		oob = oob[:oobn]
+		scm, err := syscall.ParseSocketControlMessage(oob)
+		if err != nil {
+			return fmt.Errorf("unable to ParseSocketControlMessage from message received on socket fd: %v", err)
+		}
+
+		ucred, err := syscall.ParseUnixCredentials(&scm[0])
+		if err != nil {
+			return fmt.Errorf("unable to ParseUnixCredentials from message received on socket fd: %v", err)
+		}
+
+		err = syscall.Kill(int(ucred.Pid), syscall.SIGHUP)
+		if err != nil {
+			return fmt.Errorf("unable to send SIGHUP to 'docker' process: %v", err)
+		}
+
+		return nil
+	}
+
+	// Try to send a SIGHUP up to maxReloadAttempts times
+	var err error
+	for i := 0; i < maxReloadAttempts; i++ {
+		err = retriable()
+		if err == nil {
+			break
+		}
+		if i == maxReloadAttempts-1 {
+			break
+		}
+		log.Warnf("Error signaling docker, attempt %v/%v: %v", i+1, maxReloadAttempts, err)
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%v: %v", ctx.Err(), err)
+		case <-time.After(reloadBackoff):
+		}
+	}
+	if err != nil {
+		log.Warnf("Max retries reached %v/%v, aborting", maxReloadAttempts, maxReloadAttempts)
+		return err
+	}
+
+	log.Infof("Successfully signaled docker")
+
+	return nil
+}
+
+// getDefaultRuntime returns the default runtime for the configured options.
+// If the configuration is invalid or the default runtimes should not be set
+// the empty string is returned.
+func (o Options) getDefaultRuntime() string {
+	if o.SetAsDefault == false {
+		return ""
+	}
+
+	return o.RuntimeName
+}
+
+// isNvidiaRuntime checks whether the specified runtime name refers to one of the
+// nvidia runtimes
+func (o Options) isNvidiaRuntime(name string) bool {
+	if _, exists := nvidiaRuntimeBinaries[name]; exists {
+		return true
+	}
+	_, exists := o.getRuntimeBinaries()[name]
+	return exists
+}
+
+// ownedRuntimes returns the names of the runtimes to remove on cleanup. If no
+// record of the runtimes created by the toolkit exists, all nvidia runtimes
+// are returned.
+func (o Options) ownedRuntimes() []string {
+	if o.owned != nil {
+		return o.owned.Runtimes
+	}
+
+	var names []string
+	for name := range nvidiaRuntimeBinaries {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ownsDefaultRuntime checks whether the specified default runtime was set by
+// the toolkit. If no record of this exists, any nvidia runtime is considered
+// to have been set by the toolkit.
+func (o Options) ownsDefaultRuntime(name string) bool {
+	if o.owned != nil {
+		return name != "" && name == o.owned.DefaultRuntime
+	}
+	return o.isNvidiaRuntime(name)
+}
+
+// runtimeNames returns the sorted names of the nvidia runtimes for the given
+// options
+func (o Options) runtimeNames() []string {
+	var names []string
+	for name := range o.getRuntimeBinaries() {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// getRuntimeBinaries returns a map of runtime names to binary paths. This includes the
+// renaming of the `nvidia` runtime as per the --runtime-class command line flag.
+func (o Options) getRuntimeBinaries() map[string]string {
+	runtimeBinaries := make(map[string]string)
+
+	for rt, bin := range nvidiaRuntimeBinaries {
+		runtime := rt
+		if o.RuntimeName != "" && o.RuntimeName != nvidiaExperimentalRuntimeName && runtime == defaultRuntimeName {
+			runtime = o.RuntimeName
+		}
+
+		runtimeBinaries[runtime] = filepath.Join(o.RuntimeDir, bin)
+	}
+
+	return runtimeBinaries
+}
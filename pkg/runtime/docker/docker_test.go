@@ -14,11 +14,19 @@
 # limitations under the License.
 */
 
-package main
+package docker
 
 import (
+	"context"
 	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
+
+	"container-toolkit/internal/state"
+	"container-toolkit/internal/transaction"
 
 	"github.com/stretchr/testify/require"
 )
@@ -54,10 +62,10 @@ func TestUpdateConfigDefaultRuntime(t *testing.T) {
 	}
 
 	for i, tc := range testCases {
-		o := &options{
-			setAsDefault: tc.setAsDefault,
-			runtimeName:  tc.runtimeName,
-			runtimeDir:   runtimeDir,
+		o := &Options{
+			SetAsDefault: tc.setAsDefault,
+			RuntimeName:  tc.runtimeName,
+			RuntimeDir:   runtimeDir,
 		}
 
 		config := map[string]interface{}{}
@@ -249,10 +257,10 @@ func TestUpdateConfig(t *testing.T) {
 	}
 
 	for i, tc := range testCases {
-		options := &options{
-			setAsDefault: tc.setAsDefault,
-			runtimeName:  tc.runtimeName,
-			runtimeDir:   runtimeDir,
+		options := &Options{
+			SetAsDefault: tc.setAsDefault,
+			RuntimeName:  tc.runtimeName,
+			RuntimeDir:   runtimeDir,
 		}
 		err := UpdateConfig(tc.config, options)
 		require.NoError(t, err, "%d: %v", i, tc)
@@ -268,9 +276,14 @@ func TestUpdateConfig(t *testing.T) {
 }
 
 func TestRevertConfig(t *testing.T) {
+	crun := "crun"
+	none := ""
+
 	testCases := []struct {
-		config         map[string]interface{}
-		expectedConfig map[string]interface{}
+		config                 map[string]interface{}
+		previousDefaultRuntime *string
+		owned                  *state.Ownership
+		expectedConfig         map[string]interface{}
 	}{
 		{
 			config:         map[string]interface{}{},
@@ -327,6 +340,49 @@ func TestRevertConfig(t *testing.T) {
 				"default-runtime": "runc",
 			},
 		},
+		{
+			config: map[string]interface{}{
+				"default-runtime": "nvidia",
+				"runtimes": map[string]interface{}{
+					"nvidia": map[string]interface{}{
+						"path": "/test/runtime/dir/nvidia-container-runtime",
+						"args": []string{},
+					},
+				},
+			},
+			previousDefaultRuntime: &crun,
+			expectedConfig: map[string]interface{}{
+				"default-runtime": "crun",
+			},
+		},
+		{
+			config: map[string]interface{}{
+				"default-runtime": "nvidia",
+				"runtimes": map[string]interface{}{
+					"nvidia": map[string]interface{}{
+						"path": "/test/runtime/dir/nvidia-container-runtime",
+						"args": []string{},
+					},
+				},
+			},
+			previousDefaultRuntime: &none,
+			expectedConfig:         map[string]interface{}{},
+		},
+		{
+			config: map[string]interface{}{
+				"default-runtime": "not-nvidia",
+				"runtimes": map[string]interface{}{
+					"nvidia": map[string]interface{}{
+						"path": "/test/runtime/dir/nvidia-container-runtime",
+						"args": []string{},
+					},
+				},
+			},
+			previousDefaultRuntime: &crun,
+			expectedConfig: map[string]interface{}{
+				"default-runtime": "not-nvidia",
+			},
+		},
 		{
 			config: map[string]interface{}{
 				"default-runtime": "not-nvidia",
@@ -341,6 +397,52 @@ func TestRevertConfig(t *testing.T) {
 				"default-runtime": "not-nvidia",
 			},
 		},
+		{
+			config: map[string]interface{}{
+				"default-runtime": "nvidia",
+				"runtimes": map[string]interface{}{
+					"nvidia": map[string]interface{}{
+						"path": "/usr/bin/nvidia-container-runtime",
+						"args": []string{},
+					},
+					"nvidia-experimental": map[string]interface{}{
+						"path": "/test/runtime/dir/nvidia-container-runtime-experimental",
+						"args": []string{},
+					},
+				},
+			},
+			owned: &state.Ownership{
+				Runtimes: []string{"nvidia-experimental"},
+			},
+			expectedConfig: map[string]interface{}{
+				"default-runtime": "nvidia",
+				"runtimes": map[string]interface{}{
+					"nvidia": map[string]interface{}{
+						"path": "/usr/bin/nvidia-container-runtime",
+						"args": []string{},
+					},
+				},
+			},
+		},
+		{
+			config: map[string]interface{}{
+				"default-runtime": "NAME",
+				"runtimes": map[string]interface{}{
+					"NAME": map[string]interface{}{
+						"path": "/test/runtime/dir/nvidia-container-runtime",
+						"args": []string{},
+					},
+				},
+			},
+			previousDefaultRuntime: &crun,
+			owned: &state.Ownership{
+				Runtimes:       []string{"NAME"},
+				DefaultRuntime: "NAME",
+			},
+			expectedConfig: map[string]interface{}{
+				"default-runtime": "crun",
+			},
+		},
 		{
 			config: map[string]interface{}{
 				"exec-opts":  []string{"native.cgroupdriver=systemd"},
@@ -368,7 +470,11 @@ func TestRevertConfig(t *testing.T) {
 	}
 
 	for i, tc := range testCases {
-		err := RevertConfig(tc.config)
+		o := &Options{
+			previousDefaultRuntime: tc.previousDefaultRuntime,
+			owned:                  tc.owned,
+		}
+		err := RevertConfig(tc.config, o)
 
 		require.NoError(t, err, "%d: %v", i, tc)
 
@@ -382,6 +488,64 @@ func TestRevertConfig(t *testing.T) {
 	}
 }
 
+func TestRecordOwnership(t *testing.T) {
+	none := ""
+
+	testCases := []struct {
+		config                 map[string]interface{}
+		setAsDefault           bool
+		runtimeName            string
+		expectedOwned          *state.Ownership
+		expectedDefaultRuntime *string
+	}{
+		{
+			config: map[string]interface{}{},
+			expectedOwned: &state.Ownership{
+				Runtimes: []string{"nvidia", "nvidia-experimental"},
+			},
+		},
+		{
+			config:       map[string]interface{}{},
+			setAsDefault: true,
+			runtimeName:  "NAME",
+			expectedOwned: &state.Ownership{
+				Runtimes:       []string{"NAME", "nvidia-experimental"},
+				DefaultRuntime: "NAME",
+			},
+			expectedDefaultRuntime: &none,
+		},
+		{
+			config: map[string]interface{}{
+				"default-runtime": "nvidia",
+				"runtimes": map[string]interface{}{
+					"nvidia": map[string]interface{}{
+						"path": "/usr/bin/nvidia-container-runtime",
+						"args": []string{},
+					},
+				},
+			},
+			setAsDefault: true,
+			runtimeName:  "nvidia",
+			expectedOwned: &state.Ownership{
+				Runtimes: []string{"nvidia-experimental"},
+			},
+		},
+	}
+
+	for i, tc := range testCases {
+		o := &Options{
+			SetAsDefault: tc.setAsDefault,
+			RuntimeName:  tc.runtimeName,
+		}
+		st := state.New("/etc/docker/daemon.json")
+
+		recordOwnership(st, tc.config, o)
+
+		require.Equal(t, tc.expectedOwned, st.Owned, "%d: %v", i, tc)
+		require.Equal(t, tc.expectedDefaultRuntime, st.DefaultRuntime, "%d: %v", i, tc)
+	}
+}
+
 func TestFlagsDefaultRuntime(t *testing.T) {
 	testCases := []struct {
 		setAsDefault bool
@@ -413,11 +577,44 @@ func TestFlagsDefaultRuntime(t *testing.T) {
 	}
 
 	for i, tc := range testCases {
-		f := options{
-			setAsDefault: tc.setAsDefault,
-			runtimeName:  tc.runtimeName,
+		f := Options{
+			SetAsDefault: tc.setAsDefault,
+			RuntimeName:  tc.runtimeName,
 		}
 
 		require.Equal(t, tc.expected, f.getDefaultRuntime(), "%d: %v", i, tc)
 	}
 }
+
+func TestSetupCancelled(t *testing.T) {
+	dir, err := ioutil.TempDir("", "docker-test-")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	o := Options{
+		Config:       filepath.Join(dir, "daemon.json"),
+		Socket:       filepath.Join(dir, "docker.sock"),
+		RuntimeName:  "nvidia",
+		RuntimeDir:   "/test/runtime/dir",
+		SetAsDefault: true,
+	}
+	original := `{"log-level": "debug"}`
+	require.NoError(t, ioutil.WriteFile(o.Config, []byte(original), 0644))
+
+	// Since the socket does not exist, signalling docker is retried until
+	// the context is cancelled.
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	err = transaction.Run(func(tx *transaction.Transaction) error {
+		return SetupWithRollback(ctx, &o, tx)
+	})
+	require.Error(t, err)
+	require.Less(t, int64(time.Since(start)), int64(reloadBackoff))
+
+	contents, err := ioutil.ReadFile(o.Config)
+	require.NoError(t, err)
+	require.Equal(t, original, string(contents))
+	require.NoFileExists(t, state.Path(o.Config))
+}
@@ -0,0 +1,50 @@
+/**
+# Copyright (c) 2021, NVIDIA CORPORATION.  All rights reserved.
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#     http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+*/
+
+package docker
+
+import (
+	"fmt"
+
+	"container-toolkit/internal/dryrun"
+)
+
+// Drift returns a diff of the changes that a setup would make to the docker
+// config. The empty string is returned if the nvidia runtimes are configured
+// as expected. Differences in the formatting of the config are ignored.
+func Drift(o *Options) (string, error) {
+	cfg, err := LoadConfig(o.Config)
+	if err != nil {
+		return "", fmt.Errorf("unable to load config: %v", err)
+	}
+
+	current, err := RenderConfig(cfg)
+	if err != nil {
+		return "", err
+	}
+
+	err = UpdateConfig(cfg, o)
+	if err != nil {
+		return "", fmt.Errorf("unable to update config: %v", err)
+	}
+
+	expected, err := RenderConfig(cfg)
+	if err != nil {
+		return "", err
+	}
+
+	return dryrun.Diff(o.Config, current, expected)
+}
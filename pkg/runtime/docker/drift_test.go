@@ -0,0 +1,89 @@
+/**
+# Copyright (c) 2021, NVIDIA CORPORATION.  All rights reserved.
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#     http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+*/
+
+package docker
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDrift(t *testing.T) {
+	dir, err := ioutil.TempDir("", "docker-drift-test-")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	o := &Options{
+		Config:       filepath.Join(dir, "daemon.json"),
+		RuntimeName:  "nvidia",
+		SetAsDefault: true,
+		RuntimeDir:   "/test/runtime/dir",
+	}
+
+	configured, err := RenderConfigContents([]byte(`{"log-level": "debug"}`), o, false)
+	require.NoError(t, err)
+
+	testCases := []struct {
+		description string
+		contents    string
+		drifted     bool
+	}{
+		{
+			description: "config does not exist",
+			drifted:     true,
+		},
+		{
+			description: "runtimes are configured",
+			contents:    string(configured),
+		},
+		{
+			description: "formatting is ignored",
+			contents:    `{"default-runtime":"nvidia","log-level":"debug","runtimes":{"nvidia":{"args":[],"path":"/test/runtime/dir/nvidia-container-runtime"},"nvidia-experimental":{"args":[],"path":"/test/runtime/dir/nvidia-container-runtime-experimental"}}}`,
+		},
+		{
+			description: "default runtime is changed",
+			contents:    `{"default-runtime":"runc","log-level":"debug","runtimes":{"nvidia":{"args":[],"path":"/test/runtime/dir/nvidia-container-runtime"},"nvidia-experimental":{"args":[],"path":"/test/runtime/dir/nvidia-container-runtime-experimental"}}}`,
+			drifted:     true,
+		},
+		{
+			description: "runtimes are removed",
+			contents:    `{"log-level": "debug"}`,
+			drifted:     true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			os.Remove(o.Config)
+			if tc.contents != "" {
+				require.NoError(t, ioutil.WriteFile(o.Config, []byte(tc.contents), 0644))
+			}
+
+			diff, err := Drift(o)
+			require.NoError(t, err)
+			if !tc.drifted {
+				require.Empty(t, diff)
+				return
+			}
+			require.Contains(t, diff, "+++ "+o.Config)
+			require.Contains(t, diff, `+    "default-runtime": "nvidia"`)
+		})
+	}
+}
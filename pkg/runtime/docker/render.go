@@ -0,0 +1,41 @@
+/**
+# Copyright (c) 2021, NVIDIA CORPORATION.  All rights reserved.
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#     http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+*/
+
+package docker
+
+import (
+	"fmt"
+)
+
+// RenderConfigContents returns the contents of the specified docker config
+// with the nvidia runtimes added or, if revert is set, removed.
+func RenderConfigContents(input []byte, o *Options, revert bool) ([]byte, error) {
+	cfg, err := ParseConfig(input)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse config: %v", err)
+	}
+
+	if revert {
+		err = RevertConfig(cfg, o)
+	} else {
+		err = UpdateConfig(cfg, o)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to update config: %v", err)
+	}
+
+	return RenderConfig(cfg)
+}
@@ -14,9 +14,10 @@
 # limitations under the License.
 */
 
-package main
+package toolkit
 
 import (
+	"bytes"
 	"fmt"
 	"io"
 	"os"
@@ -24,6 +25,9 @@ import (
 	"sort"
 	"strings"
 
+	"container-toolkit/internal/atomicfile"
+	"container-toolkit/internal/dryrun"
+
 	log "github.com/sirupsen/logrus"
 )
 
@@ -42,18 +46,18 @@ type executable struct {
 
 // install installs an executable component of the NVIDIA container toolkit. The source executable
 // is copied to a `.real` file and a wapper is created to set up the environment as required.
-func (e executable) install(destFolder string) (string, error) {
+func (e executable) install(i Installer, destFolder string) (string, error) {
 	log.Infof("Installing executable '%v' to %v", e.source, destFolder)
 
 	dotfileName := e.dotfileName()
 
-	installedDotfileName, err := installFileToFolderWithName(destFolder, dotfileName, e.source)
+	installedDotfileName, err := i.installFileToFolderWithName(destFolder, dotfileName, e.source)
 	if err != nil {
 		return "", fmt.Errorf("error installing file '%v' as '%v': %v", e.source, dotfileName, err)
 	}
 	log.Infof("Installed '%v'", installedDotfileName)
 
-	wrapperFilename, err := e.installWrapper(destFolder, installedDotfileName)
+	wrapperFilename, err := e.installWrapper(i, destFolder, installedDotfileName)
 	if err != nil {
 		return "", fmt.Errorf("error wrapping '%v': %v", installedDotfileName, err)
 	}
@@ -70,19 +74,25 @@ func (e executable) wrapperName() string {
 	return e.target.wrapperName
 }
 
-func (e executable) installWrapper(destFolder string, dotfileName string) (string, error) {
+func (e executable) installWrapper(i Installer, destFolder string, dotfileName string) (string, error) {
 	wrapperPath := filepath.Join(destFolder, e.wrapperName())
-	wrapper, err := os.Create(wrapperPath)
-	if err != nil {
-		return "", fmt.Errorf("error creating executable wrapper: %v", err)
+	if i.DryRun {
+		return wrapperPath, dryrun.PrintOperation("write", wrapperPath)
 	}
-	defer wrapper.Close()
 
-	err = e.writeWrapperTo(wrapper, destFolder, dotfileName)
+	// The wrapper is replaced atomically since it may be invoked while it
+	// is regenerated.
+	var wrapper bytes.Buffer
+	err := e.writeWrapperTo(&wrapper, destFolder, dotfileName)
 	if err != nil {
 		return "", fmt.Errorf("error writing wrapper contents: %v", err)
 	}
 
+	err = atomicfile.WriteFile(wrapperPath, wrapper.Bytes(), 0755)
+	if err != nil {
+		return "", fmt.Errorf("error creating executable wrapper: %v", err)
+	}
+
 	err = ensureExecutable(wrapperPath)
 	if err != nil {
 		return "", fmt.Errorf("error making wrapper executable: %v", err)
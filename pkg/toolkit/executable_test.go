@@ -14,7 +14,7 @@
 # limitations under the License.
 */
 
-package main
+package toolkit
 
 import (
 	"bytes"
@@ -132,7 +132,7 @@ func TestInstallExecutable(t *testing.T) {
 	require.NoError(t, err)
 	defer os.RemoveAll(destFolder)
 
-	installed, err := e.install(destFolder)
+	installed, err := e.install(Installer{}, destFolder)
 
 	require.NoError(t, err)
 	require.Equal(t, filepath.Join(destFolder, base), installed)
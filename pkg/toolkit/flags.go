@@ -0,0 +1,70 @@
+/**
+# Copyright (c) 2021, NVIDIA CORPORATION.  All rights reserved.
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#     http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+*/
+
+package toolkit
+
+import (
+	cli "github.com/urfave/cli/v2"
+)
+
+// Flags returns the command line flags for installing the toolkit with the
+// specified options
+func Flags(o *Options) []cli.Flag {
+	return []cli.Flag{
+		DriverRootFlag(o),
+		&cli.StringFlag{
+			Name:        "nvidia-container-runtime-debug",
+			Usage:       "Specify the location of the debug log file for the NVIDIA Container Runtime",
+			Destination: &o.RuntimeDebug,
+			EnvVars:     []string{"NVIDIA_CONTAINER_RUNTIME_DEBUG"},
+		},
+		&cli.StringFlag{
+			Name:        "nvidia-container-runtime-debug-log-level",
+			Destination: &o.RuntimeLogLevel,
+			EnvVars:     []string{"NVIDIA_CONTAINER_RUNTIME_LOG_LEVEL"},
+		},
+		&cli.StringFlag{
+			Name:        "nvidia-container-cli-debug",
+			Usage:       "Specify the location of the debug log file for the NVIDIA Container CLI",
+			Destination: &o.CLIDebug,
+			EnvVars:     []string{"NVIDIA_CONTAINER_CLI_DEBUG"},
+		},
+		DryRunFlag(o),
+	}
+}
+
+// DriverRootFlag returns the flag that specifies the root of the NVIDIA driver
+// installation for the specified options. This is also used when verifying
+// the toolkit.
+func DriverRootFlag(o *Options) cli.Flag {
+	return &cli.StringFlag{
+		Name:        "nvidia-driver-root",
+		Value:       DefaultNvidiaDriverRoot,
+		Destination: &o.DriverRoot,
+		EnvVars:     []string{"NVIDIA_DRIVER_ROOT"},
+	}
+}
+
+// DryRunFlag returns the flag that enables the dry-run mode for the specified
+// options. This is the only flag used when deleting the toolkit.
+func DryRunFlag(o *Options) cli.Flag {
+	return &cli.BoolFlag{
+		Name:        "dry-run",
+		Usage:       "Print the file operations that would be performed instead of performing them",
+		Destination: &o.DryRun,
+		EnvVars:     []string{"TOOLKIT_DRY_RUN"},
+	}
+}
@@ -14,7 +14,7 @@
 # limitations under the License.
 */
 
-package main
+package toolkit
 
 import (
 	"fmt"
@@ -32,20 +32,23 @@ const (
 	nvidiaExperimentalContainerRuntimeSource  = "nvidia-container-runtime.experimental"
 	nvidiaExperimentalContainerRuntimeTarget  = nvidiaExperimentalContainerRuntimeSource
 	nvidiaExperimentalContainerRuntimeWrapper = "nvidia-container-runtime-experimental"
+
+	managementLibrary = "libnvidia-ml.so"
 )
 
 // installContainerRuntimes sets up the NVIDIA container runtimes, copying the executables
 // and implementing the required wrapper
-func installContainerRuntimes(toolkitDir string, driverRoot string) error {
+func (i Installer) installContainerRuntimes(toolkitDir string, driverRoot string) error {
 	r := newNvidiaContainerRuntimeInstaller()
+	r.source = i.Sources.Runtime
 
-	_, err := r.install(toolkitDir)
+	_, err := r.install(i, toolkitDir)
 	if err != nil {
 		return fmt.Errorf("error installing NVIDIA container runtime: %v", err)
 	}
 
 	// Install the experimental runtime and treat failures as non-fatal.
-	err = installExperimentalRuntime(toolkitDir, driverRoot)
+	err = i.installExperimentalRuntime(toolkitDir, driverRoot)
 	if err != nil {
 		log.Warnf("Could not install experimental runtime: %v", err)
 	}
@@ -54,15 +57,10 @@ func installContainerRuntimes(toolkitDir string, driverRoot string) error {
 }
 
 // installExperimentalRuntime ensures that the experimental NVIDIA Container runtime is installed
-func installExperimentalRuntime(toolkitDir string, driverRoot string) error {
-	libraryRoot, err := findLibraryRoot(driverRoot)
-	if err != nil {
-		log.Warnf("Error finding library path for root %v: %v", driverRoot, err)
-	}
-	log.Infof("Using library root %v", libraryRoot)
-
-	e := newNvidiaContainerRuntimeExperimentalInstaller(libraryRoot)
-	_, err = e.install(toolkitDir)
+func (i Installer) installExperimentalRuntime(toolkitDir string, driverRoot string) error {
+	e := newNvidiaContainerRuntimeExperimentalInstaller(getLibraryRoot(driverRoot))
+	e.source = i.Sources.ExperimentalRuntime
+	_, err := e.install(i, toolkitDir)
 	if err != nil {
 		return fmt.Errorf("error installing experimental NVIDIA Container Runtime: %v", err)
 	}
@@ -70,6 +68,18 @@ func installExperimentalRuntime(toolkitDir string, driverRoot string) error {
 	return nil
 }
 
+// getLibraryRoot returns the directory of the driver libraries in the specified
+// driver root. If the libraries are not found, a warning is logged and the
+// empty string is returned.
+func getLibraryRoot(driverRoot string) string {
+	libraryRoot, err := findLibraryRoot(driverRoot)
+	if err != nil {
+		log.Warnf("Error finding library path for root %v: %v", driverRoot, err)
+	}
+	log.Infof("Using library root %v", libraryRoot)
+	return libraryRoot
+}
+
 func newNvidiaContainerRuntimeInstaller() *executable {
 	target := executableTarget{
 		dotfileName: nvidiaContainerRuntimeTarget,
@@ -128,5 +138,5 @@ func findLibraryRoot(root string) (string, error) {
 }
 
 func findManagementLibrary(root string) (string, error) {
-	return findLibrary(root, "libnvidia-ml.so")
+	return findLibrary(root, defaultLibraryDirs, managementLibrary)
 }
@@ -0,0 +1,667 @@
+/**
+# Copyright (c) 2021, NVIDIA CORPORATION.  All rights reserved.
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#     http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+*/
+
+package toolkit
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"container-toolkit/internal/atomicfile"
+	"container-toolkit/internal/dryrun"
+
+	toml "github.com/pelletier/go-toml"
+	log "github.com/sirupsen/logrus"
+)
+
+// versionPattern matches the version numbers of the components
+var versionPattern = regexp.MustCompile(`[0-9]+\.[0-9]+(\.[0-9]+)*`)
+
+const (
+	// versionTimeout is the time allowed for an executable to print its version
+	versionTimeout = 5 * time.Second
+
+	// DefaultNvidiaDriverRoot specifies the default NVIDIA driver run directory
+	DefaultNvidiaDriverRoot = "/run/nvidia/driver"
+
+	nvidiaContainerCliSource         = "/usr/bin/nvidia-container-cli"
+	nvidiaContainerRuntimeHookSource = "/usr/bin/nvidia-container-toolkit"
+
+	nvidiaContainerToolkitConfigSource = "/etc/nvidia-container-runtime/config.toml"
+	configFilename                     = "config.toml"
+
+	nvidiaContainerLibrary = "libnvidia-container.so.1"
+)
+
+// defaultLibraryDirs defines the directories that are searched for libraries
+var defaultLibraryDirs = []string{
+	"/usr/lib64",
+	"/usr/lib/x86_64-linux-gnu",
+}
+
+// Options defines the options for installing the NVIDIA container toolkit
+type Options struct {
+	// ToolkitDir is the directory to which the toolkit is installed
+	ToolkitDir string `yaml:"-"`
+	// DriverRoot is the root of the NVIDIA driver installation
+	DriverRoot string `yaml:"driverRoot"`
+	// RuntimeDebug is the location of the debug log file for the NVIDIA Container Runtime
+	RuntimeDebug string `yaml:"runtimeDebug"`
+	// RuntimeLogLevel is the log level of the NVIDIA Container Runtime
+	RuntimeLogLevel string `yaml:"runtimeLogLevel"`
+	// CLIDebug is the location of the debug log file for the NVIDIA Container CLI
+	CLIDebug string `yaml:"cliDebug"`
+	// DryRun specifies that the file operations are printed instead of performed
+	DryRun bool `yaml:"dryRun"`
+	// Sources defines the locations from which the components are installed.
+	// Sources that are not specified are set to their defaults by NewInstaller.
+	Sources Sources `yaml:"-"`
+	// ConfigOverrides maps dotted keys of the toolkit config (e.g.
+	// nvidia-container-cli.load-kmods) to the values to set for them. These
+	// are applied after all other settings of the config.
+	ConfigOverrides map[string]interface{} `yaml:"configOverrides"`
+}
+
+// Sources defines the locations from which the components of the NVIDIA
+// container toolkit are installed
+type Sources struct {
+	// ContainerCLI is the path to the nvidia-container-cli executable
+	ContainerCLI string
+	// RuntimeHook is the path to the nvidia-container-toolkit executable
+	RuntimeHook string
+	// Runtime is the path to the nvidia-container-runtime executable
+	Runtime string
+	// ExperimentalRuntime is the path to the experimental nvidia-container-runtime executable
+	ExperimentalRuntime string
+	// Config is the path to the toolkit config that is used as a template
+	Config string
+	// LibraryDirs are the directories that are searched for the NVIDIA
+	// container library
+	LibraryDirs []string
+}
+
+// DefaultSources returns the default locations of the components of the
+// NVIDIA container toolkit
+func DefaultSources() Sources {
+	return Sources{
+		ContainerCLI:        nvidiaContainerCliSource,
+		RuntimeHook:         nvidiaContainerRuntimeHookSource,
+		Runtime:             nvidiaContainerRuntimeSource,
+		ExperimentalRuntime: nvidiaExperimentalContainerRuntimeSource,
+		Config:              nvidiaContainerToolkitConfigSource,
+		LibraryDirs:         defaultLibraryDirs,
+	}
+}
+
+// Installer installs, deletes and verifies the NVIDIA container toolkit with
+// the specified options. An Installer holds no state beyond its options, so
+// several installers can be used concurrently for different directories.
+type Installer struct {
+	Options
+}
+
+// NewInstaller creates an installer for the specified options. Sources that
+// are not specified in the options are set to their defaults.
+func NewInstaller(o Options) *Installer {
+	defaults := DefaultSources()
+	if o.Sources.ContainerCLI == "" {
+		o.Sources.ContainerCLI = defaults.ContainerCLI
+	}
+	if o.Sources.RuntimeHook == "" {
+		o.Sources.RuntimeHook = defaults.RuntimeHook
+	}
+	if o.Sources.Runtime == "" {
+		o.Sources.Runtime = defaults.Runtime
+	}
+	if o.Sources.ExperimentalRuntime == "" {
+		o.Sources.ExperimentalRuntime = defaults.ExperimentalRuntime
+	}
+	if o.Sources.Config == "" {
+		o.Sources.Config = defaults.Config
+	}
+	if len(o.Sources.LibraryDirs) == 0 {
+		o.Sources.LibraryDirs = defaults.LibraryDirs
+	}
+
+	return &Installer{Options: o}
+}
+
+// Delete removes the NVIDIA container toolkit
+func (i Installer) Delete() error {
+	log.Infof("Deleting NVIDIA container toolkit from '%v'", i.ToolkitDir)
+	err := i.removeAll(i.ToolkitDir)
+	if err != nil {
+		return fmt.Errorf("error deleting toolkit directory: %v", err)
+	}
+	return nil
+}
+
+// Install installs the components of the NVIDIA container toolkit.
+// Any existing installation is removed.
+func (i Installer) Install() error {
+	log.Infof("Installing NVIDIA container toolkit to '%v'", i.ToolkitDir)
+
+	log.Infof("Removing existing NVIDIA container toolkit installation")
+	err := i.removeAll(i.ToolkitDir)
+	if err != nil {
+		return fmt.Errorf("error removing toolkit directory: %v", err)
+	}
+
+	toolkitConfigDir := filepath.Join(i.ToolkitDir, ".config", "nvidia-container-runtime")
+	toolkitConfigPath := filepath.Join(toolkitConfigDir, configFilename)
+
+	err = i.createDirectories(i.ToolkitDir, toolkitConfigDir)
+	if err != nil {
+		return fmt.Errorf("could not create required directories: %v", err)
+	}
+
+	err = i.installContainerLibrary(i.ToolkitDir)
+	if err != nil {
+		return fmt.Errorf("error installing NVIDIA container library: %v", err)
+	}
+
+	err = i.installContainerRuntimes(i.ToolkitDir, i.DriverRoot)
+	if err != nil {
+		return fmt.Errorf("error installing NVIDIA container runtime: %v", err)
+	}
+
+	nvidiaContainerCliExecutable, err := i.installContainerCLI(i.ToolkitDir)
+	if err != nil {
+		return fmt.Errorf("error installing NVIDIA container CLI: %v", err)
+	}
+
+	_, err = i.installRuntimeHook(i.ToolkitDir, toolkitConfigPath)
+	if err != nil {
+		return fmt.Errorf("error installing NVIDIA container runtime hook: %v", err)
+	}
+
+	err = i.installToolkitConfig(toolkitConfigPath, i.DriverRoot, nvidiaContainerCliExecutable)
+	if err != nil {
+		return fmt.Errorf("error installing NVIDIA container toolkit config: %v", err)
+	}
+
+	return nil
+}
+
+// Regenerate updates the files of an existing installation that depend on the
+// contents of the driver root in place: the toolkit config and the wrapper of
+// the experimental runtime, which includes the directory of the driver
+// libraries. This is required if the driver is reinstalled (e.g. by a new
+// driver container) while the toolkit is in use. The executables and the
+// NVIDIA container library are left as is.
+func (i Installer) Regenerate() error {
+	log.Infof("Regenerating NVIDIA container toolkit files for driver root '%v'", i.DriverRoot)
+
+	experimentalRuntime := filepath.Join(i.ToolkitDir, nvidiaExperimentalContainerRuntimeTarget)
+	if _, err := os.Stat(experimentalRuntime); err == nil {
+		e := newNvidiaContainerRuntimeExperimentalInstaller(getLibraryRoot(i.DriverRoot))
+		_, err := e.installWrapper(i, i.ToolkitDir, experimentalRuntime)
+		if err != nil {
+			return fmt.Errorf("error regenerating experimental NVIDIA Container Runtime wrapper: %v", err)
+		}
+	}
+
+	toolkitConfigPath := filepath.Join(i.ToolkitDir, ".config", "nvidia-container-runtime", configFilename)
+	nvidiaContainerCliExecutable := filepath.Join(i.ToolkitDir, "nvidia-container-cli")
+	err := i.installToolkitConfig(toolkitConfigPath, i.DriverRoot, nvidiaContainerCliExecutable)
+	if err != nil {
+		return fmt.Errorf("error regenerating NVIDIA container toolkit config: %v", err)
+	}
+
+	return nil
+}
+
+// DriverLibrary returns the path of the NVIDIA management library in the
+// driver root with symlinks resolved. Since the library is versioned, the
+// path changes if a different driver version is installed. Unlike the lookup
+// performed when installing, this does not log the candidates, so that it can
+// be polled.
+func (i Installer) DriverLibrary() (string, error) {
+	for _, d := range defaultLibraryDirs {
+		resolved, err := filepath.EvalSymlinks(filepath.Join(i.DriverRoot, d, managementLibrary))
+		if err == nil {
+			return resolved, nil
+		}
+	}
+	return "", fmt.Errorf("error locating library '%v' in '%v'", managementLibrary, i.DriverRoot)
+}
+
+// Component is a component of the NVIDIA container toolkit in the toolkit
+// directory
+type Component struct {
+	Name      string `json:"name"`
+	Path      string `json:"path"`
+	Installed bool   `json:"installed"`
+}
+
+// Components returns the components of the NVIDIA container toolkit along
+// with whether these are installed in the toolkit directory. Wrapped
+// executables are reported by the path of their wrapper.
+func (i Installer) Components() []Component {
+	var components []Component
+	for _, name := range []string{
+		nvidiaContainerRuntimeWrapper,
+		nvidiaExperimentalContainerRuntimeWrapper,
+		"nvidia-container-cli",
+		"nvidia-container-toolkit",
+		"nvidia-container-runtime-hook",
+		nvidiaContainerLibrary,
+		configFilename,
+	} {
+		path := filepath.Join(i.ToolkitDir, name)
+		if name == configFilename {
+			path = filepath.Join(i.ToolkitDir, ".config", "nvidia-container-runtime", configFilename)
+		}
+
+		_, err := os.Stat(path)
+		components = append(components, Component{Name: name, Path: path, Installed: err == nil})
+	}
+	return components
+}
+
+// Version returns the version of an installed component. For the NVIDIA
+// container library, this is read from the name of the file the library
+// symlink points to (e.g. libnvidia-container.so.1.3.0). For executables, the
+// first version number printed by running the executable with --version is
+// returned. The version of the config is unknown.
+func (c Component) Version() (string, error) {
+	switch c.Name {
+	case nvidiaContainerLibrary:
+		resolved, err := filepath.EvalSymlinks(c.Path)
+		if err != nil {
+			return "", fmt.Errorf("unable to resolve '%v': %v", c.Path, err)
+		}
+		version := strings.TrimPrefix(filepath.Base(resolved), strings.TrimSuffix(nvidiaContainerLibrary, "1"))
+		if !versionPattern.MatchString(version) {
+			return "", fmt.Errorf("no version in library name '%v'", filepath.Base(resolved))
+		}
+		return version, nil
+	case configFilename:
+		return "", fmt.Errorf("the version of the config is unknown")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), versionTimeout)
+	defer cancel()
+
+	output, err := exec.CommandContext(ctx, c.Path, "--version").Output()
+	if err != nil {
+		return "", fmt.Errorf("unable to run '%v --version': %v", c.Path, err)
+	}
+	version := versionPattern.FindString(string(output))
+	if version == "" {
+		return "", fmt.Errorf("no version in output of '%v --version'", c.Path)
+	}
+	return version, nil
+}
+
+// Verify checks that the NVIDIA container toolkit is installed in the toolkit
+// directory. This checks that the executables and their wrappers, the NVIDIA
+// container library, and the toolkit config exist, and that the config refers
+// to the driver root of the installer if one is specified. The experimental
+// runtime is optional and is not checked.
+func (i Installer) Verify() error {
+	log.Infof("Verifying NVIDIA container toolkit in '%v'", i.ToolkitDir)
+
+	var problems []string
+	for _, name := range []string{
+		nvidiaContainerRuntimeWrapper,
+		nvidiaContainerRuntimeTarget,
+		"nvidia-container-cli",
+		"nvidia-container-cli.real",
+		"nvidia-container-toolkit",
+		"nvidia-container-toolkit.real",
+		"nvidia-container-runtime-hook",
+	} {
+		path := filepath.Join(i.ToolkitDir, name)
+		info, err := os.Stat(path)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("missing executable '%v'", path))
+			continue
+		}
+		if info.Mode()&0111 == 0 {
+			problems = append(problems, fmt.Sprintf("'%v' is not executable", path))
+		}
+	}
+
+	libraryPath := filepath.Join(i.ToolkitDir, nvidiaContainerLibrary)
+	if _, err := os.Stat(libraryPath); err != nil {
+		problems = append(problems, fmt.Sprintf("missing library '%v'", libraryPath))
+	}
+
+	toolkitConfigPath := filepath.Join(i.ToolkitDir, ".config", "nvidia-container-runtime", configFilename)
+	config, err := toml.LoadFile(toolkitConfigPath)
+	switch {
+	case err != nil:
+		problems = append(problems, fmt.Sprintf("invalid config '%v': %v", toolkitConfigPath, err))
+	case i.DriverRoot != "" && config.Get("nvidia-container-cli.root") != i.DriverRoot:
+		problems = append(problems, fmt.Sprintf("config '%v' has driver root %v instead of %v", toolkitConfigPath, config.Get("nvidia-container-cli.root"), i.DriverRoot))
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("invalid toolkit installation: %v", strings.Join(problems, "; "))
+	}
+
+	log.Infof("Successfully verified NVIDIA container toolkit")
+
+	return nil
+}
+
+// installContainerLibrary locates and installs the libnvidia-container.so.1 library.
+// A predefined set of library candidates are considered, with the first one
+// resulting in success being installed to the toolkit folder. The install process
+// resolves the symlink for the library and copies the versioned library itself.
+func (i Installer) installContainerLibrary(toolkitDir string) error {
+	log.Infof("Installing NVIDIA container library to '%v'", toolkitDir)
+
+	const libName = nvidiaContainerLibrary
+	libraryPath, err := findLibrary("", i.Sources.LibraryDirs, libName)
+	if err != nil {
+		return fmt.Errorf("error locating NVIDIA container library: %v", err)
+	}
+
+	installedLibPath, err := i.installFileToFolder(toolkitDir, libraryPath)
+	if err != nil {
+		return fmt.Errorf("error installing %v to %v: %v", libraryPath, toolkitDir, err)
+	}
+	log.Infof("Installed '%v' to '%v'", libraryPath, installedLibPath)
+
+	if filepath.Base(installedLibPath) == libName {
+		return nil
+	}
+
+	err = i.installSymlink(toolkitDir, libName, installedLibPath)
+	if err != nil {
+		return fmt.Errorf("error installing symlink for NVIDIA container library: %v", err)
+	}
+
+	return nil
+}
+
+// installToolkitConfig installs the config file for the NVIDIA container toolkit ensuring
+// that the settings are updated to match the desired install and nvidia driver directories.
+func (i Installer) installToolkitConfig(toolkitConfigPath string, nvidiaDriverDir string, nvidiaContainerCliExecutablePath string) error {
+	log.Infof("Installing NVIDIA container toolkit config '%v'", toolkitConfigPath)
+
+	config, err := toml.LoadFile(i.Sources.Config)
+	if err != nil {
+		return fmt.Errorf("could not open source config file: %v", err)
+	}
+
+	if i.DryRun {
+		return dryrun.PrintOperation("write", toolkitConfigPath)
+	}
+
+	nvidiaContainerCliKey := func(p string) []string {
+		return []string{"nvidia-container-cli", p}
+	}
+
+	// Read the ldconfig path from the config as this may differ per platform
+	// On ubuntu-based systems this ends in `.real`
+	ldconfigPath := fmt.Sprintf("%s", config.GetPath(nvidiaContainerCliKey("ldconfig")))
+
+	// Use the driver run root as the root:
+	driverLdconfigPath := "@" + filepath.Join(nvidiaDriverDir, strings.TrimPrefix(ldconfigPath, "@/"))
+
+	config.SetPath(nvidiaContainerCliKey("root"), nvidiaDriverDir)
+	config.SetPath(nvidiaContainerCliKey("path"), nvidiaContainerCliExecutablePath)
+	config.SetPath(nvidiaContainerCliKey("ldconfig"), driverLdconfigPath)
+
+	// Set the debug options if selected
+	debugOptions := map[string]string{
+		"nvidia-container-runtime.debug":     i.RuntimeDebug,
+		"nvidia-container-runtime.log-level": i.RuntimeLogLevel,
+		"nvidia-container-cli.debug":         i.CLIDebug,
+	}
+	for key, value := range debugOptions {
+		if value == "" {
+			continue
+		}
+		if config.Get(key) != nil {
+			continue
+		}
+		config.Set(key, value)
+	}
+
+	for key, value := range i.ConfigOverrides {
+		config.Set(key, value)
+	}
+
+	var targetConfig bytes.Buffer
+	_, err = config.WriteTo(&targetConfig)
+	if err != nil {
+		return fmt.Errorf("error writing config: %v", err)
+	}
+
+	// The config is replaced atomically since it may be read while it is
+	// regenerated.
+	err = atomicfile.WriteFile(toolkitConfigPath, targetConfig.Bytes(), 0644)
+	if err != nil {
+		return fmt.Errorf("could not write target config file: %v", err)
+	}
+	return nil
+}
+
+// installContainerCLI sets up the NVIDIA container CLI executable, copying the executable
+// and implementing the required wrapper
+func (i Installer) installContainerCLI(toolkitDir string) (string, error) {
+	log.Infof("Installing NVIDIA container CLI from '%v'", i.Sources.ContainerCLI)
+
+	env := map[string]string{
+		"LD_LIBRARY_PATH": toolkitDir,
+	}
+
+	e := executable{
+		source: i.Sources.ContainerCLI,
+		target: executableTarget{
+			dotfileName: "nvidia-container-cli.real",
+			wrapperName: "nvidia-container-cli",
+		},
+		env: env,
+	}
+
+	installedPath, err := e.install(i, toolkitDir)
+	if err != nil {
+		return "", fmt.Errorf("error installing NVIDIA container CLI: %v", err)
+	}
+	return installedPath, nil
+}
+
+// installRuntimeHook sets up the NVIDIA runtime hook, copying the executable
+// and implementing the required wrapper
+func (i Installer) installRuntimeHook(toolkitDir string, configFilePath string) (string, error) {
+	log.Infof("Installing NVIDIA container runtime hook from '%v'", i.Sources.RuntimeHook)
+
+	argLines := []string{
+		fmt.Sprintf("-config \"%s\"", configFilePath),
+	}
+
+	e := executable{
+		source: i.Sources.RuntimeHook,
+		target: executableTarget{
+			dotfileName: "nvidia-container-toolkit.real",
+			wrapperName: "nvidia-container-toolkit",
+		},
+		argLines: argLines,
+	}
+
+	installedPath, err := e.install(i, toolkitDir)
+	if err != nil {
+		return "", fmt.Errorf("error installing NVIDIA container runtime hook: %v", err)
+	}
+
+	err = i.installSymlink(toolkitDir, "nvidia-container-runtime-hook", installedPath)
+	if err != nil {
+		return "", fmt.Errorf("error installing symlink to NVIDIA container runtime hook: %v", err)
+	}
+
+	return installedPath, nil
+}
+
+// installSymlink creates a symlink in the toolkitDirectory that points to the specified target.
+// Note: The target is assumed to be local to the toolkit directory
+func (i Installer) installSymlink(toolkitDir string, link string, target string) error {
+	symlinkPath := filepath.Join(toolkitDir, link)
+	targetPath := filepath.Base(target)
+	log.Infof("Creating symlink '%v' -> '%v'", symlinkPath, targetPath)
+
+	if i.DryRun {
+		return dryrun.PrintOperation("symlink", symlinkPath, "->", targetPath)
+	}
+
+	err := os.Symlink(targetPath, symlinkPath)
+	if err != nil {
+		return fmt.Errorf("error creating symlink '%v' => '%v': %v", symlinkPath, targetPath, err)
+	}
+	return nil
+}
+
+// installFileToFolder copies a source file to a destination folder.
+// The path of the input file is ignored.
+// e.g. installFileToFolder("/some/path/file.txt", "/output/path")
+// will result in a file "/output/path/file.txt" being generated
+func (i Installer) installFileToFolder(destFolder string, src string) (string, error) {
+	name := filepath.Base(src)
+	return i.installFileToFolderWithName(destFolder, name, src)
+}
+
+// cp src destFolder/name
+func (i Installer) installFileToFolderWithName(destFolder string, name, src string) (string, error) {
+	dest := filepath.Join(destFolder, name)
+	err := i.installFile(dest, src)
+	if err != nil {
+		return "", fmt.Errorf("error copying '%v' to '%v': %v", src, dest, err)
+	}
+	return dest, nil
+}
+
+// installFile copies a file from src to dest and maintains
+// file modes
+func (i Installer) installFile(dest string, src string) error {
+	log.Infof("Installing '%v' to '%v'", src, dest)
+
+	if i.DryRun {
+		return dryrun.PrintOperation("copy", src, "->", dest)
+	}
+
+	source, err := os.Open(src)
+	if err != nil {
+		return fmt.Errorf("error opening source: %v", err)
+	}
+	defer source.Close()
+
+	destination, err := os.Create(dest)
+	if err != nil {
+		return fmt.Errorf("error creating destination: %v", err)
+	}
+	defer destination.Close()
+
+	_, err = io.Copy(destination, source)
+	if err != nil {
+		return fmt.Errorf("error copying file: %v", err)
+	}
+
+	err = applyModeFromSource(dest, src)
+	if err != nil {
+		return fmt.Errorf("error setting destination file mode: %v", err)
+	}
+	return nil
+}
+
+// applyModeFromSource sets the file mode for a destination file
+// to match that of a specified source file
+func applyModeFromSource(dest string, src string) error {
+	sourceInfo, err := os.Stat(src)
+	if err != nil {
+		return fmt.Errorf("error getting file info for '%v': %v", src, err)
+	}
+	err = os.Chmod(dest, sourceInfo.Mode())
+	if err != nil {
+		return fmt.Errorf("error setting mode for '%v': %v", dest, err)
+	}
+	return nil
+}
+
+// findLibrary searches the specified candidate directories in the specified
+// root for a given library name
+func findLibrary(root string, candidateDirs []string, libName string) (string, error) {
+	log.Infof("Finding library %v (root=%v)", libName, root)
+
+	for _, d := range candidateDirs {
+		l := filepath.Join(root, d, libName)
+		log.Infof("Checking library candidate '%v'", l)
+
+		libraryCandidate, err := resolveLink(l)
+		if err != nil {
+			log.Infof("Skipping library candidate '%v': %v", l, err)
+			continue
+		}
+
+		return libraryCandidate, nil
+	}
+
+	return "", fmt.Errorf("error locating library '%v'", libName)
+}
+
+// resolveLink finds the target of a symlink or the file itself in the
+// case of a regular file.
+// This is equivalent to running `readlink -f ${l}`
+func resolveLink(l string) (string, error) {
+	resolved, err := filepath.EvalSymlinks(l)
+	if err != nil {
+		return "", fmt.Errorf("error resolving link '%v': %v", l, err)
+	}
+	if l != resolved {
+		log.Infof("Resolved link: '%v' => '%v'", l, resolved)
+	}
+	return resolved, nil
+}
+
+func (i Installer) createDirectories(dir ...string) error {
+	for _, d := range dir {
+		log.Infof("Creating directory '%v'", d)
+		if i.DryRun {
+			err := dryrun.PrintOperation("mkdir", d)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		err := os.MkdirAll(d, 0755)
+		if err != nil {
+			return fmt.Errorf("error creating directory: %v", err)
+		}
+	}
+	return nil
+}
+
+// removeAll is equivalent to running rm -rf on the specified path
+func (i Installer) removeAll(path string) error {
+	if i.DryRun {
+		if _, err := os.Lstat(path); os.IsNotExist(err) {
+			return nil
+		}
+		return dryrun.PrintOperation("remove", path)
+	}
+	return os.RemoveAll(path)
+}
@@ -0,0 +1,171 @@
+/**
+# Copyright (c) 2021, NVIDIA CORPORATION.  All rights reserved.
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#     http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+*/
+
+package toolkit
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	toml "github.com/pelletier/go-toml"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInstaller(t *testing.T) {
+	sourceFolder, err := os.MkdirTemp("", "")
+	require.NoError(t, err)
+	defer os.RemoveAll(sourceFolder)
+
+	sources := createTestSources(t, sourceFolder)
+
+	destFolder, err := os.MkdirTemp("", "output-*")
+	require.NoError(t, err)
+	defer os.RemoveAll(destFolder)
+
+	toolkitDir := filepath.Join(destFolder, "toolkit")
+
+	i := NewInstaller(Options{
+		ToolkitDir:      toolkitDir,
+		DriverRoot:      "/driver/root",
+		Sources:         sources,
+		ConfigOverrides: map[string]interface{}{"nvidia-container-cli.load-kmods": false},
+	})
+
+	require.Error(t, i.Verify())
+	require.NoError(t, i.Install())
+	require.NoError(t, i.Verify())
+
+	for _, c := range i.Components() {
+		// The experimental runtime is not included in the sources
+		require.Equal(t, c.Name != "nvidia-container-runtime-experimental", c.Installed, c.Name)
+
+		version, err := c.Version()
+		switch c.Name {
+		case "libnvidia-container.so.1":
+			require.NoError(t, err)
+			require.Equal(t, "1.3.0", version)
+		case "nvidia-container-cli", "nvidia-container-toolkit":
+			require.NoError(t, err, c.Name)
+			require.Equal(t, "1.2.3", version, c.Name)
+		case "config.toml", "nvidia-container-runtime-experimental":
+			require.Error(t, err, c.Name)
+		}
+	}
+
+	config, err := toml.LoadFile(filepath.Join(toolkitDir, ".config", "nvidia-container-runtime", "config.toml"))
+	require.NoError(t, err)
+	require.Equal(t, "/driver/root", config.Get("nvidia-container-cli.root"))
+	require.Equal(t, "@/driver/root/sbin/ldconfig", config.Get("nvidia-container-cli.ldconfig"))
+	require.Equal(t, filepath.Join(toolkitDir, "nvidia-container-cli"), config.Get("nvidia-container-cli.path"))
+	require.Equal(t, false, config.Get("nvidia-container-cli.load-kmods"))
+
+	// An installation for a different driver root is invalid
+	other := NewInstaller(Options{ToolkitDir: toolkitDir, DriverRoot: "/other/root"})
+	require.Error(t, other.Verify())
+
+	require.NoError(t, os.Remove(filepath.Join(toolkitDir, "nvidia-container-cli.real")))
+	require.Error(t, i.Verify())
+
+	require.NoError(t, i.Delete())
+	_, err = os.Stat(toolkitDir)
+	require.True(t, os.IsNotExist(err))
+}
+
+func TestNewInstallerDefaults(t *testing.T) {
+	i := NewInstaller(Options{
+		Sources: Sources{ContainerCLI: "/custom/nvidia-container-cli"},
+	})
+
+	expected := DefaultSources()
+	expected.ContainerCLI = "/custom/nvidia-container-cli"
+	require.Equal(t, expected, i.Sources)
+}
+
+// createTestSources creates fake toolkit components in the specified folder.
+// The experimental runtime is not created.
+func createTestSources(t *testing.T, sourceFolder string) Sources {
+	libFolder := filepath.Join(sourceFolder, "lib")
+	require.NoError(t, os.MkdirAll(libFolder, 0755))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(libFolder, "libnvidia-container.so.1.3.0"), nil, 0644))
+	require.NoError(t, os.Symlink("libnvidia-container.so.1.3.0", filepath.Join(libFolder, "libnvidia-container.so.1")))
+
+	sources := Sources{
+		ContainerCLI:        filepath.Join(sourceFolder, "nvidia-container-cli"),
+		RuntimeHook:         filepath.Join(sourceFolder, "nvidia-container-toolkit"),
+		Runtime:             filepath.Join(sourceFolder, "nvidia-container-runtime"),
+		ExperimentalRuntime: filepath.Join(sourceFolder, "nvidia-container-runtime.experimental"),
+		Config:              filepath.Join(sourceFolder, "config.toml"),
+		LibraryDirs:         []string{libFolder},
+	}
+	for _, executable := range []string{sources.ContainerCLI, sources.RuntimeHook, sources.Runtime} {
+		require.NoError(t, ioutil.WriteFile(executable, []byte("#! /bin/sh\necho version: 1.2.3\n"), 0755))
+	}
+	require.NoError(t, ioutil.WriteFile(sources.Config, []byte("[nvidia-container-cli]\nldconfig = \"@/sbin/ldconfig\"\n"), 0644))
+
+	return sources
+}
+
+func TestRegenerate(t *testing.T) {
+	sourceFolder, err := os.MkdirTemp("", "")
+	require.NoError(t, err)
+	defer os.RemoveAll(sourceFolder)
+
+	sources := createTestSources(t, sourceFolder)
+	sources.ExperimentalRuntime = sources.Runtime
+
+	toolkitDir := filepath.Join(sourceFolder, "toolkit")
+	driverRoot := filepath.Join(sourceFolder, "driver")
+	libraryRoot := filepath.Join(driverRoot, "usr", "lib64")
+
+	i := NewInstaller(Options{
+		ToolkitDir: toolkitDir,
+		DriverRoot: driverRoot,
+		Sources:    sources,
+	})
+
+	// The driver is not installed yet
+	require.NoError(t, i.Install())
+	_, err = i.DriverLibrary()
+	require.Error(t, err)
+
+	wrapper := filepath.Join(toolkitDir, "nvidia-container-runtime-experimental")
+	contents, err := ioutil.ReadFile(wrapper)
+	require.NoError(t, err)
+	require.NotContains(t, string(contents), "LD_LIBRARY_PATH")
+
+	require.NoError(t, os.MkdirAll(libraryRoot, 0755))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(libraryRoot, "libnvidia-ml.so.470.57.02"), nil, 0644))
+	require.NoError(t, os.Symlink("libnvidia-ml.so.470.57.02", filepath.Join(libraryRoot, "libnvidia-ml.so")))
+
+	library, err := i.DriverLibrary()
+	require.NoError(t, err)
+	require.Equal(t, filepath.Join(libraryRoot, "libnvidia-ml.so.470.57.02"), library)
+
+	require.NoError(t, os.Remove(filepath.Join(toolkitDir, ".config", "nvidia-container-runtime", "config.toml")))
+	require.NoError(t, i.Regenerate())
+
+	contents, err = ioutil.ReadFile(wrapper)
+	require.NoError(t, err)
+	require.Contains(t, string(contents), "LD_LIBRARY_PATH="+libraryRoot+":$LD_LIBRARY_PATH")
+
+	info, err := os.Stat(wrapper)
+	require.NoError(t, err)
+	require.NotZero(t, info.Mode()&0111)
+
+	require.NoError(t, i.Verify())
+}
@@ -125,6 +125,7 @@ testing::containerd::main() {
 	testing::containerd::toolkit::test_config empty
 	testing::containerd::toolkit::test_config v1
 	testing::containerd::toolkit::test_config v2
+	testing::containerd::toolkit::test_config v3
 
 	testing::containerd::cleanup
 